@@ -0,0 +1,261 @@
+// mockoidc 本地联调用的 OpenID Connect 身份提供方 (只用于开发测试，切勿部署到生产)
+//
+//	go run ./cmd/mockoidc -addr :9000
+//
+// 然后启动后端时打开统一身份认证并提供同样的 client_secret:
+//
+//	HOSPITAL_AUTH_OIDC_ENABLED=true HOSPITAL_AUTH_OIDC_CLIENT_SECRET=mock-client-secret-local-dev ./server
+//
+// 浏览器访问
+// http://localhost:8080/api/v1/oidc/login 即可在用户列表中选择身份登录。
+// 用脚本测试时可以在登录地址后加 login_hint=<用户名> 跳过选择页。
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockUser 预置的测试身份
+type mockUser struct {
+	Subject  string
+	Username string
+	Name     string
+	Email    string
+	Groups   []string
+}
+
+var users = []mockUser{
+	{"u-1001", "zhang.it", "张运维", "zhang.it@hospital.example", []string{"hospital-it-admins"}},
+	{"u-1002", "wang.fin", "王会计", "wang.fin@hospital.example", []string{"hospital-finance"}},
+	{"u-1003", "chen.doc", "陈医生", "chen.doc@hospital.example", []string{"hospital-doctors", "dept-orthopedics"}},
+	{"u-1004", "zhao.reg", "赵挂号", "zhao.reg@hospital.example", []string{"hospital-registration"}},
+	{"u-1005", "sun.guest", "孙访客", "sun.guest@hospital.example", []string{"visitors"}}, // 没有映射的用户组，应被拒绝
+}
+
+// authCode 已签发、尚未兑换的授权码
+type authCode struct {
+	user        mockUser
+	redirectURI string
+	nonce       string
+	challenge   string
+	expires     time.Time
+}
+
+type server struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	kid          string
+
+	mu    sync.Mutex
+	codes map[string]authCode
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "监听地址")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer (必须与 config.yaml 一致)")
+	clientID := flag.String("client-id", "hospital-system", "client_id")
+	clientSecret := flag.String("client-secret", "mock-client-secret-local-dev", "client_secret")
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatal(err)
+	}
+	s := &server{
+		issuer:       *issuer,
+		clientID:     *clientID,
+		clientSecret: *clientSecret,
+		key:          key,
+		kid:          "mock-" + randomString()[:8],
+		codes:        map[string]authCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/jwks", s.jwks)
+
+	log.Printf("Mock OIDC 已启动: %s (client_id=%s)", s.issuer, s.clientID)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
+
+func (s *server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+var pickTemplate = template.Must(template.New("pick").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Mock OIDC 登录</title></head>
+<body><h3>选择登录身份 (Mock OIDC)</h3><ul>
+{{range .Users}}<li><a href="{{$.Base}}&login_hint={{.Username}}">{{.Name}} ({{.Username}})</a> {{.Groups}}</li>{{end}}
+</ul></body></html>`))
+
+// authorize 登录页：没有 login_hint 时列出可选身份，选定后签发授权码并跳回客户端
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.clientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid client_id or response_type", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE (S256) required", http.StatusBadRequest)
+		return
+	}
+
+	hint := q.Get("login_hint")
+	if hint == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		pickTemplate.Execute(w, map[string]interface{}{"Users": users, "Base": template.URL("/authorize?" + q.Encode())})
+		return
+	}
+
+	var user *mockUser
+	for i := range users {
+		if users[i].Username == hint {
+			user = &users[i]
+		}
+	}
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	back := redirect.Query()
+	back.Set("state", q.Get("state"))
+	if user == nil {
+		back.Set("error", "access_denied")
+	} else {
+		code := randomString()
+		s.mu.Lock()
+		s.codes[code] = authCode{
+			user:        *user,
+			redirectURI: q.Get("redirect_uri"),
+			nonce:       q.Get("nonce"),
+			challenge:   q.Get("code_challenge"),
+			expires:     time.Now().Add(time.Minute),
+		}
+		s.mu.Unlock()
+		back.Set("code", code)
+	}
+	redirect.RawQuery = back.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token 用授权码换 id_token (校验客户端密钥、redirect_uri 和 PKCE)
+func (s *server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if id != s.clientID || secret != s.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	// 授权码只能用一次
+	s.mu.Lock()
+	code, found := s.codes[r.PostFormValue("code")]
+	delete(s.codes, r.PostFormValue("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !found || time.Now().After(code.expires) ||
+		code.redirectURI != r.PostFormValue("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                code.user.Subject,
+		"aud":                s.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              code.nonce,
+		"name":               code.user.Name,
+		"email":              code.user.Email,
+		"preferred_username": code.user.Username,
+		"groups":             code.user.Groups,
+	})
+	idToken.Header["kid"] = s.kid
+	signed, err := idToken.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func (s *server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"use": "sig",
+		"alg": "RS256",
+		"kid": s.kid,
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("写入响应失败: %v", err)
+	}
+}
+
+func randomString() string {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"hospital-system/config"
+	"hospital-system/internal/backup"
+	"hospital-system/internal/database"
+
+	"gorm.io/gorm"
+)
+
+// runBackupCommand 数据库备份 (服务运行中也可以执行)
+//
+//	./server backup run            立即备份到 backup.dir，并删除超出保留份数的旧备份
+//	./server backup export <文件>  把当前时刻的快照导出到指定文件 (配置了 backup.encryption_key 时加密)
+//	./server backup list           列出备份目录中的备份和最近一次备份结果
+func runBackupCommand(args []string) {
+	usage := fmt.Sprintf("用法: %s backup run | export <文件> | list", os.Args[0])
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+	cfg := config.Get().Backup
+
+	switch args[0] {
+	case "run":
+		db := openForBackup()
+		defer database.Close()
+		if _, err := backup.Run(context.Background(), db, backup.TriggerCommand); err != nil {
+			log.Fatalf("备份失败: %v", err)
+		}
+
+	case "export":
+		if len(args) < 2 {
+			log.Fatal(usage)
+		}
+		db := openForBackup()
+		defer database.Close()
+		size, sum, err := backup.Export(context.Background(), db, args[1], cfg.EncryptionKey)
+		if err != nil {
+			log.Fatalf("导出失败: %v", err)
+		}
+		log.Printf("已导出到 %s (%d 字节，加密: %v，SHA-256 %s)", args[1], size, cfg.EncryptionKey != "", sum)
+
+	case "list":
+		files, err := backup.List(cfg.Dir)
+		if err != nil {
+			log.Fatalf("读取备份目录失败: %v", err)
+		}
+		for _, f := range files {
+			encrypted := ""
+			if f.Encrypted {
+				encrypted = "已加密"
+			}
+			fmt.Printf("%s\t%d\t%s\n", f.Name, f.Size, encrypted)
+		}
+		if last := backup.Status(); last != nil {
+			status := "成功"
+			if !last.Success {
+				status = "失败: " + last.Error
+			}
+			fmt.Printf("最近一次备份: %s (%s) %s\n", last.Time.Format("2006-01-02 15:04:05"), last.Trigger, status)
+		}
+
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// openForBackup 连接数据库 (不执行迁移，备份的就是数据库当前的样子)
+func openForBackup() *gorm.DB {
+	db, err := database.Open(dbConfig())
+	if err != nil {
+		log.Fatalf("无法连接数据库: %v", err)
+	}
+	database.DB = db
+	return db
+}
+
+// runRestoreCommand 从备份恢复数据库，必须先停止服务 (数据库仍在使用时拒绝恢复，见 backup.Restore)
+//
+//	./server restore <备份文件>
+func runRestoreCommand(args []string) {
+	if len(args) != 1 {
+		log.Fatalf("用法: %s restore <备份文件> (请先停止服务)", os.Args[0])
+	}
+	dc := config.Get().Database
+	if dc.Driver != "" && dc.Driver != database.DriverSQLite {
+		log.Fatal(backup.ErrUnsupported)
+	}
+
+	previous, err := backup.Restore(args[0], dc.Path, config.Get().Backup.EncryptionKey)
+	if err != nil && previous != "" {
+		log.Fatalf("恢复失败: %v (原数据库已改名为 %s，可手动改回)", err, previous)
+	}
+	if err != nil {
+		log.Fatalf("恢复失败，原数据库未改动: %v", err)
+	}
+	if previous != "" {
+		log.Printf("原数据库已改名保留为 %s，确认无误后可以删除", previous)
+	}
+	log.Println("恢复完成，启动服务时会按需执行迁移")
+}
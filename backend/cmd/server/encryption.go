@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/fieldcrypt"
+)
+
+// loadFieldKeys 加载敏感字段加密密钥，首次启动密钥目录为空时自动生成
+func loadFieldKeys() *fieldcrypt.Keyring {
+	cfg := config.Get().Encryption
+	keys, err := fieldcrypt.Load(cfg.KeysDir, cfg.ActiveVersion)
+	if errors.Is(err, fieldcrypt.ErrNoKeys) && cfg.ActiveVersion == 0 {
+		version, genErr := fieldcrypt.Generate(cfg.KeysDir)
+		if genErr != nil {
+			log.Fatalf("生成字段加密密钥失败: %v", genErr)
+		}
+		log.Printf("字段加密密钥目录 %s 为空，已生成密钥 v%d (请单独备份该目录)", cfg.KeysDir, version)
+		keys, err = fieldcrypt.Load(cfg.KeysDir, 0)
+	}
+	if err != nil {
+		log.Fatalf("加载字段加密密钥失败: %v", err)
+	}
+	fieldcrypt.Use(keys)
+	log.Printf("字段加密密钥: v%d，共 %d 把", keys.Active(), len(keys.Versions()))
+	return keys
+}
+
+// runEncryptionCommand 敏感字段加密密钥管理
+//
+//	./server encryption generate-key  生成新版本的密钥 (重启后用于加密新数据)
+//	./server encryption reencrypt     用当前密钥重新加密旧版本密钥加密的数据和明文 (轮换密钥后执行)
+//	./server encryption status        列出密钥和各表需要重新加密的行数
+func runEncryptionCommand(args []string) {
+	usage := fmt.Sprintf("用法: %s encryption generate-key | reencrypt | status", os.Args[0])
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+
+	switch args[0] {
+	case "generate-key":
+		version, err := fieldcrypt.Generate(config.Get().Encryption.KeysDir)
+		if err != nil {
+			log.Fatalf("生成密钥失败: %v", err)
+		}
+		log.Printf("已生成密钥 v%d，重启服务后用于加密新数据，之后执行 encryption reencrypt 重新加密旧数据", version)
+
+	case "reencrypt":
+		loadFieldKeys()
+		db, err := database.Open(dbConfig())
+		if err != nil {
+			log.Fatalf("无法连接数据库: %v", err)
+		}
+		database.DB = db
+		defer database.Close()
+		n, err := database.Reencrypt(db, true)
+		if err != nil {
+			log.Fatalf("重新加密失败 (已处理 %d 行，可以重复执行): %v", n, err)
+		}
+		log.Printf("已重新加密 %d 行，全部使用密钥 v%d", n, fieldcrypt.Active())
+
+	case "status":
+		keys := loadFieldKeys()
+		db, err := database.Open(dbConfig())
+		if err != nil {
+			log.Fatalf("无法连接数据库: %v", err)
+		}
+		database.DB = db
+		defer database.Close()
+		for _, v := range keys.Versions() {
+			status := "仅解密"
+			if v == keys.Active() {
+				status = "加密中"
+			}
+			fmt.Printf("v%d\t%s\n", v, status)
+		}
+		counts, err := database.PendingReencrypt(db, true)
+		if err != nil {
+			log.Fatalf("统计失败: %v", err)
+		}
+		for _, table := range slices.Sorted(maps.Keys(counts)) {
+			fmt.Printf("%s\t%d 行需要重新加密\n", table, counts[table])
+		}
+
+	default:
+		log.Fatal(usage)
+	}
+}
@@ -1,29 +1,110 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"hospital-system/config"
 	"hospital-system/internal/api"
 	"hospital-system/internal/api/middleware"
+	"hospital-system/internal/audit"
+	"hospital-system/internal/backup"
 	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
 	"hospital-system/internal/model"
+	"hospital-system/internal/privacy"
+	"hospital-system/internal/scan"
+	"hospital-system/internal/signing"
+	"hospital-system/internal/sms"
+	"hospital-system/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
+// stringList 可重复的命令行参数
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
 func main() {
-	// 1. 加载配置
-	if err := config.LoadConfig("./config.yaml"); err != nil {
-		log.Fatalf("无法加载配置文件: %v", err)
+	// 1. 加载配置 (默认值 -> 配置文件 -> 环境变量 -> 命令行参数)
+	configPath := flag.String("config", "", "配置文件路径 (默认 ./config.yaml，也可用环境变量 HOSPITAL_CONFIG 指定)")
+	port := flag.Int("port", 0, "监听端口，覆盖 server.port")
+	var sets stringList
+	flag.Var(&sets, "set", "覆盖任意配置项，例如 -set auth.lockout.max_attempts=10 (可重复)")
+	flag.Parse()
+
+	overrides := []string(sets)
+	if *port != 0 {
+		overrides = append(overrides, fmt.Sprintf("server.port=%d", *port))
+	}
+	if err := config.LoadConfig(*configPath, overrides...); err != nil {
+		log.Fatalf("无法加载配置: %v", err)
+	}
+
+	// 命令行子命令，例如: ./server audit verify、./server -config prod.yaml config print
+	if args := flag.Args(); len(args) > 0 {
+		runCommand(args)
+		return
+	}
+
+	mustValidateConfig()
+	logging.Init(config.Get().Log.Level) // 已校验过，不会出错
+	if config.LoadedFile != "" {
+		log.Printf("配置文件: %s", config.LoadedFile)
+	} else {
+		log.Println("未找到配置文件，使用默认值和环境变量")
+	}
+
+	// 1.1 SIGTERM / Ctrl+C 时优雅退出 (第二次信号直接退出)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	// 1.2 监视配置文件和 SIGHUP，非关键配置 (Token 有效期、密码策略等) 修改后无需重启
+	go config.Watch(ctx)
+
+	// 2. 初始化 JWT 签名密钥
+	middleware.InitAuth(loadSigningKeys())
+
+	// 2.1 初始化短信发送
+	if err := sms.Init(config.Get().SMS.Provider); err != nil {
+		log.Fatalf("初始化短信服务失败: %v", err)
+	}
+
+	// 2.2 初始化上传文件存储
+	initStorage()
+	if err := scan.Init(config.Get().Storage.Scanner); err != nil {
+		log.Fatalf("初始化文件扫描失败: %v", err)
 	}
 
-	// 2. 初始化 JWT 密钥
-	middleware.InitAuth(config.AppConfig.Auth.JwtSecret)
+	// 2.3 加载敏感字段加密密钥
+	loadFieldKeys()
 
-	// 3. 初始化数据库 (使用配置文件中的路径)
-	// 确保 config.yaml 里的路径是 "./storage/db/hospital.db"
-	database.InitDB(config.AppConfig.Database.Path)
+	// 3. 初始化数据库 (SQLite 或 PostgreSQL，见 config.yaml 的 database)
+	database.InitDB(dbConfig(), config.Get().Database.AutoMigrate)
+
+	// 3.1 定时备份 (backup.interval_hours) 和按保留期限匿名化、清理到期数据 (retention)
+	// 退出时先停止这些后台任务并等待正在执行的一次结束，再关闭数据库
+	jobCtx, stopJobs := context.WithCancel(ctx)
+	var jobs sync.WaitGroup
+	jobs.Go(func() { backup.Schedule(jobCtx, database.DB) })
+	jobs.Go(func() { privacy.Schedule(jobCtx, database.DB) })
 
 	// 4. 初始化全局管理员(如果没有管理员，自动创建一个)
 	var adminCount int64
@@ -31,25 +112,40 @@ func main() {
 	if adminCount == 0 {
 		log.Println("系统中没有管理员，正在初始化默认账号...")
 		defaultAdmin := model.User{
-			Username: "admin",
-			Password: "admin123", // 会自动加密
-			Role:     "global_admin",
-			OrgID:    1,
+			Username:           "admin",
+			Password:           "admin123", // 会自动加密
+			Role:               "global_admin",
+			OrgID:              1,
+			MustChangePassword: true, // 首次登录必须修改默认密码
 		}
 		if err := database.DB.Create(&defaultAdmin).Error; err != nil {
 			log.Fatalf("初始化管理员失败: %v", err)
 		}
-		log.Println("默认管理员已创建 -> 账号: admin / 密码: admin123")
+		log.Println("默认管理员已创建 -> 账号: admin，首次登录后必须修改密码")
+	} else {
+		// 老数据库里的 admin 如果还在用默认密码，同样强制修改
+		var admin model.User
+		if err := database.DB.Where("username = ?", "admin").First(&admin).Error; err == nil &&
+			!admin.MustChangePassword && admin.CheckPassword("admin123") {
+			database.DB.Model(&admin).Update("must_change_password", true)
+			log.Println("管理员 admin 仍在使用默认密码，已标记为下次登录必须修改")
+		}
 	}
 
-	// 5. 初始化 Gin 路由
-	r := gin.Default()
+	// 5. 初始化 Gin 路由 (请求日志按 info 级别输出，log.level 为 warn、error 时关闭)
+	r := gin.New()
+	r.Use(gin.LoggerWithConfig(gin.LoggerConfig{
+		Skip: func(*gin.Context) bool { return !logging.Enabled(slog.LevelInfo) },
+	}), gin.Recovery())
+
+	// 就绪检查 (启动完成前和退出过程中返回 503)
+	r.GET("/ready", readyHandler)
 
-	// 心跳测试
+	// 心跳测试 (存活检查)
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "pong",
-			"port":    config.AppConfig.Server.Port, // 验证配置读取
+			"port":    config.Get().Server.Port, // 验证配置读取
 		})
 	})
 
@@ -57,25 +153,65 @@ func main() {
 	// 权限分组与路由配置 (根据架构图实现)
 	// ==========================================
 
+	// 0. 公钥发布 (JWKS)，其他内部服务据此校验本系统签发的 Token
+	r.GET("/.well-known/jwks.json", api.GetJWKS)
+
+	// 0.1 上传的医院图片、医生照片 (病历附件不在这里提供)
+	r.GET("/uploads/*key", api.ServeUpload)
+
 	// 1. 公开接口 (Public)
 	// 对应图中: /login, /register
 	auth := r.Group("/api/v1")
+	auth.Use(middleware.AuditMiddleware())
 	{
-		auth.POST("/login", api.LoginHandler)               // 登录获取 Token
-		auth.POST("/register", api.RegisterHandler)         // 用户注册 (仅供演示或初始管理员用)
-		auth.GET("/hospital/images", api.GetHospitalImages) //图片信息
+		auth.POST("/login", api.LoginHandler)                 // 登录获取 Token
+		auth.POST("/login/mfa", api.LoginMFAHandler)          // 登录第二步：提交两步验证码
+		auth.POST("/register", api.RegisterHandler)           // 患者自助注册 (实名 + 手机验证)
+		auth.POST("/register/sms_code", api.SendRegisterCode) // 发送注册验证码
+		auth.GET("/hospital/images", api.GetHospitalImages)   //图片信息
+		auth.GET("/doctors", api.GetDoctorDirectory)          // 公开医生目录
+		auth.GET("/doctors/:id", api.GetDoctorDetail)         // 医生详情
+		auth.POST("/password/reset", api.ResetPassword)       // 凭管理员发放的一次性凭证重置密码
+
+		auth.GET("/oidc/login", api.OIDCLogin)       // 员工统一身份认证：跳转 IdP
+		auth.GET("/oidc/callback", api.OIDCCallback) // IdP 回调
+	}
+
+	// 1.1 个人账户接口 (Me)
+	// 允许 "必须先修改密码 / 绑定两步验证" 的受限 Token 访问
+	me := r.Group("/api/v1/dashboard/me")
+	me.Use(middleware.AccountAuthMiddleware(), middleware.AuditMiddleware())
+	{
+		me.PUT("/password", api.ChangePassword) // 修改自己的密码
+
+		me.GET("/mfa", api.GetMFAStatus)                            // 两步验证状态
+		me.POST("/mfa/enroll", api.EnrollMFA)                       // 生成绑定二维码
+		me.POST("/mfa/activate", api.ActivateMFA)                   // 提交验证码确认绑定
+		me.DELETE("/mfa", api.DisableMFA)                           // 关闭两步验证
+		me.POST("/mfa/recovery_codes", api.RegenerateRecoveryCodes) // 重新生成恢复码
 	}
 
 	// 2. 受保护接口组 (Dashboard)
 	// 所有 /api/v1/dashboard 下的请求都需要 JWT 认证
 	dash := r.Group("/api/v1/dashboard")
-	dash.Use(middleware.AuthMiddleware())
+	dash.Use(middleware.AuthMiddleware(), middleware.AuditMiddleware())
 	{
 		// 对应 Module 6：获取首页统计数据
 		dash.GET("/stats", api.GetDashboardStats)
 		// 通用数据接口，所有登录用户都能获取医生列表
 		dash.GET("/doctors", api.GetDoctorList)
 
+		// [Group 0] 患者档案 (/patients)，前台建档
+		patients := dash.Group("/patients")
+		patients.Use(middleware.RoleMiddleware("registration", "org_admin", "global_admin"))
+		{
+			patients.GET("/", api.GetPatients)    // 查询档案
+			patients.POST("/", api.CreatePatient) // 新建档案
+
+			// 代患者导出本人全部数据 (必须填写理由，记入病历访问日志)
+			patients.GET("/:id/export", middleware.RoleMiddleware("registration", "global_admin"), api.ExportPatientData)
+		}
+
 		// [Group 1] 挂号业务 (/bookings)
 		// 对应图中: /bookings -> 预约就诊相关
 		booking := dash.Group("/bookings")
@@ -85,6 +221,16 @@ func main() {
 			booking.POST("/", api.CreateBooking) // 操作：新增挂号
 		}
 
+		// [Group 1.1] 家属管理 (/dependents)
+		dependents := dash.Group("/dependents")
+		dependents.Use(middleware.RoleMiddleware("general_user"))
+		{
+			dependents.GET("/", api.GetDependents)              // 我的家属
+			dependents.POST("/", api.CreateDependent)           // 登记家属
+			dependents.POST("/sms_code", api.SendDependentCode) // 给成年家属发送授权验证码
+			dependents.DELETE("/:id", api.RevokeDependent)      // 解除关系
+		}
+
 		// [Group 2] 缴费业务 (/payment)
 		// 对应图中: /payment -> 缴费入口
 		payment := dash.Group("/payment")
@@ -110,14 +256,69 @@ func main() {
 		{
 			doctor.GET("/patients", api.GetPendingPatients)          // 左侧：候诊列表 (Status=Pending)
 			doctor.POST("/medical_records", api.SubmitMedicalRecord) // 右侧：提交诊断 -> 生成订单
+			doctor.POST("/lab_results", api.SubmitLabResult)         // 录入检验结果
+
+			// 医生维护自己的执业信息 (简介、擅长、照片、出诊日)
+			doctor.GET("/profile", middleware.RoleMiddleware("doctor"), api.GetMyDoctorProfile)
+			doctor.PUT("/profile", middleware.RoleMiddleware("doctor"), api.UpdateMyDoctorProfile)
 		}
 
 		// [Group 5] 病历 (/medical_record)
 		// 对应图中: /medical_record -> 展示问诊记录
+		// 仅患者本人、接诊医生、获授权科室医生、紧急访问医生可看；管理员只能审查访问日志
 		medical_record := dash.Group("/medical_record")
-		medical_record.Use(middleware.RoleMiddleware("general_user", "doctor", "registration", "finance", "org_admin", "global_admin"))
 		{
-			medical_record.GET("/", api.GetMedicalRecords)
+			medical_record.GET("/", middleware.RoleMiddleware("general_user", "doctor"), api.GetMedicalRecords)
+
+			// 患者授权科室查看
+			consents := medical_record.Group("/consents")
+			consents.Use(middleware.RoleMiddleware("general_user"))
+			{
+				consents.GET("/", api.GetConsents)
+				consents.POST("/", api.GrantConsent)
+				consents.DELETE("/:id", api.RevokeConsent)
+			}
+
+			// 病历附件 (外院报告、影像、知情同意书)，与病历相同的访问规则
+			attachments := medical_record.Group("/:id/attachments")
+			attachments.Use(middleware.RoleMiddleware("general_user", "doctor"))
+			{
+				attachments.GET("/", api.GetRecordAttachments)
+				attachments.POST("/", middleware.RoleMiddleware("doctor"), api.UploadRecordAttachment)
+				attachments.GET("/:aid/download", api.DownloadRecordAttachment)
+				attachments.DELETE("/:aid", middleware.RoleMiddleware("doctor"), api.DeleteRecordAttachment)
+			}
+
+			// 紧急访问 (必须填写理由)
+			medical_record.POST("/break_glass", middleware.RoleMiddleware("doctor"), api.BreakGlass)
+
+			// 访问日志审查
+			medical_record.GET("/access_logs", middleware.RoleMiddleware("org_admin", "global_admin"), api.GetRecordAccessLogs)
+		}
+
+		// [Group 5.1] 患者时间线 (/timeline)
+		// 合并挂号、诊断、处方、检验、订单、缴费；接诊医生与患者本人可见
+		timeline := dash.Group("/timeline")
+		timeline.Use(middleware.RoleMiddleware("general_user", "doctor"))
+		{
+			timeline.GET("/", api.GetPatientTimeline)
+		}
+
+		// [Group 5.2] 过敏史 (/allergies)
+		// 挂号员/医生登记，患者可查看自己的过敏史
+		allergies := dash.Group("/allergies")
+		{
+			allergies.GET("/", middleware.RoleMiddleware("general_user", "doctor", "registration", "org_admin", "global_admin"), api.GetAllergies)
+			allergies.POST("/", middleware.RoleMiddleware("doctor", "registration", "org_admin", "global_admin"), api.CreateAllergy)
+			allergies.DELETE("/:id", middleware.RoleMiddleware("doctor", "org_admin", "global_admin"), api.DeleteAllergy)
+		}
+
+		// [Group 5.3] 配伍禁忌规则 (/interactions)
+		// 医生/库管可查看，管理员从文件导入
+		interactions := dash.Group("/interactions")
+		{
+			interactions.GET("/", middleware.RoleMiddleware("doctor", "storekeeper", "org_admin", "global_admin"), api.GetInteractionRules)
+			interactions.POST("/import", middleware.RoleMiddleware("org_admin", "global_admin"), api.ImportInteractionRules)
 		}
 
 		// [Group 6] 物资/库房 (/storehouse)
@@ -146,10 +347,356 @@ func main() {
 		{
 			admin.GET("/", api.ManageUserStatus)
 			admin.POST("/", api.CreateUser)
+			admin.POST("/import", api.ImportUsers) // 批量导入 (csv / xlsx)
+			admin.GET("/export", api.ExportUsers)  // 批量导出
 			admin.PUT("/:id", api.UpdateUser)
 			admin.DELETE("/:id", api.DeleteUser)
+			admin.POST("/:id/password_reset", api.IssuePasswordReset) // 生成一次性重置凭证
+			admin.DELETE("/:id/mfa", api.ResetUserMFA)                // 重置两步验证
+			admin.PUT("/:id/enabled", api.SetUserEnabled)             // 启用 / 停用
+			admin.POST("/:id/restore", api.RestoreUser)               // 恢复已删除账号
+			admin.PUT("/:id/doctor_profile", api.UpdateDoctorProfile) // 医生执业信息
+		}
+
+		// [Group 7.1] 科室管理 (/departments)
+		// 权限: 所有登录用户可查看 (挂号、建号时选择科室)，仅管理员可维护，机构管理员只能管理本机构
+		depts := dash.Group("/departments")
+		{
+			deptAdmin := middleware.RoleMiddleware("org_admin", "global_admin")
+			depts.GET("/", api.GetDepartments)
+			depts.POST("/", deptAdmin, api.CreateDepartment)
+			depts.PUT("/:id", deptAdmin, api.UpdateDepartment)
+			depts.DELETE("/:id", deptAdmin, api.DeleteDepartment)
+			depts.POST("/:id/merge", deptAdmin, api.MergeDepartment) // 合并重复 / 拼写错误的科室
+		}
+
+		// [Group 7.2] 图片管理 (/media)
+		// 权限: 仅限管理员，维护首页医院图片和医生照片
+		mediaGroup := dash.Group("/media")
+		mediaGroup.Use(middleware.RoleMiddleware("org_admin", "global_admin"))
+		{
+			mediaGroup.GET("/", api.GetMediaList)
+			mediaGroup.POST("/", api.UploadMedia)
+			mediaGroup.PUT("/:id", api.UpdateMedia)
+			mediaGroup.DELETE("/:id", api.DeleteMedia)
+		}
+
+		// [Group 8] 审计日志 (/audit)
+		// 权限: 仅限管理员，机构管理员只能看本机构
+		auditGroup := dash.Group("/audit")
+		auditGroup.Use(middleware.RoleMiddleware("org_admin", "global_admin"))
+		{
+			auditGroup.GET("/", api.GetAuditLogs)
+			auditGroup.GET("/verify", middleware.RoleMiddleware("global_admin"), api.VerifyAuditLogs)
+		}
+
+		// [Group 8.1] 系统配置 (/config)
+		// 权限: 仅限全局管理员，查看生效配置、手动触发热加载
+		configGroup := dash.Group("/config")
+		configGroup.Use(middleware.RoleMiddleware("global_admin"))
+		{
+			configGroup.GET("/", api.GetConfigStatus)
+			configGroup.POST("/reload", api.ReloadConfig)
+		}
+
+		// [Group 8.2] 数据库备份 (/backups)
+		// 权限: 仅限全局管理员，查看最近备份状态、立即备份
+		backupGroup := dash.Group("/backups")
+		backupGroup.Use(middleware.RoleMiddleware("global_admin"))
+		{
+			backupGroup.GET("/", api.GetBackupStatus)
+			backupGroup.POST("/run", api.RunBackup)
+		}
+
+		// [Group 9] 患者数据导出、删除申请与保留期限 (/privacy)
+		// 患者导出本人数据、申请删除；前台可代为申请；全局管理员审批删除申请、管理保留期限
+		privacyGroup := dash.Group("/privacy")
+		{
+			privacyGroup.GET("/export", middleware.RoleMiddleware("general_user"), api.ExportMyData)
+
+			erasure := privacyGroup.Group("/erasure_requests")
+			erasure.Use(middleware.RoleMiddleware("general_user", "registration", "global_admin"))
+			{
+				erasure.GET("/", api.GetErasureRequests)
+				erasure.POST("/", api.CreateErasureRequest)
+				erasure.POST("/:id/approve", middleware.RoleMiddleware("global_admin"), api.ApproveErasureRequest)
+				erasure.POST("/:id/reject", middleware.RoleMiddleware("global_admin"), api.RejectErasureRequest)
+			}
+
+			retention := privacyGroup.Group("/retention")
+			retention.Use(middleware.RoleMiddleware("global_admin"))
+			{
+				retention.GET("/", api.GetRetentionStatus)
+				retention.POST("/run", api.RunRetention)
+			}
 		}
 	}
 
-	r.Run(":8080")
+	// 6. 启动服务，收到退出信号后等待进行中的请求和后台任务，再关闭数据库
+	serveErr := serve(ctx, r)
+	stopJobs()
+	jobs.Wait()
+	if err := database.Close(); err != nil {
+		logging.Errorf("关闭数据库失败: %v", err)
+	}
+	if serveErr != nil {
+		log.Fatalf("服务异常退出: %v", serveErr)
+	}
+	log.Println("已安全退出")
+}
+
+// mustValidateConfig 配置有问题时拒绝启动
+func mustValidateConfig() {
+	if err := config.Get().Validate(); err != nil {
+		log.Fatalf("配置无效，拒绝启动:\n%v", err)
+	}
+}
+
+// runCommand 执行命令行子命令 (不启动 HTTP 服务)
+func runCommand(args []string) {
+	if args[0] != "config" {
+		mustValidateConfig()
+	}
+
+	switch args[0] {
+	case "config":
+		// ./server config print  打印生效的配置 (密钥已隐藏)，并报告校验问题
+		if len(args) < 2 || args[1] != "print" {
+			log.Fatalf("用法: %s [-config 文件] config print", os.Args[0])
+		}
+		if err := config.Get().Print(os.Stdout); err != nil {
+			log.Fatalf("输出配置失败: %v", err)
+		}
+		if err := config.Get().Validate(); err != nil {
+			log.Fatalf("配置无效:\n%v", err)
+		}
+
+	case "audit":
+		// ./server audit verify  校验审计日志哈希链
+		if len(args) < 2 || args[1] != "verify" {
+			log.Fatalf("用法: %s audit verify", os.Args[0])
+		}
+		loadFieldKeys()
+		database.InitDB(dbConfig(), config.Get().Database.AutoMigrate)
+		result, err := audit.Verify(database.DB)
+		if err != nil {
+			log.Fatalf("校验失败: %v", err)
+		}
+		if !result.Valid {
+			log.Fatalf("审计日志已被篡改: 第 %d 条记录 %s (已校验 %d 条)", result.BrokenID, result.Reason, result.Checked)
+		}
+		log.Printf("审计日志完整，共校验 %d 条记录", result.Checked)
+
+	case "keys":
+		runKeysCommand(args[1:])
+
+	case "migrate":
+		runMigrateCommand(args[1:])
+
+	case "backup":
+		runBackupCommand(args[1:])
+
+	case "encryption":
+		runEncryptionCommand(args[1:])
+
+	case "restore":
+		runRestoreCommand(args[1:])
+
+	case "retention":
+		runRetentionCommand(args[1:])
+
+	default:
+		log.Fatalf("未知命令: %s", args[0])
+	}
+}
+
+// initStorage 初始化上传文件存储
+func initStorage() {
+	sc := config.Get().Storage
+	if err := storage.Init(storage.Config{
+		Driver:   sc.Driver,
+		LocalDir: sc.LocalDir,
+		S3:       storage.S3Config(sc.S3),
+	}); err != nil {
+		log.Fatalf("初始化文件存储失败: %v", err)
+	}
+}
+
+// loadSigningKeys 加载 JWT 签名密钥，首次启动密钥目录为空时自动生成一把
+func loadSigningKeys() *signing.KeySet {
+	cfg := config.Get().Auth.Keys
+	set, err := signing.Load(cfg.Dir, cfg.ActiveKID)
+	if errors.Is(err, signing.ErrNoKeys) && cfg.ActiveKID == "" {
+		kid, genErr := signing.Generate(cfg.Dir, keyAlgorithm())
+		if genErr != nil {
+			log.Fatalf("生成签名密钥失败: %v", genErr)
+		}
+		log.Printf("密钥目录 %s 为空，已生成签名密钥 %s", cfg.Dir, kid)
+		set, err = signing.Load(cfg.Dir, "")
+	}
+	if err != nil {
+		log.Fatalf("加载签名密钥失败: %v", err)
+	}
+	log.Printf("JWT 签名密钥: %s (%s)，共 %d 把校验密钥", set.Active().KID, set.Active().Alg, len(set.KIDs()))
+	return set
+}
+
+func keyAlgorithm() string {
+	if alg := config.Get().Auth.Keys.Algorithm; alg != "" {
+		return alg
+	}
+	return signing.AlgEdDSA
+}
+
+// runKeysCommand 密钥管理
+//
+//	./server keys generate [RS256|EdDSA]  生成新密钥 (重启后生效)
+//	./server keys list                    列出全部密钥
+//	./server keys retire <kid>            只保留公钥，不再用于签发
+func runKeysCommand(args []string) {
+	dir := config.Get().Auth.Keys.Dir
+	usage := fmt.Sprintf("用法: %s keys generate [RS256|EdDSA] | list | retire <kid>", os.Args[0])
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+
+	switch args[0] {
+	case "generate":
+		alg := keyAlgorithm()
+		if len(args) > 1 {
+			alg = args[1]
+		}
+		kid, err := signing.Generate(dir, alg)
+		if err != nil {
+			log.Fatalf("生成密钥失败: %v", err)
+		}
+		log.Printf("已生成密钥 %s (%s)，重启服务后生效", kid, alg)
+
+	case "list":
+		set, err := signing.Load(dir, config.Get().Auth.Keys.ActiveKID)
+		if err != nil {
+			log.Fatalf("加载密钥失败: %v", err)
+		}
+		for _, kid := range set.KIDs() {
+			key, _ := set.Get(kid)
+			status := "仅校验"
+			if key.PrivateKey != nil {
+				status = "可签发"
+			}
+			if kid == set.Active().KID {
+				status = "签发中"
+			}
+			fmt.Printf("%s\t%s\t%s\n", kid, key.Alg, status)
+		}
+
+	case "retire":
+		if len(args) < 2 {
+			log.Fatal(usage)
+		}
+		if err := signing.Retire(dir, args[1]); err != nil {
+			log.Fatalf("停用密钥失败: %v", err)
+		}
+		log.Printf("密钥 %s 已停用，仅保留公钥用于校验旧 Token", args[1])
+
+	default:
+		log.Fatal(usage)
+	}
+}
+
+// dbConfig 数据库连接配置
+func dbConfig() database.Config {
+	dc := config.Get().Database
+	return database.Config{
+		Driver:          dc.Driver,
+		Path:            dc.Path,
+		DSN:             dc.DSN,
+		MaxOpenConns:    dc.MaxOpenConns,
+		MaxIdleConns:    dc.MaxIdleConns,
+		ConnMaxLifetime: time.Duration(dc.ConnMaxLifetimeMinutes) * time.Minute,
+	}
+}
+
+// runMigrateCommand 数据库迁移
+//
+//	./server migrate status     查看各迁移的执行状态
+//	./server migrate up [N]     执行未执行的迁移 (默认全部)
+//	./server migrate down [N]   回滚最近的 N 个迁移 (默认 1 个，基线不能回滚)
+func runMigrateCommand(args []string) {
+	usage := fmt.Sprintf("用法: %s migrate status | up [N] | down [N]", os.Args[0])
+	if len(args) == 0 {
+		log.Fatal(usage)
+	}
+	steps := 0
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			log.Fatal(usage)
+		}
+		steps = n
+	}
+
+	db, err := database.Open(dbConfig())
+	if err != nil {
+		log.Fatalf("无法连接数据库: %v", err)
+	}
+	database.DB = db
+	defer database.Close()
+
+	switch args[0] {
+	case "status":
+		list, unknown, err := database.Status(db)
+		if err != nil {
+			log.Fatalf("读取迁移状态失败: %v", err)
+		}
+		for _, m := range list {
+			status := "未执行"
+			if m.Applied {
+				status = "已执行 " + m.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if m.Modified {
+				status += " (执行后文件被修改过)"
+			}
+			fmt.Printf("%04d\t%s\t%s\n", m.Version, m.Name, status)
+		}
+		for _, m := range unknown {
+			fmt.Printf("%04d\t%s\t程序中不存在 (数据库比程序新)\n", m.Version, m.Name)
+		}
+
+	case "up":
+		done, err := database.MigrateUp(db, steps)
+		if err != nil {
+			log.Fatalf("迁移失败: %v", err)
+		}
+		log.Printf("执行了 %d 个迁移", len(done))
+
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		// 回滚基线等于删除全部数据，不提供命令，需要时直接删除数据库文件
+		list, _, err := database.Status(db)
+		if err != nil {
+			log.Fatalf("读取迁移状态失败: %v", err)
+		}
+		applied := 0
+		for _, m := range list {
+			if m.Applied {
+				applied++
+			}
+		}
+		if applied <= 1 {
+			log.Fatal("没有可以回滚的迁移 (基线迁移不能回滚)")
+		}
+		if steps >= applied {
+			log.Fatalf("最多只能回滚 %d 个迁移 (基线迁移不能回滚)", applied-1)
+		}
+		done, err := database.MigrateDown(db, steps)
+		if err != nil {
+			log.Fatalf("回滚失败: %v", err)
+		}
+		log.Printf("回滚了 %d 个迁移", len(done))
+
+	default:
+		log.Fatal(usage)
+	}
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/privacy"
+)
+
+// runRetentionCommand 按保留期限匿名化、清理到期数据 (服务运行中也可以执行)
+//
+//	./server retention preview  按当前配置统计到期的数据，不做任何修改
+//	./server retention run      立即执行一遍 (匿名化后无法恢复，建议先备份)
+func runRetentionCommand(args []string) {
+	usage := fmt.Sprintf("用法: %s retention preview | run", os.Args[0])
+	if len(args) != 1 || (args[0] != "preview" && args[0] != "run") {
+		log.Fatal(usage)
+	}
+
+	loadFieldKeys()
+	initStorage()
+	database.InitDB(dbConfig(), config.Get().Database.AutoMigrate)
+	defer database.Close()
+
+	var counts privacy.Counts
+	if args[0] == "preview" {
+		var err error
+		if counts, err = privacy.Preview(database.DB); err != nil {
+			log.Fatalf("统计失败: %v", err)
+		}
+		fmt.Println("到期的数据:")
+	} else {
+		result, err := privacy.Run(context.Background(), database.DB, privacy.TriggerCommand)
+		if err != nil {
+			log.Fatalf("清理失败 (已处理的部分不会回滚，可以重复执行): %v", err)
+		}
+		counts = result.Counts
+		fmt.Println("已处理:")
+	}
+	if len(counts) == 0 {
+		fmt.Println("(无)")
+	}
+	for _, table := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Printf("%s\t%d 行\n", table, counts[table])
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"hospital-system/config"
+	"hospital-system/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- HTTP 服务与优雅退出 ---
+// 收到 SIGTERM / Ctrl+C 后：/ready 返回 503 -> (可选) 等待负载均衡摘除 -> 停止接收新连接
+// -> 等待进行中的请求处理完 (有上限) -> 由调用方关闭数据库
+
+// 读取请求头的超时，防止慢速攻击占住连接
+const readHeaderTimeout = 10 * time.Second
+
+// ready 服务是否可以接收流量 (启动完成前和退出过程中为 false)
+var ready atomic.Bool
+
+// readyHandler 就绪检查，/ping 只说明进程还活着
+func readyHandler(c *gin.Context) {
+	if !ready.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready"})
+}
+
+// serve 启动 HTTP(S) 服务，ctx 结束时优雅退出
+func serve(ctx context.Context, handler http.Handler) error {
+	cfg := config.Get().Server
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(cfg.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeoutSeconds) * time.Second,
+	}
+
+	// 1. 可选 HTTPS
+	useTLS := cfg.TLS.CertFile != ""
+	if useTLS {
+		certs, err := newCertReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+		go certs.watchSignal(ctx)
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}
+	}
+
+	// 2. 先绑定端口 (端口被占用等错误在这里直接返回)，成功后才报告就绪
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", srv.Addr, err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		if useTLS {
+			errCh <- srv.ServeTLS(ln, "", "")
+		} else {
+			errCh <- srv.Serve(ln)
+		}
+	}()
+	ready.Store(true)
+	log.Printf("服务已启动，监听 %s (HTTPS: %v)", srv.Addr, useTLS)
+
+	select {
+	case err := <-errCh:
+		ready.Store(false)
+		return err
+	case <-ctx.Done():
+	}
+
+	// 3. 先报告未就绪，给负载均衡留出摘除时间
+	ready.Store(false)
+	cfg = config.Get().Server
+	log.Println("收到退出信号，开始停止服务...")
+	if cfg.ShutdownDelaySeconds > 0 {
+		time.Sleep(time.Duration(cfg.ShutdownDelaySeconds) * time.Second)
+	}
+
+	// 4. 停止接收新连接，等待进行中的请求
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logging.Warnf("等待请求处理超时，强制关闭剩余连接: %v", err)
+		srv.Close()
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Println("HTTP 服务已停止")
+	return nil
+}
+
+// --- 证书热加载 ---
+// 证书续期 (例如 certbot) 后无需重启：握手时发现文件有变化或收到 SIGHUP 就重新读取
+// 新证书读取失败时继续使用旧证书
+
+// 握手时检查证书文件的最短间隔
+const certCheckInterval = 30 * time.Second
+
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	stamp   string
+	checked time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, fmt.Errorf("加载 TLS 证书失败: %w", err)
+	}
+	return r, nil
+}
+
+// reload 文件有变化时重新读取证书 (调用方持有锁或处于初始化阶段)
+func (r *certReloader) reload() error {
+	stamp := fileStamp(r.certFile) + "|" + fileStamp(r.keyFile)
+	if r.cert != nil && stamp == r.stamp {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert, r.stamp = &cert, stamp
+	if cert.Leaf != nil {
+		log.Printf("已加载 TLS 证书 %s，有效期至 %s", r.certFile, cert.Leaf.NotAfter.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// GetCertificate 供 tls.Config 使用
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checked) >= certCheckInterval {
+		r.checked = time.Now()
+		if err := r.reload(); err != nil {
+			logging.Warnf("重新加载 TLS 证书失败，继续使用旧证书: %v", err)
+		}
+	}
+	return r.cert, nil
+}
+
+// watchSignal 收到 SIGHUP 时立即检查证书
+func (r *certReloader) watchSignal(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.mu.Lock()
+			r.checked = time.Now()
+			if err := r.reload(); err != nil {
+				logging.Warnf("重新加载 TLS 证书失败，继续使用旧证书: %v", err)
+			}
+			r.mu.Unlock()
+		}
+	}
+}
+
+// fileStamp 文件的修改时间和大小，读取失败时为空字符串
+func fileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
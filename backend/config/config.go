@@ -1,43 +1,317 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"strings"
+	"sync/atomic"
+
+	"hospital-system/internal/logging"
 
 	"gopkg.in/yaml.v3"
 )
 
+// --- 配置加载 ---
+// 按以下顺序逐层覆盖，后面的优先：
+//   1. 代码中的默认值 (Default)
+//   2. 配置文件 (-config 参数或环境变量 HOSPITAL_CONFIG 指定，默认 ./config.yaml，不存在时跳过)
+//   3. 环境变量 HOSPITAL_<配置路径>，例如 HOSPITAL_SERVER_PORT、HOSPITAL_AUTH_OIDC_CLIENT_SECRET
+//   4. 命令行参数 -port、-set auth.lockout.max_attempts=10
+// 标记了 secret:"true" 的字段是密钥，建议只通过环境变量提供，打印配置时会被隐藏
+// 标记了 restart:"true" 的字段在启动时使用一次，运行中修改需要重启 (热加载时拒绝，见 reload.go)
+
 // Config 对应 config.yaml 的结构
 type Config struct {
 	Server struct {
-		Port int `yaml:"port"`
+		Port         int `yaml:"port" restart:"true"`
+		FrontendPort int `yaml:"frontend_port"` // 前端开发服务器端口，仅作记录
+
+		// 超时 (秒)
+		ReadTimeoutSeconds     int `yaml:"read_timeout_seconds" restart:"true"`  // 读取整个请求 (含上传文件)
+		WriteTimeoutSeconds    int `yaml:"write_timeout_seconds" restart:"true"` // 写完整个响应 (含下载附件)
+		IdleTimeoutSeconds     int `yaml:"idle_timeout_seconds" restart:"true"`  // keep-alive 空闲连接
+		ShutdownTimeoutSeconds int `yaml:"shutdown_timeout_seconds"`             // 退出时等待进行中请求的最长时间
+		ShutdownDelaySeconds   int `yaml:"shutdown_delay_seconds"`               // 退出时先报告未就绪，等负载均衡摘除后再停止接收请求
+
+		// HTTPS (证书文件更新后自动重新加载，无需重启)
+		TLS struct {
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+		} `yaml:"tls" restart:"true"`
 	} `yaml:"server"`
 
+	// 日志 (热加载后立即生效)
+	Log struct {
+		Level string `yaml:"level"` // debug / info / warn / error
+	} `yaml:"log"`
+
 	Database struct {
-		Path string `yaml:"path"`
-	} `yaml:"database"`
+		Driver      string `yaml:"driver"`            // sqlite (默认) / postgres
+		Path        string `yaml:"path"`              // SQLite 数据库文件
+		DSN         string `yaml:"dsn" secret:"true"` // PostgreSQL 连接串 (含密码，建议通过环境变量提供)
+		AutoMigrate bool   `yaml:"auto_migrate"`      // 启动时自动执行未执行的迁移；关闭后需手动 ./server migrate up
+
+		// 连接池
+		MaxOpenConns           int `yaml:"max_open_conns"`            // 最大连接数，0 表示不限制
+		MaxIdleConns           int `yaml:"max_idle_conns"`            // 最大空闲连接数
+		ConnMaxLifetimeMinutes int `yaml:"conn_max_lifetime_minutes"` // 连接最长使用时间，0 表示不限制
+	} `yaml:"database" restart:"true"`
 
 	Auth struct {
-		JwtSecret      string `yaml:"jwt_secret"`
-		JwtExpireHours int    `yaml:"jwt_expire_hours"`
+		JwtExpireHours int `yaml:"jwt_expire_hours"`
+
+		// 已弃用：Token 改为非对称签名 (见 keys)，保留此项只为旧配置文件还能加载，设置了也不会使用
+		JwtSecret string `yaml:"jwt_secret" secret:"true"`
+
+		// JWT 签名密钥 (RS256 / EdDSA)
+		Keys struct {
+			Dir       string `yaml:"dir"`        // 密钥目录，每个 <kid>.pem 一把密钥
+			ActiveKID string `yaml:"active_kid"` // 签发用的密钥，留空则用最新生成的
+			Algorithm string `yaml:"algorithm"`  // 自动生成密钥时使用的算法: RS256 / EdDSA
+		} `yaml:"keys" restart:"true"`
+
+		// 密码复杂度与历史
+		Password struct {
+			MinLength     int  `yaml:"min_length"`
+			RequireUpper  bool `yaml:"require_upper"`
+			RequireLower  bool `yaml:"require_lower"`
+			RequireDigit  bool `yaml:"require_digit"`
+			RequireSymbol bool `yaml:"require_symbol"`
+			HistorySize   int  `yaml:"history_size"` // 不能与最近 N 次密码相同
+		} `yaml:"password"`
+
+		// 登录失败锁定
+		Lockout struct {
+			MaxAttempts     int `yaml:"max_attempts"`     // 连续失败多少次后锁定
+			CooldownMinutes int `yaml:"cooldown_minutes"` // 锁定时长
+		} `yaml:"lockout"`
+
+		// 两步验证 (TOTP)
+		MFA struct {
+			Issuer        string   `yaml:"issuer"`         // 验证器 App 里显示的名称
+			EnforcedRoles []string `yaml:"enforced_roles"` // 这些角色必须开启两步验证
+		} `yaml:"mfa"`
+
+		// 员工统一身份认证 (OpenID Connect)
+		OIDC struct {
+			Enabled          bool     `yaml:"enabled"`
+			Issuer           string   `yaml:"issuer" restart:"true"`
+			ClientID         string   `yaml:"client_id" restart:"true"`
+			ClientSecret     string   `yaml:"client_secret" secret:"true" restart:"true"`
+			RedirectURL      string   `yaml:"redirect_url" restart:"true"` // 本系统的回调地址: .../api/v1/oidc/callback
+			Scopes           []string `yaml:"scopes" restart:"true"`       // 默认 openid profile email
+			GroupsClaim      string   `yaml:"groups_claim"`                // id_token 中用户组字段，默认 groups
+			FrontendRedirect string   `yaml:"frontend_redirect"`           // 登录成功后带着 Token 跳回前端的地址，留空则直接返回 JSON
+			OrgID            uint     `yaml:"org_id"`                      // 新建账号所属机构
+
+			// 用户组 -> 角色 / 科室，按顺序匹配，第一个命中的生效
+			RoleMappings []struct {
+				Group string `yaml:"group"`
+				Role  string `yaml:"role"`
+			} `yaml:"role_mappings"`
+			DepartmentMappings []struct {
+				Group      string `yaml:"group"`
+				Department string `yaml:"department"`
+			} `yaml:"department_mappings"`
+		} `yaml:"oidc"`
 	} `yaml:"auth"`
+
+	// 短信 (注册验证码等)
+	SMS struct {
+		Provider string `yaml:"provider"` // log: 只打印到日志 (本地开发)
+	} `yaml:"sms" restart:"true"`
+
+	// 上传文件存储 (医院图片、医生照片、病历附件)
+	Storage struct {
+		Driver   string `yaml:"driver" restart:"true"`    // local (默认) / s3
+		LocalDir string `yaml:"local_dir" restart:"true"` // 本地存储目录
+		S3       struct {
+			Endpoint  string `yaml:"endpoint"`
+			Region    string `yaml:"region"`
+			Bucket    string `yaml:"bucket"`
+			AccessKey string `yaml:"access_key"`
+			SecretKey string `yaml:"secret_key" secret:"true"`
+			PathStyle bool   `yaml:"path_style"` // MinIO 等需要 true
+			Prefix    string `yaml:"prefix"`
+		} `yaml:"s3" restart:"true"`
+		MaxImageMB int    `yaml:"max_image_mb"`           // 图片大小上限，默认 5
+		MaxFileMB  int    `yaml:"max_file_mb"`            // 其他附件 (PDF) 大小上限，默认 20
+		Scanner    string `yaml:"scanner" restart:"true"` // 上传文件安全扫描: none (默认，不扫描)
+	} `yaml:"storage"`
+
+	// 敏感字段加密 (身份证号、手机号、诊断)
+	Encryption struct {
+		KeysDir        string   `yaml:"keys_dir" restart:"true"`       // 密钥目录，每个 v<版本>.key 一把数据密钥，另有 blind-index.key
+		ActiveVersion  int      `yaml:"active_version" restart:"true"` // 加密新数据用的版本，0 表示最新
+		FullValueRoles []string `yaml:"full_value_roles"`              // 能看到完整身份证号、手机号的角色，其他角色看到脱敏后的值
+	} `yaml:"encryption"`
+
+	// 数据库备份 (仅 SQLite，PostgreSQL 使用 pg_dump)
+	Backup struct {
+		Dir           string `yaml:"dir"`                          // 备份目录，建议放在另一块磁盘或挂载的网络存储上
+		IntervalHours int    `yaml:"interval_hours"`               // 自动备份间隔 (小时)，0 表示关闭
+		Keep          int    `yaml:"keep"`                         // 保留最近几份
+		EncryptionKey string `yaml:"encryption_key" secret:"true"` // 非空时备份文件用 AES-256-GCM 加密，恢复时需要同一个密钥
+	} `yaml:"backup"`
+
+	// 数据保留期限 (天，0 表示永久保留)，到期的数据由定时任务匿名化或删除
+	Retention struct {
+		IntervalHours         int `yaml:"interval_hours"`          // 检查间隔 (小时)，0 表示关闭定时任务
+		VisitDays             int `yaml:"visit_days"`              // 挂号及其病历、检验、附件：就诊后保留多久，之后匿名化
+		InactivePatientDays   int `yaml:"inactive_patient_days"`   // 没有绑定账号的患者档案：最后一次就诊后保留多久，之后匿名化
+		AccessLogDays         int `yaml:"access_log_days"`         // 病历访问日志，到期删除
+		PhoneVerificationDays int `yaml:"phone_verification_days"` // 短信验证码记录，到期删除
+	} `yaml:"retention"`
 }
 
-var AppConfig *Config
+// current 当前生效的配置，热加载时整体替换
+var current atomic.Pointer[Config]
 
-// LoadConfig 读取配置文件
-// configPath: 相对路径，例如 "../config.yaml"
-func LoadConfig(configPath string) error {
-	file, err := os.ReadFile(configPath)
-	if err != nil {
-		return err
+// Get 当前生效的配置 (只读，不要修改返回的内容)
+func Get() *Config {
+	return current.Load()
+}
+
+// Default 默认配置，与仓库中的 config.yaml 一致
+func Default() *Config {
+	cfg := &Config{}
+	cfg.Server.Port = 8080
+	cfg.Server.ReadTimeoutSeconds = 30
+	cfg.Server.WriteTimeoutSeconds = 120
+	cfg.Server.IdleTimeoutSeconds = 120
+	cfg.Server.ShutdownTimeoutSeconds = 30
+	cfg.Log.Level = "info"
+	cfg.Database.Driver = "sqlite"
+	cfg.Database.Path = "./storage/db/hospital.db"
+	cfg.Database.AutoMigrate = true
+	cfg.Database.MaxOpenConns = 25
+	cfg.Database.MaxIdleConns = 5
+	cfg.Database.ConnMaxLifetimeMinutes = 30
+
+	cfg.Auth.JwtExpireHours = 24
+	cfg.Auth.Keys.Dir = "./storage/keys"
+	cfg.Auth.Keys.Algorithm = "EdDSA"
+	cfg.Auth.Password.MinLength = 8
+	cfg.Auth.Password.RequireLower = true
+	cfg.Auth.Password.RequireDigit = true
+	cfg.Auth.Password.HistorySize = 5
+	cfg.Auth.Lockout.MaxAttempts = 5
+	cfg.Auth.Lockout.CooldownMinutes = 15
+	cfg.Auth.MFA.Issuer = "Hospital System"
+	cfg.Auth.MFA.EnforcedRoles = []string{"finance", "org_admin", "global_admin"}
+	cfg.Auth.OIDC.Scopes = []string{"openid", "profile", "email"}
+	cfg.Auth.OIDC.GroupsClaim = "groups"
+	cfg.Auth.OIDC.OrgID = 1
+
+	cfg.SMS.Provider = "log"
+
+	cfg.Storage.Driver = "local"
+	cfg.Storage.LocalDir = "./storage/uploads"
+	cfg.Storage.S3.Region = "us-east-1"
+	cfg.Storage.S3.PathStyle = true
+	cfg.Storage.MaxImageMB = 5
+	cfg.Storage.MaxFileMB = 20
+	cfg.Storage.Scanner = "none"
+
+	cfg.Encryption.KeysDir = "./storage/field-keys"
+	cfg.Encryption.FullValueRoles = []string{"registration"}
+
+	cfg.Backup.Dir = "./storage/backups"
+	cfg.Backup.IntervalHours = 24
+	cfg.Backup.Keep = 7
+
+	cfg.Retention.IntervalHours = 24
+	cfg.Retention.VisitDays = 15 * 365
+	cfg.Retention.InactivePatientDays = 15 * 365
+	cfg.Retention.AccessLogDays = 6 * 365
+	cfg.Retention.PhoneVerificationDays = 30
+	return cfg
+}
+
+// LoadedFile 实际读取的配置文件，为空表示没有找到配置文件 (只用了默认值和环境变量)
+var LoadedFile string
+
+// 启动时的加载参数，热加载时按同样的方式重新读取
+var (
+	sourcePath     string
+	sourceExplicit bool
+	sourceOverride []string
+)
+
+// LoadConfig 加载配置并设为当前配置 (不做校验，启动前请调用 Validate)
+// configPath: 为空时依次尝试环境变量 HOSPITAL_CONFIG 和 ./config.yaml
+// overrides: 命令行覆盖的配置项，格式 "auth.lockout.max_attempts=10"
+func LoadConfig(configPath string, overrides ...string) error {
+	if configPath == "" {
+		configPath = os.Getenv("HOSPITAL_CONFIG")
+	}
+	sourceExplicit = configPath != ""
+	if !sourceExplicit {
+		configPath = "./config.yaml"
 	}
+	sourcePath = configPath
+	sourceOverride = overrides
 
-	config := &Config{}
-	err = yaml.Unmarshal(file, config)
+	cfg, file, err := load()
 	if err != nil {
 		return err
 	}
-
-	AppConfig = config
+	if cfg.Auth.JwtSecret != "" {
+		logging.Warnf("auth.jwt_secret 已弃用且不再使用 (Token 改用 auth.keys 下的密钥签名)，请从配置文件和环境变量中删除")
+	}
+	LoadedFile = file
+	current.Store(cfg)
 	return nil
 }
+
+// load 按启动参数读取一份完整配置，返回配置和实际读取的文件
+func load() (*Config, string, error) {
+	cfg := Default()
+
+	// 1. 配置文件 (明确指定的文件必须存在)
+	loaded := ""
+	file, err := os.Open(sourcePath)
+	switch {
+	case err == nil:
+		defer file.Close()
+		dec := yaml.NewDecoder(file)
+		dec.KnownFields(true) // 写错的配置项直接报错，而不是被悄悄忽略
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, "", fmt.Errorf("解析配置文件 %s 失败: %w", sourcePath, tidyYAMLError(err))
+		}
+		loaded = sourcePath
+	case errors.Is(err, fs.ErrNotExist) && !sourceExplicit:
+	default:
+		return nil, "", err
+	}
+
+	// 2. 环境变量
+	if err := applyEnv(cfg); err != nil {
+		return nil, "", err
+	}
+
+	// 3. 命令行
+	for _, o := range sourceOverride {
+		if err := cfg.Set(o); err != nil {
+			return nil, "", err
+		}
+	}
+	return cfg, loaded, nil
+}
+
+// tidyYAMLError 去掉错误信息里冗长的匿名结构体类型，只保留行号和字段名
+func tidyYAMLError(err error) error {
+	var te *yaml.TypeError
+	if !errors.As(err, &te) {
+		return err
+	}
+	msgs := make([]string, len(te.Errors))
+	for i, m := range te.Errors {
+		m, _, _ = strings.Cut(m, " in type ")
+		msgs[i] = m
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
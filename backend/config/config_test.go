@@ -0,0 +1,29 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 旧配置文件里的 auth.jwt_secret 已弃用但仍能加载；其他写错的配置项照样报错
+func TestLoadConfigAcceptsDeprecatedJwtSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("auth:\n  jwt_secret: old-hmac-secret\n  jwt_expire_hours: 8\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(path); err != nil {
+		t.Fatalf("含 jwt_secret 的旧配置应能加载: %v", err)
+	}
+	if Get().Auth.JwtExpireHours != 8 {
+		t.Errorf("jwt_expire_hours = %d, 期望 8", Get().Auth.JwtExpireHours)
+	}
+
+	if err := os.WriteFile(path, []byte("auth:\n  jwt_secrte: typo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "jwt_secrte") {
+		t.Fatalf("写错的配置项应报错: %v", err)
+	}
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- 环境变量 / 命令行覆盖与脱敏打印 ---
+// 配置项的路径由 yaml 标签拼成：auth.oidc.client_secret 对应环境变量 HOSPITAL_AUTH_OIDC_CLIENT_SECRET
+// 只支持字符串、数字、布尔和字符串列表 (逗号分隔)，role_mappings 这类结构列表只能写在配置文件里
+
+const envPrefix = "HOSPITAL_"
+
+// 打印时代替密钥的内容
+const redacted = "******"
+
+// field 一个可覆盖的配置项
+type field struct {
+	path    string // 例如 auth.oidc.client_secret
+	value   reflect.Value
+	secret  bool
+	restart bool // 修改后需要重启才能生效
+}
+
+// fields 列出所有叶子配置项
+func (c *Config) fields() []field {
+	var list []field
+	var walk func(v reflect.Value, prefix string, restart bool)
+	walk = func(v reflect.Value, prefix string, restart bool) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			if prefix != "" {
+				name = prefix + "." + name
+			}
+			r := restart || sf.Tag.Get("restart") == "true"
+			if sf.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), name, r)
+				continue
+			}
+			list = append(list, field{path: name, value: v.Field(i), secret: sf.Tag.Get("secret") == "true", restart: r})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "", false)
+	return list
+}
+
+// envName 配置项对应的环境变量名
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// applyEnv 用环境变量覆盖配置
+func applyEnv(c *Config) error {
+	for _, f := range c.fields() {
+		raw, ok := os.LookupEnv(envName(f.path))
+		if !ok || !settable(f.value) {
+			continue
+		}
+		if err := setValue(f.value, raw); err != nil {
+			return fmt.Errorf("环境变量 %s: %w", envName(f.path), err)
+		}
+	}
+	return nil
+}
+
+// Set 按 "路径=值" 覆盖一个配置项，例如 "server.port=9090"
+func (c *Config) Set(assignment string) error {
+	path, raw, ok := strings.Cut(assignment, "=")
+	if !ok {
+		return fmt.Errorf("配置覆盖格式应为 路径=值: %s", assignment)
+	}
+	path = strings.TrimSpace(path)
+	for _, f := range c.fields() {
+		if f.path != path {
+			continue
+		}
+		if !settable(f.value) {
+			return fmt.Errorf("配置项 %s 只能在配置文件中设置", path)
+		}
+		if err := setValue(f.value, raw); err != nil {
+			return fmt.Errorf("配置项 %s: %w", path, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("未知配置项: %s", path)
+}
+
+func settable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return v.Type().Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setValue(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("不是有效的布尔值: %q", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("不是有效的整数: %q", raw)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("不是有效的非负整数: %q", raw)
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		items := []string{}
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				items = append(items, s)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("不支持的类型 %s", v.Type())
+	}
+	return nil
+}
+
+// Redacted 返回隐藏了密钥的副本 (用于打印和日志)
+func (c *Config) Redacted() *Config {
+	cp := *c
+	for _, f := range cp.fields() {
+		if f.secret && f.value.Kind() == reflect.String && f.value.String() != "" {
+			f.value.SetString(redacted)
+		}
+	}
+	return &cp
+}
+
+// Print 以 YAML 格式输出生效的配置 (密钥已隐藏)
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"hospital-system/internal/logging"
+)
+
+// --- 配置热加载 ---
+// 配置文件有变化 (每隔几秒检查一次修改时间) 或收到 SIGHUP 时重新读取并校验，
+// 通过后整体替换当前配置，正在处理的请求继续使用旧配置，不需要重启
+// 如果修改了 restart:"true" 的配置项 (端口、数据库、签名密钥、存储等)，整次加载被拒绝，当前配置保持不变
+
+// 检查配置文件的间隔
+const watchInterval = 5 * time.Second
+
+// 热加载来源
+const (
+	TriggerFile   = "file"
+	TriggerSignal = "signal"
+	TriggerAPI    = "api"
+)
+
+// ReloadResult 一次热加载的结果
+type ReloadResult struct {
+	Time     time.Time `json:"time"`
+	Trigger  string    `json:"trigger"`
+	Success  bool      `json:"success"`
+	Changed  []string  `json:"changed"`  // 已生效的配置项
+	Rejected []string  `json:"rejected"` // 需要重启才能修改的配置项
+	Error    string    `json:"error,omitempty"`
+}
+
+var (
+	reloadMu   sync.Mutex
+	lastReload *ReloadResult
+)
+
+// LastReload 最近一次热加载的结果，还没有发生过时返回 nil
+func LastReload() *ReloadResult {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if lastReload == nil {
+		return nil
+	}
+	r := *lastReload
+	return &r
+}
+
+// Reload 重新加载配置
+func Reload(trigger string) ReloadResult {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	result := ReloadResult{Time: time.Now(), Trigger: trigger, Changed: []string{}, Rejected: []string{}}
+	defer func() {
+		lastReload = &result
+		if result.Success {
+			log.Printf("配置热加载 (%s) 成功，变更: %s", trigger, joinOrNone(result.Changed))
+		} else {
+			logging.Warnf("配置热加载 (%s) 失败，保持当前配置: %s", trigger, result.Error)
+		}
+	}()
+
+	// 1. 读取并校验
+	next, _, err := load()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if err := next.Validate(); err != nil {
+		result.Error = strings.ReplaceAll(err.Error(), "\n", "; ")
+		return result
+	}
+
+	// 2. 比较差异，需要重启的配置项不允许热加载
+	result.Changed, result.Rejected = diff(Get(), next)
+	if len(result.Rejected) > 0 {
+		result.Changed = []string{}
+		result.Error = "以下配置项需要重启才能生效: " + strings.Join(result.Rejected, ", ")
+		return result
+	}
+
+	// 3. 整体替换；日志级别不是每次读取配置，需要单独应用
+	current.Store(next)
+	logging.SetLevel(next.Log.Level)
+	result.Success = true
+	return result
+}
+
+// diff 比较两份配置，返回可以热加载的变更和需要重启的变更
+func diff(old, next *Config) (changed, rejected []string) {
+	changed, rejected = []string{}, []string{}
+	oldFields := old.fields()
+	for i, f := range next.fields() {
+		if reflect.DeepEqual(oldFields[i].value.Interface(), f.value.Interface()) {
+			continue
+		}
+		if f.restart {
+			rejected = append(rejected, f.path)
+		} else {
+			changed = append(changed, f.path)
+		}
+	}
+	return changed, rejected
+}
+
+func joinOrNone(list []string) string {
+	if len(list) == 0 {
+		return "无"
+	}
+	return strings.Join(list, ", ")
+}
+
+// Watch 监视配置文件和 SIGHUP 信号，直到 ctx 结束
+func Watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	last := fileStamp(sourcePath)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			last = fileStamp(sourcePath)
+			Reload(TriggerSignal)
+		case <-ticker.C:
+			// 文件被修改、新建或删除都触发一次
+			if stamp := fileStamp(sourcePath); stamp != last {
+				last = stamp
+				Reload(TriggerFile)
+			}
+		}
+	}
+}
+
+// fileStamp 文件的修改时间和大小，文件不存在时为空字符串
+func fileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
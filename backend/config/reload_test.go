@@ -0,0 +1,49 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"hospital-system/internal/logging"
+)
+
+// 修改 log.level 后热加载，不需要重启，新级别立即生效
+func TestReloadAppliesLogLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("log:\n  level: info\n")
+	if err := LoadConfig(path); err != nil {
+		t.Fatalf("加载配置失败: %v", err)
+	}
+	logging.SetLevel(Get().Log.Level)
+	t.Cleanup(func() { logging.SetLevel(logging.LevelInfo) })
+
+	write("log:\n  level: warn\n")
+	result := Reload(TriggerAPI)
+	if !result.Success {
+		t.Fatalf("热加载失败: %s", result.Error)
+	}
+	if !slices.Contains(result.Changed, "log.level") {
+		t.Errorf("变更 = %v，应包含 log.level", result.Changed)
+	}
+	if logging.Enabled(slog.LevelInfo) || !logging.Enabled(slog.LevelWarn) {
+		t.Error("热加载后应只输出 warn 及以上级别的日志")
+	}
+
+	// 不支持的级别在校验时被拒绝，当前级别不变
+	write("log:\n  level: verbose\n")
+	if result := Reload(TriggerAPI); result.Success {
+		t.Fatal("不支持的日志级别不应热加载成功")
+	}
+	if Get().Log.Level != "warn" || logging.Enabled(slog.LevelInfo) {
+		t.Error("热加载失败后应保持原来的日志级别")
+	}
+}
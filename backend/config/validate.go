@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"hospital-system/internal/logging"
+)
+
+// --- 配置校验 ---
+// 启动前检查一遍，有问题直接拒绝启动，而不是带着空密钥或错误端口运行
+
+// 密钥的最短长度
+const minSecretLength = 16
+
+// 病历、患者档案保留期限的下限 (天)
+const minRecordRetentionDays = 365
+
+// 常见的占位密钥
+var placeholderSecrets = []string{"changeme", "change-me", "change_me", "example", "secret", "password", "mock-secret"}
+
+// weakSecret 密钥为空、太短或是占位值
+func weakSecret(s string) bool {
+	if len(s) < minSecretLength {
+		return true
+	}
+	lower := strings.ToLower(s)
+	for _, p := range placeholderSecrets {
+		if lower == p || strings.HasPrefix(lower, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// validURL 是否为 http(s) 地址
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Validate 校验配置，返回所有问题 (每行一条)
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// 1. 服务与数据库
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		add("server.port 必须在 1-65535 之间，当前为 %d", c.Server.Port)
+	}
+	srv := c.Server
+	if srv.ReadTimeoutSeconds < 1 || srv.WriteTimeoutSeconds < 1 || srv.IdleTimeoutSeconds < 1 {
+		add("server.read_timeout_seconds、write_timeout_seconds、idle_timeout_seconds 必须大于 0")
+	}
+	if srv.ShutdownTimeoutSeconds < 1 || srv.ShutdownDelaySeconds < 0 {
+		add("server.shutdown_timeout_seconds 必须大于 0，shutdown_delay_seconds 不能为负数")
+	}
+	if (srv.TLS.CertFile == "") != (srv.TLS.KeyFile == "") {
+		add("server.tls.cert_file 和 key_file 必须同时设置")
+	}
+	if !logging.Valid(c.Log.Level) {
+		add("log.level 只能是 debug、info、warn 或 error，当前为 %q", c.Log.Level)
+	}
+	db := c.Database
+	switch db.Driver {
+	case "", "sqlite":
+		if strings.TrimSpace(db.Path) == "" {
+			add("database.path 不能为空")
+		}
+	case "postgres":
+		if strings.TrimSpace(db.DSN) == "" {
+			add("database.dsn 不能为空，请通过环境变量 %s 设置", envName("database.dsn"))
+		}
+	default:
+		add("database.driver 只能是 sqlite 或 postgres，当前为 %q", db.Driver)
+	}
+	if db.MaxOpenConns < 0 || db.MaxIdleConns < 0 || db.ConnMaxLifetimeMinutes < 0 {
+		add("database.max_open_conns、max_idle_conns、conn_max_lifetime_minutes 不能为负数")
+	}
+	if db.MaxOpenConns > 0 && db.MaxIdleConns > db.MaxOpenConns {
+		add("database.max_idle_conns 不能大于 max_open_conns")
+	}
+
+	// 2. 登录与签名密钥
+	a := c.Auth
+	if a.JwtExpireHours < 1 || a.JwtExpireHours > 24*30 {
+		add("auth.jwt_expire_hours 必须在 1-720 之间，当前为 %d", a.JwtExpireHours)
+	}
+	if strings.TrimSpace(a.Keys.Dir) == "" {
+		add("auth.keys.dir 不能为空")
+	}
+	if a.Keys.Algorithm != "RS256" && a.Keys.Algorithm != "EdDSA" {
+		add("auth.keys.algorithm 只能是 RS256 或 EdDSA，当前为 %q", a.Keys.Algorithm)
+	}
+	if a.Password.MinLength < 8 {
+		add("auth.password.min_length 不能小于 8")
+	}
+	if a.Password.HistorySize < 0 {
+		add("auth.password.history_size 不能为负数")
+	}
+	if a.Lockout.MaxAttempts < 1 || a.Lockout.CooldownMinutes < 1 {
+		add("auth.lockout.max_attempts 和 cooldown_minutes 必须大于 0")
+	}
+
+	// 3. 统一身份认证
+	if o := a.OIDC; o.Enabled {
+		if !validURL(o.Issuer) {
+			add("auth.oidc.issuer 必须是 http(s) 地址")
+		}
+		if o.ClientID == "" {
+			add("auth.oidc.client_id 不能为空")
+		}
+		if weakSecret(o.ClientSecret) {
+			add("auth.oidc.client_secret 为空或过于简单 (至少 %d 位，不能是占位值)，请通过环境变量 %s 设置",
+				minSecretLength, envName("auth.oidc.client_secret"))
+		}
+		if !validURL(o.RedirectURL) {
+			add("auth.oidc.redirect_url 必须是 http(s) 地址")
+		}
+		if len(o.RoleMappings) == 0 {
+			add("auth.oidc.role_mappings 为空，任何人都无法通过统一身份认证登录")
+		}
+	}
+
+	// 4. 文件存储
+	s := c.Storage
+	switch s.Driver {
+	case "", "local":
+		if strings.TrimSpace(s.LocalDir) == "" {
+			add("storage.local_dir 不能为空")
+		}
+	case "s3":
+		if !validURL(s.S3.Endpoint) {
+			add("storage.s3.endpoint 必须是 http(s) 地址")
+		}
+		if s.S3.Bucket == "" || s.S3.AccessKey == "" {
+			add("storage.s3.bucket 和 access_key 不能为空")
+		}
+		if weakSecret(s.S3.SecretKey) {
+			add("storage.s3.secret_key 为空或过于简单，请通过环境变量 %s 设置", envName("storage.s3.secret_key"))
+		}
+	default:
+		add("storage.driver 只能是 local 或 s3，当前为 %q", s.Driver)
+	}
+	if s.MaxImageMB < 1 || s.MaxFileMB < 1 {
+		add("storage.max_image_mb 和 max_file_mb 必须大于 0")
+	}
+
+	// 5. 敏感字段加密
+	if strings.TrimSpace(c.Encryption.KeysDir) == "" {
+		add("encryption.keys_dir 不能为空")
+	}
+	if c.Encryption.ActiveVersion < 0 {
+		add("encryption.active_version 不能为负数")
+	}
+
+	// 6. 数据库备份
+	b := c.Backup
+	if strings.TrimSpace(b.Dir) == "" {
+		add("backup.dir 不能为空")
+	}
+	if b.IntervalHours < 0 || b.Keep < 1 {
+		add("backup.interval_hours 不能为负数，backup.keep 至少为 1")
+	}
+	if b.EncryptionKey != "" && weakSecret(b.EncryptionKey) {
+		add("backup.encryption_key 过于简单 (至少 %d 位，不能是占位值)，请通过环境变量 %s 设置",
+			minSecretLength, envName("backup.encryption_key"))
+	}
+
+	// 7. 数据保留期限
+	r := c.Retention
+	if r.IntervalHours < 0 || r.VisitDays < 0 || r.InactivePatientDays < 0 || r.AccessLogDays < 0 || r.PhoneVerificationDays < 0 {
+		add("retention 下的各项不能为负数")
+	}
+	// 病历和档案匿名化后无法恢复，过短的期限多半是把单位当成了年或月
+	if (r.VisitDays > 0 && r.VisitDays < minRecordRetentionDays) || (r.InactivePatientDays > 0 && r.InactivePatientDays < minRecordRetentionDays) {
+		add("retention.visit_days 和 inactive_patient_days 以天为单位，不能小于 %d (0 表示永久保留)", minRecordRetentionDays)
+	}
+	// 档案匿名化时其就诊记录一并匿名化，不能早于就诊记录本身的期限
+	if r.InactivePatientDays > 0 && r.VisitDays > 0 && r.InactivePatientDays < r.VisitDays {
+		add("retention.inactive_patient_days 不能小于 visit_days")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(problems, "\n"))
+}
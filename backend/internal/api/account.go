@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/credential"
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 个人账户 (Me) ---
+// 对应路由：/api/v1/dashboard/me
+// 这组接口允许 "必须先修改密码 / 绑定两步验证" 的受限 Token 访问
+
+const ssoPasswordMsg = "统一身份认证账号的密码由身份提供方管理"
+
+// 重新验证密码连续失败被锁定
+const reverifyLockedMsg = "连续验证失败次数过多，账号已临时锁定，请稍后再试"
+
+var errReverifyFailed = errors.New("验证失败")
+
+// reverify 已登录用户做敏感操作前再次验证身份 (密码、验证码)
+// 与登录共用失败计数和锁定：拿到 Token 的人不能借这些接口无限次猜密码
+// checks 依次执行，任一不通过记一次失败并返回 errReverifyFailed；锁定期内返回 credential.ErrLocked
+func reverify(db *gorm.DB, user *model.User, checks ...func() bool) error {
+	if credential.IsLocked(user) {
+		return credential.ErrLocked
+	}
+	for _, check := range checks {
+		if !check() {
+			if err := credential.RecordFailure(db, user); err != nil {
+				logging.Warnf("记录验证失败次数出错: %v", err)
+			}
+			return errReverifyFailed
+		}
+	}
+	if err := credential.RecordSuccess(db, user); errors.Is(err, credential.ErrLocked) {
+		return err
+	} else if err != nil {
+		logging.Warnf("重置验证失败次数出错: %v", err)
+	}
+	return nil
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword 修改自己的密码 (需要验证旧密码)
+func ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	var user model.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+
+	if !user.IsLocal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ssoPasswordMsg})
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	err := reverify(db, &user, func() bool { return user.CheckPassword(req.OldPassword) })
+	switch {
+	case errors.Is(err, credential.ErrLocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": reverifyLockedMsg})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "旧密码错误"})
+		return
+	}
+
+	// 修改后 TokenVersion 递增，其他设备上的登录全部失效
+	err = credential.SetPassword(db, &user, req.NewPassword, false)
+	if err != nil {
+		var policyErr credential.PolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改密码失败"})
+		return
+	}
+
+	// 当前设备换发新 Token (受限 Token 也随之变成正常 Token)
+	token, err := issueToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "密码已修改", "token": token})
+}
+
+// --- 重置密码 (Password Reset) ---
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ResetPassword 使用管理员发放的一次性凭证重置密码 (公开接口)
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	err := credential.ConsumeResetToken(database.DB.WithContext(c.Request.Context()), req.Token, req.NewPassword)
+	if err != nil {
+		var policyErr credential.PolicyError
+		switch {
+		case errors.As(err, &policyErr):
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error()})
+		case errors.Is(err, credential.ErrInvalidResetToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "密码已重置，请使用新密码登录"})
+}
+
+// IssuePasswordReset 管理员为用户生成一次性重置凭证
+// 对应路由: POST /api/v1/dashboard/users/:id/password_reset
+func IssuePasswordReset(c *gin.Context) {
+	user, ok := manageableUser(c, false)
+	if !ok {
+		return
+	}
+
+	if !user.IsLocal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ssoPasswordMsg})
+		return
+	}
+
+	token, expires, err := credential.IssueResetToken(database.DB.WithContext(c.Request.Context()), user.ID, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成重置凭证失败"})
+		return
+	}
+
+	// 明文凭证只返回这一次，由管理员线下交给用户
+	c.JSON(http.StatusOK, gin.H{"msg": "重置凭证已生成", "reset_token": token, "expires_at": expires})
+}
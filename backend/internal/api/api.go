@@ -1,16 +1,23 @@
 package api
 
 import (
+	"errors"
+	"hospital-system/config"
 	"hospital-system/internal/api/middleware"
+	"hospital-system/internal/credential"
 	"hospital-system/internal/database"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/idcard"
+	"hospital-system/internal/logging"
 	"hospital-system/internal/model"
-	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
 // --- 认证模块 ---
@@ -21,12 +28,20 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	Username   string `json:"username" binding:"required"`
-	Password   string `json:"password" binding:"required"`
-	Role       string `json:"role" binding:"required"`
-	Department string `json:"department"`
+	Username     string `json:"username" binding:"required"`
+	Password     string `json:"password" binding:"required"`
+	Role         string `json:"role" binding:"required"`
+	Department   string `json:"department"` // 科室名称，与 department_id 二选一
+	DepartmentID *uint  `json:"department_id"`
+	OrgID        uint   `json:"org_id"` // 仅全局管理员可指定
 }
 
+// 登录失败统一提示：不区分 "用户不存在"、"密码错误" 和 "账号锁定"，避免泄露用户名是否存在
+const loginFailedMsg = "用户名或密码错误，连续失败多次后账号将被临时锁定"
+
+// 账号被管理员停用
+const disabledMsg = "账号已停用，请联系管理员"
+
 func LoginHandler(c *gin.Context) {
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -36,65 +51,293 @@ func LoginHandler(c *gin.Context) {
 
 	var user model.User
 	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		credential.DummyCompare(req.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMsg})
 		return
 	}
 
-	log.Printf("【调试】正在比对用户: %s", user.Username)
-	log.Printf("【调试】用户输入明文: %s", req.Password)
-	log.Printf("【调试】数据库存储哈希: %s", user.Password)
+	// 锁定期内即使密码正确也拒绝登录；统一身份认证账号不能用密码登录
+	if credential.IsLocked(&user) || !user.IsLocal() {
+		credential.DummyCompare(req.Password)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMsg})
+		return
+	}
 
+	db := database.DB.WithContext(c.Request.Context())
 	if !user.CheckPassword(req.Password) {
-		log.Println("【结果】密码比对失败！")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误"})
+		if err := credential.RecordFailure(db, &user); err != nil {
+			logging.Warnf("记录登录失败次数出错: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMsg})
+		return
+	}
+	// 密码正确后才提示停用，避免借此探测账号
+	if !user.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": disabledMsg})
 		return
 	}
+	if err := credential.RecordSuccess(db, &user); errors.Is(err, credential.ErrLocked) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMsg})
+		return
+	} else if err != nil {
+		logging.Warnf("重置登录失败次数出错: %v", err)
+	}
 
-	log.Println("【结果】密码比对成功")
+	// 已开启两步验证：先发一个短期挑战 Token，凭验证码到 /login/mfa 换取正式 Token
+	if user.TOTPEnabled {
+		challenge, err := issueMFAChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"challenge_token": challenge,
+			"expires_in":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
 
-	// 签发 Token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"role":    user.Role,
-		"org_id":  user.OrgID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
+	respondLogin(c, user)
+}
 
-	tokenString, err := token.SignedString(middleware.JwtKey)
+// respondLogin 登录成功，签发正式 Token
+// 需要改密码 / 绑定两步验证的账号只拿到受限 Token，只能访问 /me 下的接口
+func respondLogin(c *gin.Context, user model.User) {
+	tokenString, err := issueToken(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
-		"user":  gin.H{"username": user.Username, "role": user.Role, "id": user.ID},
+		"token":                   tokenString,
+		"must_change_password":    user.MustChangePassword,
+		"mfa_enrollment_required": mfaEnrollmentRequired(user),
+		"user":                    gin.H{"username": user.Username, "role": user.Role, "id": user.ID},
 	})
 }
 
+// issueToken 为用户签发 JWT
+func issueToken(user model.User) (string, error) {
+	expireHours := config.Get().Auth.JwtExpireHours
+	if expireHours <= 0 {
+		expireHours = 24
+	}
+
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"role":    user.Role,
+		"org_id":  user.OrgID,
+		"tv":      user.TokenVersion, // 与数据库不一致的 Token 会被中间件拒绝
+		"exp":     time.Now().Add(time.Hour * time.Duration(expireHours)).Unix(),
+	}
+	typ := middleware.TypeAccess
+	if user.MustChangePassword {
+		claims["pwd_change"] = true
+		typ = middleware.TypeRestricted
+	}
+	if mfaEnrollmentRequired(user) {
+		claims["mfa_enroll"] = true
+		typ = middleware.TypeRestricted
+	}
+
+	return middleware.SignToken(typ, claims)
+}
+
+// GetJWKS 公开签名公钥 (JWKS)，其他服务按 Token Header 中的 kid 取对应公钥校验
+// 同一把密钥也签发受限 Token 和一次性用途的 Token，校验方还要检查 typ 和 aud (见 middleware.TypeAccess)
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, middleware.Keys().JWKS())
+}
+
+// PatientRegisterRequest 患者自助注册 (实名 + 手机验证)
+type PatientRegisterRequest struct {
+	Username  string `json:"username" binding:"required"`
+	Password  string `json:"password" binding:"required"`
+	RealName  string `json:"real_name" binding:"required"`
+	IDCard    string `json:"id_card" binding:"required"`
+	Phone     string `json:"phone" binding:"required"`
+	SMSCode   string `json:"sms_code" binding:"required"`
+	BirthDate string `json:"birth_date"` // 可选 (2006-01-02)，填写时必须与身份证一致
+	Gender    string `json:"gender"`     // 可选，填写时必须与身份证一致
+}
+
+var (
+	errIDCardLinked  = errors.New("该身份证已绑定其他账号，如有疑问请到前台处理")
+	errNameMismatch  = errors.New("姓名与医院登记的信息不一致，请到前台核对")
+	errUsernameTaken = errors.New("注册失败，用户名已存在")
+)
+
+// RegisterHandler 患者自助注册
+// 身份证号已在前台建档的，直接关联已有的患者档案 (就诊记录随之可见)，否则新建档案
 func RegisterHandler(c *gin.Context) {
-	// RegisterRequest 接收参数，而不是 model.User
-	var req RegisterRequest
+	var req PatientRegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
+	req.RealName = strings.TrimSpace(req.RealName)
 
-	// 2. 手动构建 model.User 对象
-	user := model.User{
-		Username: req.Username,
-		Password: req.Password,   // 此时 req.Password 是有值的！
-		Role:     "general_user", // 强制指定角色
-		OrgID:    1,              //默认主院区
+	// 1. 基本校验
+	// 1.1 密码复杂度
+	if err := credential.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// 1.2 身份证 (校验位、出生日期)，填写的生日和性别必须与身份证一致
+	info, err := idcard.Parse(req.IDCard)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.BirthDate != "" && req.BirthDate != info.BirthDate.Format("2006-01-02") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "出生日期与身份证不一致"})
+		return
+	}
+	if req.Gender != "" && req.Gender != info.Gender {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "性别与身份证不一致"})
+		return
+	}
+	// 1.3 手机号
+	if !credential.ValidPhone(req.Phone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": credential.ErrInvalidPhone.Error()})
+		return
+	}
+	// 1.4 用户名 (先查一次，避免白白消耗验证码)
+	var count int64
+	database.DB.Unscoped().Model(&model.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": errUsernameTaken.Error()})
+		return
+	}
+
+	// 2. 手机验证码 (先于档案核对，避免未验证手机的请求借此试探身份证号和姓名)
+	db := database.DB.WithContext(c.Request.Context())
+	if err := credential.VerifyPhoneCode(db, req.Phone, credential.PurposeRegister, req.SMSCode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": credential.ErrInvalidPhoneCode.Error()})
+		return
+	}
+
+	// 3. 关联或新建患者档案，并创建账号
+	linked := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// 3.1 事务内再核对一次 (并发注册同一身份证)
+		patient, err := registeredPatient(tx, info.Number, req.RealName)
+		if err != nil {
+			return err
+		}
+
+		if patient != nil {
+			// 3.2 前台已建档：用实名信息补全档案
+			patient.Phone = req.Phone
+			patient.Gender = info.Gender
+			patient.BirthDate = &info.BirthDate
+			if err := tx.Save(patient).Error; err != nil {
+				return err
+			}
+			linked = true
+		} else {
+			// 3.3 首次就诊：新建档案
+			patient = &model.Patient{
+				Name:      req.RealName,
+				Phone:     req.Phone,
+				IDCard:    info.Number,
+				Gender:    info.Gender,
+				BirthDate: &info.BirthDate,
+			}
+			if err := tx.Create(patient).Error; err != nil {
+				return err
+			}
+		}
+
+		// 3.4 创建账号 (BeforeSave 会自动加密密码)，用户名在事务内再查一次 (并发注册同一用户名)
+		var taken int64
+		if err := tx.Unscoped().Model(&model.User{}).Where("username = ?", req.Username).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errUsernameTaken
+		}
+		user := model.User{
+			Username:  req.Username,
+			Password:  req.Password,
+			Role:      "general_user", // 强制指定角色
+			OrgID:     1,              // 默认主院区
+			PatientID: &patient.ID,
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		respondRegisterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "注册成功", "linked_existing_record": linked})
+}
+
+// registeredPatient 按身份证号查找前台已建的档案 (没有时返回 nil)
+// 档案已被其他账号绑定、或姓名对不上时返回错误
+func registeredPatient(db *gorm.DB, idCard, realName string) (*model.Patient, error) {
+	var patient model.Patient
+	err := db.Where("id_card_hash = ?", fieldcrypt.BlindIndex(idCard)).First(&patient).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bound int64
+	db.Unscoped().Model(&model.User{}).Where("patient_id = ?", patient.ID).Count(&bound)
+	if bound > 0 {
+		return nil, errIDCardLinked
+	}
+	if patient.Name != realName {
+		return nil, errNameMismatch
+	}
+	return &patient, nil
+}
+
+func respondRegisterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errIDCardLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, errNameMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errUsernameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logging.Errorf("患者注册失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败，请稍后再试"})
 	}
+}
 
-	// 3. 执行写入 (BeforeCreate 会自动加密 user.Password)
-	if err := database.DB.Create(&user).Error; err != nil {
-		c.JSON(http.StatusConflict, gin.H{"error": "注册失败，用户名已存在"})
+type SMSCodeRequest struct {
+	Phone string `json:"phone" binding:"required"`
+}
+
+// SendRegisterCode 发送注册用的手机验证码
+func SendRegisterCode(c *gin.Context) {
+	var req SMSCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"msg": "注册成功"})
+	err := credential.SendPhoneCode(c.Request.Context(), database.DB.WithContext(c.Request.Context()), req.Phone, credential.PurposeRegister)
+	if err != nil {
+		var policyErr credential.PolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error()})
+			return
+		}
+		logging.Warnf("发送验证码失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证码发送失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "验证码已发送"})
 }
 
 // --- 挂号业务 (Bookings) ---
@@ -102,11 +345,15 @@ func RegisterHandler(c *gin.Context) {
 
 // BookingRequest 定义前端传来的挂号参数
 type BookingRequest struct {
-	PatientName string `json:"patient_name" binding:"required"`
-	Age         int    `json:"age"`
-	Gender      string `json:"gender"`
-	Department  string `json:"department" binding:"required"`
-	DoctorID    uint   `json:"doctor_id"`
+	PatientName  string `json:"patient_name" binding:"required"`
+	Age          int    `json:"age"`
+	Gender       string `json:"gender"`
+	Department   string `json:"department"` // 科室名称，与 department_id 二选一
+	DepartmentID *uint  `json:"department_id"`
+	DoctorID     uint   `json:"doctor_id"`
+	DependentID  uint   `json:"dependent_id"` // 患者给家属挂号时传
+	PatientID    uint   `json:"patient_id"`   // 挂号员：已建档的患者传档案 ID
+	IDCard       string `json:"id_card"`      // 挂号员：不知道档案 ID 时传身份证号，已建档的自动关联，未建档的同时建档
 	// Phone    string `json:"phone"` // 暂不存手机号，以免数据库报错，除非你在 model 里加了 Phone
 }
 
@@ -122,14 +369,14 @@ func GetBookings(c *gin.Context) {
 
 	// 2. 权限分流
 	if role == "general_user" {
-		// 【核心逻辑】如果是普通用户，必须先查出他的名字，然后只返回属于他的记录
+		// 【核心逻辑】如果是普通用户，必须先查出他关联的档案，然后只返回属于他的记录
 		var currentUser model.User
 		if err := database.DB.First(&currentUser, userID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "无法获取用户信息"})
 			return
 		}
-		// 强制加上 WHERE 条件
-		tx = tx.Where("patient_name = ?", currentUser.Username)
+		// 强制加上 WHERE 条件 (本人 + 家属)
+		tx = whereOwnPatients(tx, "patient_id", currentUser)
 	}
 	// 如果是 registration/admin，则不加 Where 条件，默认查所有
 
@@ -154,29 +401,65 @@ func CreateBooking(c *gin.Context) {
 	role := c.GetString("role")
 	userID := c.GetUint("user_id")
 
+	// 科室必须是启用中的科室，避免手填的名称拆散统计
+	dept, err := resolveDepartment(database.DB, currentOrg(c), req.DepartmentID, req.Department)
+	if err == nil && dept == nil {
+		err = errDepartmentNotFound
+	}
+	if err != nil {
+		respondDepartmentError(c, err)
+		return
+	}
+
 	// 2. 构建对象
 	booking := model.Booking{
-		Age:        req.Age,
-		Gender:     req.Gender,
-		Department: req.Department,
-		DoctorID:   req.DoctorID,
-		Status:     "Pending",
-		CreatedAt:  time.Now(),
+		Age:          req.Age,
+		Gender:       req.Gender,
+		Department:   dept.Name,
+		DepartmentID: &dept.ID,
+		DoctorID:     req.DoctorID,
+		Status:       "Pending",
+		CreatedAt:    time.Now(),
 	}
 
-	// 3. 【核心逻辑】姓名处理
+	// 3. 【核心逻辑】患者身份处理：之后的访问控制都按档案 (PatientID) 判断
+	var frontDeskID *idcard.Info
 	if role == "general_user" {
-		// 如果是患者，强制使用当前登录账号的用户名，忽略前端传来的 PatientName
+		// 如果是患者，忽略前端传来的 PatientName：默认给自己挂号，指定 dependent_id 时给家属挂号
 		var currentUser model.User
 		database.DB.First(&currentUser, userID)
-		booking.PatientName = currentUser.Username
+		booking.PatientID = currentUser.PatientID
+
+		if req.DependentID != 0 {
+			dep, ok := activeDependent(currentUser.ID, req.DependentID)
+			if !ok {
+				c.JSON(http.StatusForbidden, gin.H{"error": "家属不存在或授权已失效"})
+				return
+			}
+			booking.PatientID = &dep.PatientID
+		}
+		if booking.PatientID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "账号未关联患者档案，请到前台办理"})
+			return
+		}
 	} else {
 		// 如果是挂号员，允许使用前端传来的名字（帮别人挂号）
-		if req.PatientName == "" {
+		booking.PatientName = strings.TrimSpace(req.PatientName)
+		if booking.PatientName == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "挂号员必须填写患者姓名"})
 			return
 		}
-		booking.PatientName = req.PatientName
+		// 传了档案 ID 或身份证号的关联档案；都没传的 (急诊等来不及建档) 只登记姓名
+		if req.PatientID != 0 {
+			booking.PatientID = &req.PatientID
+		} else if req.IDCard != "" {
+			info, err := idcard.Parse(req.IDCard)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			frontDeskID = &info
+		}
 	}
 
 	// 4. 兜底医生ID
@@ -185,7 +468,47 @@ func CreateBooking(c *gin.Context) {
 		booking.DoctorID = 1
 	}
 
-	if err := database.DB.Create(&booking).Error; err != nil {
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		// 5. 找到 (或新建) 档案，姓名以档案为准
+		var patient *model.Patient
+		if frontDeskID != nil {
+			p, err := frontDeskPatient(tx, *frontDeskID, booking.PatientName)
+			if err != nil {
+				return err
+			}
+			patient = p
+		} else if booking.PatientID != nil {
+			var p model.Patient
+			if err := tx.Where("anonymized_at IS NULL").First(&p, *booking.PatientID).Error; err != nil {
+				return errPatientNotFound
+			}
+			if role != "general_user" && p.Name != booking.PatientName {
+				return errNameMismatch
+			}
+			patient = &p
+		}
+
+		if patient != nil {
+			booking.PatientID = &patient.ID
+			booking.PatientName = patient.Name
+			// 实名档案里有性别和生日的，前端没填时自动补上
+			if booking.Gender == "" {
+				booking.Gender = patient.Gender
+			}
+			if booking.Age == 0 && patient.BirthDate != nil {
+				booking.Age = ageOn(*patient.BirthDate, time.Now())
+			}
+		}
+		return tx.Create(&booking).Error
+	})
+	switch {
+	case errors.Is(err, errPatientNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errNameMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "患者姓名与档案登记的不一致"})
+		return
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "挂号失败"})
 		return
 	}
@@ -193,14 +516,36 @@ func CreateBooking(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "挂号成功", "data": booking})
 }
 
-// GetDoctorList 专门用于下拉框的医生列表接口 (公开给登录用户)
-func GetDoctorList(c *gin.Context) {
-	var doctors []model.User
-	// GORM 默认 select *，所以只要结构体里有 Department，就会查出来
-	database.DB.Where("role = ?", "doctor").Find(&doctors)
-	c.JSON(http.StatusOK, gin.H{"data": doctors})
+var errPatientNotFound = errors.New("患者档案不存在")
+
+// frontDeskPatient 前台按身份证号找到已建的档案 (核对姓名)，没有时新建
+func frontDeskPatient(tx *gorm.DB, info idcard.Info, name string) (*model.Patient, error) {
+	var patient model.Patient
+	err := tx.Where("id_card_hash = ?", fieldcrypt.BlindIndex(info.Number)).First(&patient).Error
+	if err == nil {
+		if patient.Name != name {
+			return nil, errNameMismatch
+		}
+		return &patient, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	patient = model.Patient{
+		Name:      name,
+		IDCard:    info.Number,
+		Gender:    info.Gender,
+		BirthDate: &info.BirthDate,
+	}
+	if err := tx.Create(&patient).Error; err != nil {
+		return nil, err
+	}
+	return &patient, nil
 }
 
+// 医生列表和医生目录见 doctors.go
+
 // --- 支付业务 ---
 // 对应页面：/payment
 
@@ -230,14 +575,14 @@ func GetUnpaidOrders(c *gin.Context) {
 
 	// 权限判断
 	if role == "general_user" {
-		// 1. 如果是普通用户，只能查 Booking.PatientName == 当前用户名
+		// 1. 如果是普通用户，只能查本人档案 (Booking.PatientID) 和家属的
 		var currentUser model.User
 		if err := database.DB.First(&currentUser, userID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
 			return
 		}
-		// 核心过滤：只看自己的名字
-		db = db.Where("bookings.patient_name = ?", currentUser.Username)
+		// 核心过滤：只看自己和家属的
+		db = whereOwnPatients(db, "bookings.patient_id", currentUser)
 	}
 	// 2. 如果是 registration/finance/admin，不加额外 Where 条件，即查询所有
 
@@ -267,7 +612,7 @@ func GetPaidOrders(c *gin.Context) {
 	if role == "general_user" {
 		var currentUser model.User
 		database.DB.First(&currentUser, userID)
-		db = db.Where("bookings.patient_name = ?", currentUser.Username)
+		db = whereOwnPatients(db, "bookings.patient_id", currentUser)
 	}
 
 	if err := db.Scan(&results).Error; err != nil {
@@ -289,7 +634,7 @@ func ConfirmPayment(c *gin.Context) {
 		return
 	}
 
-	tx := database.DB.Begin() // 开启事务
+	tx := database.DB.WithContext(c.Request.Context()).Begin() // 开启事务
 
 	// 1. 查找订单
 	var order model.Order
@@ -339,10 +684,12 @@ func GetFinanceStats(c *gin.Context) {
 	var totalIncome float64
 	database.DB.Model(&model.Order{}).Where("status = ?", "Paid").Select("sum(total_amount)").Row().Scan(&totalIncome)
 
-	// B. 今日收入 (SQLite date函数写法)
+	// B. 今日收入 (按服务器时区的自然日计算时间范围，不依赖各数据库不同的日期函数)
 	var todayIncome float64
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
 	database.DB.Model(&model.Order{}).
-		Where("status = ? AND date(created_at) = date('now')", "Paid").
+		Where("status = ? AND created_at >= ? AND created_at < ?", "Paid", today, today.AddDate(0, 0, 1)).
 		Select("sum(total_amount)").Row().Scan(&todayIncome)
 
 	// C. 订单总数
@@ -365,18 +712,20 @@ func GetFinanceStats(c *gin.Context) {
 
 // 2. 科室营收排名 (连表查询：Orders -> Bookings)
 type DeptRevenue struct {
-	Department string  `json:"department"`
-	Total      float64 `json:"total"`
+	DepartmentID *uint   `json:"department_id"`
+	Department   string  `json:"department"`
+	Total        float64 `json:"total"`
 }
 
 func GetDeptRevenue(c *gin.Context) {
 	var results []DeptRevenue
-	// SQL: SELECT b.department, SUM(o.total_amount) as total FROM orders o JOIN bookings b ON o.booking_id = b.id WHERE o.status='Paid' GROUP BY b.department
+	// 按科室 ID 汇总，名称取科室表里的当前名称 (没有关联科室的老数据按原文本汇总)
 	database.DB.Table("orders").
-		Select("bookings.department, sum(orders.total_amount) as total").
+		Select("bookings.department_id, COALESCE(departments.name, bookings.department) AS department, sum(orders.total_amount) as total").
 		Joins("JOIN bookings ON bookings.id = orders.booking_id").
+		Joins("LEFT JOIN departments ON departments.id = bookings.department_id").
 		Where("orders.status = ?", "Paid").
-		Group("bookings.department").
+		Group("bookings.department_id, COALESCE(departments.name, bookings.department)").
 		Order("total desc").
 		Scan(&results)
 
@@ -420,10 +769,11 @@ func GetPendingPatients(c *gin.Context) {
 
 // 这里的结构体定义可以保留在外面，也可以放里面，这里沿用你的定义
 type RecordRequest struct {
-	BookingID  uint   `json:"booking_id"`
-	Diagnosis  string `json:"diagnosis"`
-	MedicineID uint   `json:"medicine_id"` // 开什么药
-	Quantity   int    `json:"quantity"`    // 开多少
+	BookingID      uint   `json:"booking_id"`
+	Diagnosis      string `json:"diagnosis"`
+	MedicineID     uint   `json:"medicine_id"`     // 开什么药
+	Quantity       int    `json:"quantity"`        // 开多少
+	OverrideReason string `json:"override_reason"` // 忽略过敏/相互作用警告的理由
 }
 
 // SubmitMedicalRecord 提交诊断
@@ -434,7 +784,7 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
-	tx := database.DB.Begin() // 开启事务
+	tx := database.DB.WithContext(c.Request.Context()).Begin() // 开启事务
 
 	// 1. 检查并锁定药品（获取价格）
 	var med model.InventoryItem
@@ -444,6 +794,32 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
+	// 1.1 过敏史与配伍禁忌检查
+	var booking model.Booking
+	if err := tx.First(&booking, req.BookingID).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, gin.H{"error": "挂号记录不存在"})
+		return
+	}
+	blocks, warns, err := checkPrescription(tx, booking, med)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处方安全检查失败"})
+		return
+	}
+	if len(blocks) > 0 {
+		// 禁止项不能被忽略
+		tx.Rollback()
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "处方存在禁忌，无法开具", "conflicts": blocks, "warnings": warns})
+		return
+	}
+	if len(warns) > 0 && strings.TrimSpace(req.OverrideReason) == "" {
+		// 警告项需要医生填写理由后重新提交
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "处方存在警告，请填写理由后再提交", "warnings": warns})
+		return
+	}
+
 	// 2. 保存病历
 	record := model.MedicalRecord{
 		BookingID:    req.BookingID,
@@ -457,6 +833,24 @@ func SubmitMedicalRecord(c *gin.Context) {
 		return
 	}
 
+	// 2.1 记录医生忽略警告的理由
+	if len(warns) > 0 {
+		override := model.PrescriptionOverride{
+			MedicalRecordID: record.ID,
+			BookingID:       req.BookingID,
+			DoctorID:        c.GetUint("user_id"),
+			MedicineID:      req.MedicineID,
+			Warnings:        describeConflicts(warns),
+			Reason:          strings.TrimSpace(req.OverrideReason),
+			CreatedAt:       time.Now(),
+		}
+		if err := tx.Create(&override).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存警告忽略记录失败"})
+			return
+		}
+	}
+
 	// 3. 更新挂号状态 -> Completed (已就诊)
 	// 修正：状态改成 "Completed" (大写C)
 	if err := tx.Model(&model.Booking{}).Where("id = ?", req.BookingID).Update("status", "Completed").Error; err != nil {
@@ -523,13 +917,13 @@ func AddOrUpdateInventoryItem(c *gin.Context) {
 		existingItem.Stock += req.Stock
 		existingItem.Price = req.Price // 更新为最新单价
 		existingItem.Description = req.Description
-		database.DB.Save(&existingItem)
+		database.DB.WithContext(c.Request.Context()).Save(&existingItem)
 		c.JSON(http.StatusOK, gin.H{"msg": "已合并库存", "data": existingItem})
 	} else {
 		// 没找到 -> 创建新记录
 		// 确保 OrgID 从 Token 获取，这里简化处理
 		req.OrgID = 1
-		database.DB.Create(&req)
+		database.DB.WithContext(c.Request.Context()).Create(&req)
 		c.JSON(http.StatusOK, gin.H{"msg": "新物资入库成功", "data": req})
 	}
 }
@@ -555,14 +949,14 @@ func UpdateInventoryItem(c *gin.Context) {
 	item.Stock = req.Stock
 	item.Description = req.Description
 
-	database.DB.Save(&item)
+	database.DB.WithContext(c.Request.Context()).Save(&item)
 	c.JSON(http.StatusOK, gin.H{"msg": "更新成功", "data": item})
 }
 
 // DeleteInventoryItem 删除物资
 func DeleteInventoryItem(c *gin.Context) {
 	id := c.Param("id")
-	database.DB.Delete(&model.InventoryItem{}, id)
+	database.DB.WithContext(c.Request.Context()).Delete(&model.InventoryItem{}, id)
 	c.JSON(http.StatusOK, gin.H{"msg": "删除成功"})
 }
 
@@ -572,49 +966,63 @@ func DeleteInventoryItem(c *gin.Context) {
 // 定义返回结构，方便前端显示医生名字和患者名字
 type MedicalRecordDetail struct {
 	model.MedicalRecord
+	PatientID   uint   `json:"patient_id"` // 前台挂号时未建档的为 0
 	PatientName string `json:"patient_name"`
+	DoctorID    uint   `json:"doctor_id"`
 	DoctorName  string `json:"doctor_name"`
+	AccessBasis string `json:"access_basis"` // 当前用户凭什么看到这条病历
 }
 
 // GetMedicalRecords 获取电子病历列表
+// 访问规则见 record_access.go，每条返回的病历都会写入访问日志
 func GetMedicalRecords(c *gin.Context) {
 	role := c.GetString("role")
 	userID := c.GetUint("user_id")
 
+	var currentUser model.User
+	if err := database.DB.First(&currentUser, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+
 	var results []MedicalRecordDetail
 
-	// 1. 基础查询：关联 bookings 表以获取患者信息
-	// 假设你的 User 表里存了医生名字，这里也可以关联 users 表获取医生名
-	// 这里简化处理，先只关联 bookings
+	// 1. 基础查询：关联 bookings 表以获取患者信息，关联 users 表获取医生名
 	db := database.DB.Table("medical_records").
-		Select("medical_records.*, bookings.patient_name").
+		Select("medical_records.*, COALESCE(bookings.patient_id, 0) AS patient_id, bookings.patient_name, bookings.doctor_id, users.username as doctor_name").
 		Joins("JOIN bookings ON bookings.id = medical_records.booking_id").
+		Joins("LEFT JOIN users ON users.id = bookings.doctor_id").
 		Order("medical_records.created_at desc")
 
+	if v := c.Query("patient_id"); v != "" {
+		db = db.Where("bookings.patient_id = ?", v)
+	}
+	if v := c.Query("patient_name"); v != "" {
+		db = db.Where("bookings.patient_name = ?", v)
+	}
+
 	// 2. 权限分流
 	switch role {
 	case "general_user":
 		// --- 情况 A: 普通患者 ---
-		// 只能看属于自己的病历
-		var currentUser model.User
-		if err := database.DB.First(&currentUser, userID).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
-			return
-		}
-		// 核心逻辑：只查 bookings.patient_name 等于当前用户名的记录
-		db = db.Where("bookings.patient_name = ?", currentUser.Username)
+		// 只能看属于自己和家属的病历
+		db = whereOwnPatients(db, "bookings.patient_id", currentUser)
 
 	case "doctor":
 		// --- 情况 B: 医生 ---
-		// 医生通常可以看到自己开出的病历，或者整个科室的病历
-		// 这里演示：只看自己作为医生经手的 (依赖 bookings.doctor_id)
-		db = db.Where("bookings.doctor_id = ?", userID)
-
-		// 如果你希望医生能看全院病历以便会诊，这里可以留空，不做 where 限制
+		// 自己接诊的 + 患者授权给本科室的 + 紧急访问中的 (没有科室的医生不适用科室授权)
+		if currentUser.DepartmentID != nil {
+			db = db.Where("bookings.doctor_id = ? OR bookings.patient_id IN (?) OR bookings.patient_id IN (?)",
+				userID, consentedPatients(*currentUser.DepartmentID), breakGlassPatients(userID))
+		} else {
+			db = db.Where("bookings.doctor_id = ? OR bookings.patient_id IN (?)", userID, breakGlassPatients(userID))
+		}
 
-	case "admin", "global_admin":
-		// --- 情况 C: 管理员 ---
-		// 查看所有，不做限制
+	default:
+		// --- 情况 C: 其他角色 ---
+		// 管理员、挂号员、财务都不能直接查看诊断内容，管理员通过访问日志进行审查
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看病历"})
+		return
 	}
 
 	// 3. 执行查询
@@ -623,18 +1031,45 @@ func GetMedicalRecords(c *gin.Context) {
 		return
 	}
 
+	// 4. 标记访问依据并按 (患者, 依据) 分组写访问日志
+	type accessKey struct {
+		patientID   uint
+		patientName string
+		basis       string
+	}
+	basisCache := make(map[uint]string)
+	accessed := make(map[accessKey][]uint)
+	for i := range results {
+		r := &results[i]
+		switch {
+		case role == "general_user" && currentUser.PatientID != nil && r.PatientID == *currentUser.PatientID:
+			r.AccessBasis = BasisPatient
+		case role == "general_user":
+			r.AccessBasis = BasisGuardian
+		case r.DoctorID == userID:
+			r.AccessBasis = BasisTreatingDoctor
+		default:
+			basis, ok := basisCache[r.PatientID]
+			if !ok {
+				basis, _ = grantedAccessBasis(currentUser, r.PatientID)
+				basisCache[r.PatientID] = basis
+			}
+			r.AccessBasis = basis
+		}
+		key := accessKey{r.PatientID, r.PatientName, r.AccessBasis}
+		accessed[key] = append(accessed[key], r.ID)
+	}
+	for key, ids := range accessed {
+		logRecordAccess(c, key.patientID, key.patientName, ids, "view_record", key.basis, "")
+	}
+
 	c.JSON(http.StatusOK, gin.H{"data": results})
 }
 
 // --- 用户管理 (Users) ---
 // 对应页面：/users
 
-func ManageUserStatus(c *gin.Context) {
-	// 简单实现：列出所有用户
-	var users []model.User
-	database.DB.Omit("password").Find(&users)
-	c.JSON(http.StatusOK, gin.H{"data": users})
-}
+// 列表、启用/停用、恢复见 users.go
 
 // 对应路由: POST /api/v1/dashboard/users
 func CreateUser(c *gin.Context) {
@@ -645,19 +1080,41 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
-	// 检查当前操作者的权限（可选：防止 org_admin 创建 global_admin）
-	// currentRole := c.GetString("role")
-	// 这里做简单处理：直接信任中间件的拦截
+	if err := credential.ValidatePassword(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 只能授予不高于自己级别的角色
+	if !canGrantRole(c, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权创建该角色的账号"})
+		return
+	}
+
+	// 机构管理员只能在本机构建号；全局管理员可以指定机构，默认机构1
+	orgID := req.OrgID
+	if c.GetString("role") != "global_admin" || orgID == 0 {
+		orgID = c.GetUint("org_id")
+	}
+	if orgID == 0 {
+		orgID = 1
+	}
+
+	dept, err := resolveDepartment(database.DB, orgID, req.DepartmentID, req.Department)
+	if err != nil {
+		respondDepartmentError(c, err)
+		return
+	}
 
 	user := model.User{
-		Username:   req.Username,
-		Password:   req.Password, // BeforeCreate 会自动加密
-		Role:       req.Role,     // 关键：直接使用前端传来的角色 (doctor, finance...)
-		Department: req.Department,
-		OrgID:      1, // mvp 默认机构1
+		Username: req.Username,
+		Password: req.Password, // BeforeCreate 会自动加密
+		Role:     req.Role,     // 关键：直接使用前端传来的角色 (doctor, finance...)
+		OrgID:    orgID,
 	}
+	assignDepartment(&user, dept)
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	if err := database.DB.WithContext(c.Request.Context()).Create(&user).Error; err != nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "用户已存在"})
 		return
 	}
@@ -667,35 +1124,67 @@ func CreateUser(c *gin.Context) {
 
 // 对应路由 PUT /api/v1/dashboard/users/:id
 func UpdateUser(c *gin.Context) {
-	id := c.Param("id")
 	var req struct {
-		Role       string `json:"role"`
-		Department string `json:"department"`
-		Password   string `json:"password"` // 可选：重置密码
+		Role         string  `json:"role"`
+		Department   *string `json:"department"` // 不传表示不修改，传空字符串表示清空
+		DepartmentID *uint   `json:"department_id"`
+		Password     string  `json:"password"` // 可选：重置密码
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
 		return
 	}
 
-	var user model.User
-	if err := database.DB.First(&user, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+	user, ok := manageableUser(c, false)
+	if !ok {
+		return
+	}
+	if req.Role != "" && !canGrantRole(c, req.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权授予该角色"})
+		return
+	}
+
+	if req.Password != "" && !user.IsLocal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ssoPasswordMsg})
 		return
 	}
 
 	// 更新字段
-	if req.Role != "" {
+	if req.Role != "" && req.Role != user.Role {
 		user.Role = req.Role
+		user.TokenVersion++ // Token 里带着角色，改角色后旧 Token 作废
+	}
+	// 只有请求中带了科室时才修改；允许把科室改为空（例如转岗）
+	if req.Department != nil || req.DepartmentID != nil {
+		var name string
+		if req.Department != nil {
+			name = *req.Department
+		}
+		dept, err := resolveDepartment(database.DB, user.OrgID, req.DepartmentID, name)
+		if err != nil {
+			respondDepartmentError(c, err)
+			return
+		}
+		assignDepartment(&user, dept)
 	}
-	// 允许把科室改为空字符串（例如转岗），所以不判断空
-	user.Department = req.Department
-
-	// 如果传了新密码，则修改（GORM Hook 会自动加密吗？不会！Update 不触发 BeforeCreate）
-	// 所以这里需要手动加密，或者把逻辑抽离。为简化，这里假设前端不传密码，只改科室。
-	// 如果要改密码，建议单独写 ResetPassword 接口。
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	// 资料和密码在同一个事务中保存，新密码不符合策略时其他修改一并撤销
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		// 如果传了新密码，则由管理员代设 (BeforeSave 加密)，用户下次登录必须再改一次
+		if req.Password != "" {
+			return credential.SetPassword(tx, &user, req.Password, true)
+		}
+		return nil
+	})
+	var policyErr credential.PolicyError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
@@ -705,9 +1194,17 @@ func UpdateUser(c *gin.Context) {
 
 // 对应路由: DELETE /api/v1/dashboard/users/:id
 func DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	// 硬删除 (Unscoped) 或者软删除都可以，这里用软删除
-	if err := database.DB.Delete(&model.User{}, id).Error; err != nil {
+	user, ok := manageableUser(c, false)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能删除自己的账号"})
+		return
+	}
+
+	// 软删除，可以通过 /users/:id/restore 恢复
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&user).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
@@ -741,14 +1238,3 @@ func GetDashboardStats(c *gin.Context) {
 		"meds":     medCount,
 	})
 }
-
-// --- 医院图片信息模块 ---
-func GetHospitalImages(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"data": []gin.H{
-			{"id": 1, "url": "/uploads/hospital/lobby.jpg", "title": "门诊大厅"},
-			{"id": 2, "url": "/uploads/hospital/clinic.jpg", "title": "专家诊室"},
-			{"id": 3, "url": "/uploads/hospital/rehab.jpg", "title": "康复中心"},
-		},
-	})
-}
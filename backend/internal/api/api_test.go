@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 手机验证码不对时，不能借注册接口试探身份证号和姓名是否对得上
+func TestRegisterChecksSMSBeforeRecord(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		useSMS(t)
+		idCard := withCheckDigit("11010519900101002")
+		db.Create(&model.Patient{Name: "钱七", IDCard: idCard})
+
+		w := caller{}.call(t, RegisterHandler, http.MethodPost, map[string]string{
+			"username": "qianqi", "password": "Str0ng-Passw0rd!", "real_name": "孙八",
+			"id_card": idCard, "phone": "13800000009", "sms_code": "000000",
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("状态码 %d, 期望 400", w.Code)
+		}
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp["error"] == errNameMismatch.Error() {
+			t.Fatalf("验证码错误时不应返回姓名核对结果")
+		}
+	})
+}
+
+// 未知的数据库错误不能报成 "用户名已存在"
+func TestRespondRegisterErrorUnknown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondRegisterError(c, errors.New("database is locked"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("状态码 %d, 期望 500", w.Code)
+	}
+}
+
+// 前台按身份证号挂号：未建档的新建档案，已建档的关联同一份档案，姓名对不上的拒绝
+func TestFrontDeskBookingLinksPatient(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		db.Create(&model.Department{OrgID: 1, Code: "D001", Name: "内科", Active: true})
+		desk := createStaff(t, db, "reg", "registration", nil)
+		idCard := withCheckDigit("11010519900101002")
+
+		book := func(name string) (*httptest.ResponseRecorder, model.Booking) {
+			w := as(desk).call(t, CreateBooking, http.MethodPost, map[string]interface{}{
+				"patient_name": name, "id_card": idCard, "department": "内科", "doctor_id": 1,
+			})
+			var resp struct {
+				Data model.Booking `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			return w, resp.Data
+		}
+
+		w, first := book("钱七")
+		if w.Code != http.StatusOK || first.PatientID == nil {
+			t.Fatalf("挂号应关联新建的档案 %d: %s", w.Code, w.Body.String())
+		}
+		w, second := book("钱七")
+		if w.Code != http.StatusOK || second.PatientID == nil || *second.PatientID != *first.PatientID {
+			t.Fatalf("同一身份证号应关联同一份档案 %d: %s", w.Code, w.Body.String())
+		}
+		if w, _ := book("孙八"); w.Code != http.StatusBadRequest {
+			t.Fatalf("姓名不一致: 状态码 %d, 期望 400", w.Code)
+		}
+
+		var count int64
+		db.Model(&model.Patient{}).Count(&count)
+		if count != 1 {
+			t.Fatalf("档案 %d 份, 期望 1 份", count)
+		}
+
+		// 患者注册后能看到前台挂的号
+		user := model.User{Username: "qianqi", Password: "x", Role: "general_user", PatientID: first.PatientID, OrgID: 1, Enabled: true}
+		db.Create(&user)
+		if ids := ownBookings(t, user); !ids[first.ID] || !ids[second.ID] {
+			t.Fatalf("注册后应能看到前台挂的号: %v", ids)
+		}
+	})
+}
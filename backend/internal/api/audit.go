@@ -0,0 +1,86 @@
+package api
+
+import (
+	"hospital-system/internal/audit"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 审计日志 (Audit) ---
+// 对应页面：/audit
+// 所有写操作由 GORM 回调自动记录 (见 internal/audit)
+
+// GetAuditLogs 查询审计日志
+// 参数: actor_id, entity_type, entity_id, operation, from, to (2006-01-02), page, page_size
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tx := database.DB.Model(&model.AuditLog{})
+
+	// 机构管理员只能看本机构的操作
+	if c.GetString("role") == "org_admin" {
+		tx = tx.Where("org_id = ?", c.GetUint("org_id"))
+	}
+
+	if v := c.Query("actor_id"); v != "" {
+		tx = tx.Where("actor_id = ?", v)
+	}
+	if v := c.Query("entity_type"); v != "" {
+		tx = tx.Where("entity_type = ?", v)
+	}
+	if v := c.Query("entity_id"); v != "" {
+		tx = tx.Where("entity_id = ?", v)
+	}
+	if v := c.Query("operation"); v != "" {
+		tx = tx.Where("operation = ?", v)
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误，应为 2006-01-02"})
+			return
+		}
+		tx = tx.Where("created_at >= ?", from.UTC())
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "日期格式错误，应为 2006-01-02"})
+			return
+		}
+		tx = tx.Where("created_at < ?", to.AddDate(0, 0, 1).UTC())
+	}
+
+	var total int64
+	tx.Count(&total)
+
+	var logs []model.AuditLog
+	if err := tx.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": logs, "total": total, "page": page, "page_size": pageSize})
+}
+
+// VerifyAuditLogs 校验审计日志哈希链是否完整
+func VerifyAuditLogs(c *gin.Context) {
+	result, err := audit.Verify(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
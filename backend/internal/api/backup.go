@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/backup"
+	"hospital-system/internal/database"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 数据库备份 (Backup) ---
+// 对应路由：GET  /api/v1/dashboard/backups      最近一次备份结果和备份目录中的文件
+//          POST /api/v1/dashboard/backups/run  立即备份
+// 仅全局管理员可用；恢复只能在停止服务后通过命令行执行 (./server restore)
+
+// GetBackupStatus 查看备份状态
+func GetBackupStatus(c *gin.Context) {
+	cfg := config.Get().Backup
+	files, err := backup.List(cfg.Dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取备份目录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"last":           backup.Status(),
+		"files":          files,
+		"dir":            cfg.Dir,
+		"interval_hours": cfg.IntervalHours,
+		"keep":           cfg.Keep,
+		"encrypted":      cfg.EncryptionKey != "",
+		"supported":      database.DB.Dialector.Name() == database.DriverSQLite,
+	})
+}
+
+// RunBackup 立即备份
+func RunBackup(c *gin.Context) {
+	// 页面关闭或请求断开时不中断正在进行的备份
+	result, err := backup.Run(context.WithoutCancel(c.Request.Context()), database.DB, backup.TriggerAPI)
+	switch {
+	case errors.Is(err, backup.ErrRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, backup.ErrUnsupported):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "备份失败: " + err.Error(), "data": result})
+	default:
+		c.JSON(http.StatusOK, gin.H{"msg": "备份完成", "data": result})
+	}
+}
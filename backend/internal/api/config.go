@@ -0,0 +1,45 @@
+package api
+
+import (
+	"hospital-system/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// --- 系统配置 (Config) ---
+// 对应路由：GET  /api/v1/dashboard/config         查看生效的配置 (密钥已隐藏) 和最近一次热加载结果
+//          POST /api/v1/dashboard/config/reload  立即重新加载配置文件
+// 仅全局管理员可用
+
+// GetConfigStatus 查看生效的配置
+func GetConfigStatus(c *gin.Context) {
+	// 按 yaml 标签输出，与配置文件中的写法一致
+	raw, err := yaml.Marshal(config.Get().Redacted())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配置失败"})
+		return
+	}
+	var data map[string]any
+	if err := yaml.Unmarshal(raw, &data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配置失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":        data,
+		"file":        config.LoadedFile,
+		"last_reload": config.LastReload(),
+	})
+}
+
+// ReloadConfig 立即重新加载配置，修改了需要重启的配置项时整体拒绝
+func ReloadConfig(c *gin.Context) {
+	result := config.Reload(config.TriggerAPI)
+	if !result.Success {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": result.Error, "data": result})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "配置已重新加载", "data": result})
+}
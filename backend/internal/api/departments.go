@@ -0,0 +1,329 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 科室管理 ---
+// 对应路由：GET /api/v1/dashboard/departments (所有登录用户，挂号时选择科室)
+//          POST / PUT / DELETE /api/v1/dashboard/departments[/:id]、POST /:id/merge (管理员)
+// 账号和挂号记录通过 department_id 关联科室，department 字段保留科室名称用于展示和兼容旧接口
+
+var errDepartmentNotFound = errors.New("科室不存在或已停用")
+
+// 上级科室链的最大深度 (防止数据异常时死循环)
+const maxDepartmentDepth = 32
+
+// currentOrg 当前用户所属机构，老数据没有机构的视为默认机构1
+func currentOrg(c *gin.Context) uint {
+	if id := c.GetUint("org_id"); id != 0 {
+		return id
+	}
+	return 1
+}
+
+// resolveDepartment 按 ID 或名称查找机构内启用中的科室；两者都为空时返回 nil
+func resolveDepartment(db *gorm.DB, orgID uint, id *uint, name string) (*model.Department, error) {
+	name = strings.TrimSpace(name)
+	var dept model.Department
+	var err error
+	switch {
+	case id != nil && *id != 0:
+		err = db.Where("id = ? AND org_id = ? AND active = ?", *id, orgID, true).First(&dept).Error
+	case name != "":
+		err = db.Where("name = ? AND org_id = ? AND active = ?", name, orgID, true).First(&dept).Error
+	default:
+		return nil, nil
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errDepartmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dept, nil
+}
+
+// assignDepartment 设置账号所在科室 (dept 为 nil 表示清空)
+func assignDepartment(user *model.User, dept *model.Department) {
+	if dept == nil {
+		user.Department = ""
+		user.DepartmentID = nil
+		return
+	}
+	user.Department = dept.Name
+	user.DepartmentID = &dept.ID
+}
+
+// respondDepartmentError 科室查找失败时的响应
+func respondDepartmentError(c *gin.Context, err error) {
+	if errors.Is(err, errDepartmentNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "查询科室失败"})
+}
+
+// GetDepartments 科室列表 (平铺，前端按 parent_id 组装树)
+// 参数: keyword (名称或编码), active (true/false), org_id (仅全局管理员)
+func GetDepartments(c *gin.Context) {
+	tx := database.DB.Order("org_id, code")
+	if c.GetString("role") == "global_admin" {
+		if v := c.Query("org_id"); v != "" {
+			tx = tx.Where("org_id = ?", v)
+		}
+	} else {
+		tx = tx.Where("org_id = ?", currentOrg(c))
+	}
+	if v := strings.TrimSpace(c.Query("keyword")); v != "" {
+		tx = tx.Where("name LIKE ? OR code LIKE ?", "%"+v+"%", "%"+v+"%")
+	}
+	if v := c.Query("active"); v != "" {
+		tx = tx.Where("active = ?", v == "true")
+	}
+
+	var depts []model.Department
+	if err := tx.Find(&depts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取科室列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": depts})
+}
+
+type DepartmentRequest struct {
+	Code     string `json:"code" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	ParentID *uint  `json:"parent_id"`
+	HeadID   *uint  `json:"head_id"`
+	Active   *bool  `json:"active"` // 不传默认启用
+	OrgID    uint   `json:"org_id"` // 仅全局管理员可指定，默认本机构
+}
+
+// CreateDepartment 新建科室
+func CreateDepartment(c *gin.Context) {
+	var req DepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	orgID := currentOrg(c)
+	if c.GetString("role") == "global_admin" && req.OrgID != 0 {
+		orgID = req.OrgID
+	}
+	dept := model.Department{OrgID: orgID, Active: true}
+	if !applyDepartmentRequest(c, &dept, req) {
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&dept).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "科室编码已存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "科室创建成功", "data": dept})
+}
+
+// UpdateDepartment 修改科室；改名时同步账号、挂号记录和科室授权上的名称
+func UpdateDepartment(c *gin.Context) {
+	var req DepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	dept, ok := manageableDepartment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	oldName := dept.Name
+	if !applyDepartmentRequest(c, &dept, req) {
+		return
+	}
+
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&dept).Error; err != nil {
+			return err
+		}
+		if dept.Name == oldName {
+			return nil
+		}
+		if err := tx.Model(&model.User{}).Unscoped().Where("department_id = ?", dept.ID).Update("department", dept.Name).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Booking{}).Where("department_id = ?", dept.ID).Update("department", dept.Name).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.RecordConsent{}).Where("department_id = ?", dept.ID).Update("department", dept.Name).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "更新失败，科室编码可能已存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "科室已更新", "data": dept})
+}
+
+// DeleteDepartment 删除科室 (仍有账号、挂号记录或下级科室的只能停用)
+func DeleteDepartment(c *gin.Context) {
+	dept, ok := manageableDepartment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var users, bookings, children int64
+	database.DB.Unscoped().Model(&model.User{}).Where("department_id = ?", dept.ID).Count(&users)
+	database.DB.Model(&model.Booking{}).Where("department_id = ?", dept.ID).Count(&bookings)
+	database.DB.Model(&model.Department{}).Where("parent_id = ?", dept.ID).Count(&children)
+	if users+bookings+children > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "科室下还有账号、挂号记录或下级科室，请改为停用或合并到其他科室"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Delete(&dept).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "删除成功"})
+}
+
+// MergeDepartment 把 source_id 科室 (例如历史数据里拼写错误的科室) 合并进当前科室
+// 账号、挂号记录、下级科室全部转到当前科室，原科室停用
+func MergeDepartment(c *gin.Context) {
+	var req struct {
+		SourceID uint `json:"source_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	target, ok := manageableDepartment(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	source, ok := manageableDepartment(c, req.SourceID)
+	if !ok {
+		return
+	}
+	if source.ID == target.ID || source.OrgID != target.OrgID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能合并同一机构内的两个不同科室"})
+		return
+	}
+	// 原科室的下级会挂到当前科室下，当前科室本身不能是原科室的下级
+	if err := checkDepartmentParent(source, &target.ID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能把上级科室合并进自己的下级科室"})
+		return
+	}
+
+	updates := map[string]interface{}{"department_id": target.ID, "department": target.Name}
+	err := database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Unscoped().Where("department_id = ?", source.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Booking{}).Where("department_id = ?", source.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Department{}).Where("parent_id = ?", source.ID).Update("parent_id", target.ID).Error; err != nil {
+			return err
+		}
+		// 患者对原科室的授权转给合并后的科室
+		if err := tx.Model(&model.RecordConsent{}).Where("department_id = ?", source.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.Model(&source).Update("active", false).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "合并失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "已将 " + source.Name + " 合并到 " + target.Name})
+}
+
+// manageableDepartment 查找科室，机构管理员只能管理本机构的科室；失败时直接写响应
+func manageableDepartment(c *gin.Context, id interface{}) (model.Department, bool) {
+	var dept model.Department
+	tx := database.DB
+	if c.GetString("role") != "global_admin" {
+		tx = tx.Where("org_id = ?", currentOrg(c))
+	}
+	if err := tx.First(&dept, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "科室不存在"})
+		return dept, false
+	}
+	return dept, true
+}
+
+// applyDepartmentRequest 校验请求并写入 dept；失败时直接写响应并返回 false
+func applyDepartmentRequest(c *gin.Context, dept *model.Department, req DepartmentRequest) bool {
+	dept.Code = strings.ToUpper(strings.TrimSpace(req.Code))
+	dept.Name = strings.TrimSpace(req.Name)
+	if dept.Code == "" || dept.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "科室编码和名称不能为空"})
+		return false
+	}
+	if req.Active != nil {
+		dept.Active = *req.Active
+	}
+
+	// 同一机构内名称也不能重复，否则按名称选科室时会有歧义
+	var dup int64
+	database.DB.Model(&model.Department{}).Where("org_id = ? AND name = ? AND id <> ?", dept.OrgID, dept.Name, dept.ID).Count(&dup)
+	if dup > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "科室名称已存在"})
+		return false
+	}
+
+	// 1. 上级科室：同机构，且不能形成环
+	if req.ParentID != nil && *req.ParentID == 0 {
+		req.ParentID = nil
+	}
+	if err := checkDepartmentParent(*dept, req.ParentID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	dept.ParentID = req.ParentID
+
+	// 2. 科室主任：同机构、启用中的医生
+	if req.HeadID != nil && *req.HeadID == 0 {
+		req.HeadID = nil
+	}
+	if req.HeadID != nil {
+		var head model.User
+		err := database.DB.Where("id = ? AND role = ? AND org_id = ? AND enabled = ?", *req.HeadID, "doctor", dept.OrgID, true).First(&head).Error
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "科室主任必须是本机构启用中的医生账号"})
+			return false
+		}
+	}
+	dept.HeadID = req.HeadID
+	return true
+}
+
+// checkDepartmentParent 检查把 parentID 设为 dept 的上级是否合法
+func checkDepartmentParent(dept model.Department, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	for depth, id := 0, *parentID; ; depth++ {
+		if dept.ID != 0 && id == dept.ID {
+			return errors.New("上级科室不能是自己或自己的下级科室")
+		}
+		if depth >= maxDepartmentDepth {
+			return errors.New("科室层级过深")
+		}
+		var parent model.Department
+		if err := database.DB.First(&parent, id).Error; err != nil || parent.OrgID != dept.OrgID {
+			return errors.New("上级科室不存在")
+		}
+		if parent.ParentID == nil {
+			return nil
+		}
+		id = *parent.ParentID
+	}
+}
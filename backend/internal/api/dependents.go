@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/credential"
+	"hospital-system/internal/database"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/idcard"
+	"hospital-system/internal/model"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 家属管理 (Dependents) ---
+// 对应路由：/api/v1/dashboard/dependents
+// 患者账号可以登记家属 (子女、父母等)，之后可以给家属挂号、缴费、查看就诊记录
+// 授权方式：
+//   - 未成年人：监护人声明具有监护权，满 18 周岁后自动失效
+//   - 成年人：必须由家属本人手机接收验证码确认
+//   - 医院已有档案的 (无论是否成年)：必须由档案登记的手机接收验证码确认，档案没有手机号的需到前台核验
+// 家属关系按档案 ID 生效，新建的档案里只有以后的就诊记录
+
+// 成年年龄
+const adultAge = 18
+
+var dependentRelationships = map[string]bool{"child": true, "parent": true, "spouse": true, "other": true}
+
+// activeDependent 查找某账号名下仍然有效的家属
+func activeDependent(guardianID, dependentID uint) (model.Dependent, bool) {
+	var dep model.Dependent
+	err := database.DB.
+		Where("id = ? AND guardian_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", dependentID, guardianID, time.Now()).
+		First(&dep).Error
+	return dep, err == nil
+}
+
+// GetDependents 查看自己登记的家属 (含已失效的)
+func GetDependents(c *gin.Context) {
+	var deps []model.Dependent
+	database.DB.Where("guardian_id = ?", c.GetUint("user_id")).Order("created_at desc").Find(&deps)
+	c.JSON(http.StatusOK, gin.H{"data": deps})
+}
+
+// SendDependentCode 给成年家属的手机发送授权验证码
+func SendDependentCode(c *gin.Context) {
+	var req SMSCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	err := credential.SendPhoneCode(c.Request.Context(), database.DB.WithContext(c.Request.Context()), req.Phone, credential.PurposeDependentConsent)
+	if err != nil {
+		var policyErr credential.PolicyError
+		if errors.As(err, &policyErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证码发送失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "验证码已发送到家属手机"})
+}
+
+type DependentRequest struct {
+	RealName     string `json:"real_name" binding:"required"`
+	IDCard       string `json:"id_card" binding:"required"`
+	Relationship string `json:"relationship" binding:"required"` // child, parent, spouse, other
+	// 未成年人：监护人声明
+	GuardianConfirmed bool `json:"guardian_confirmed"`
+	// 成年人：家属本人手机验证
+	Phone   string `json:"phone"`
+	SMSCode string `json:"sms_code"`
+}
+
+// CreateDependent 登记家属
+func CreateDependent(c *gin.Context) {
+	var req DependentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	req.RealName = strings.TrimSpace(req.RealName)
+	if !dependentRelationships[req.Relationship] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "关系只能是 child / parent / spouse / other"})
+		return
+	}
+
+	var currentUser model.User
+	if err := database.DB.First(&currentUser, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+
+	// 1. 身份证校验
+	info, err := idcard.Parse(req.IDCard)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. 已有档案：核对姓名，不能登记自己，不能重复登记
+	var patient model.Patient
+	err = database.DB.Where("id_card_hash = ?", fieldcrypt.BlindIndex(info.Number)).First(&patient).Error
+	exists := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询患者档案失败"})
+		return
+	}
+	if exists {
+		if patient.Name != req.RealName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errNameMismatch.Error()})
+			return
+		}
+		if currentUser.PatientID != nil && *currentUser.PatientID == patient.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不能把自己登记为家属"})
+			return
+		}
+		var dup int64
+		database.DB.Table("(?) AS d", dependentPatients(currentUser.ID)).Where("d.patient_id = ?", patient.ID).Count(&dup)
+		if dup > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "该家属已登记"})
+			return
+		}
+	}
+
+	// 3. 授权方式
+	dep := model.Dependent{
+		GuardianID:   currentUser.ID,
+		PatientName:  req.RealName,
+		Relationship: req.Relationship,
+		CreatedAt:    time.Now(),
+	}
+	adultAt := info.BirthDate.AddDate(adultAge, 0, 0)
+	minor := time.Now().Before(adultAt)
+	db := database.DB.WithContext(c.Request.Context())
+
+	// 3.1 已有档案里有以往的就诊记录，不能只凭声明和身份证号查看：验证码必须发到档案登记的手机
+	if exists {
+		if patient.Phone == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "该家属的档案未登记手机号，请携带关系证明到前台办理"})
+			return
+		}
+		if req.Phone != patient.Phone {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请使用家属档案登记的手机号接收验证码"})
+			return
+		}
+	}
+
+	if minor {
+		// 3.2 未成年人：监护人声明，满 18 周岁失效
+		if !req.GuardianConfirmed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请确认您是该未成年人的监护人"})
+			return
+		}
+		dep.ConsentMethod = "guardian"
+		dep.ExpiresAt = &adultAt
+	} else if req.Phone == "" || req.SMSCode == "" {
+		// 3.3 成年人：验证码发到家属本人手机
+		c.JSON(http.StatusBadRequest, gin.H{"error": "成年家属需要本人手机验证码确认授权"})
+		return
+	}
+
+	if exists || !minor {
+		if req.SMSCode == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请填写家属手机收到的验证码"})
+			return
+		}
+		// 档案登记的手机以档案为准 (未成年人的档案常登记监护人的手机)，新建档案的成年人必须用本人的手机
+		if ownPhone := ownPatientPhone(currentUser); !exists && ownPhone != "" && ownPhone == req.Phone {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请使用家属本人的手机号"})
+			return
+		}
+		if err := credential.VerifyPhoneCode(db, req.Phone, credential.PurposeDependentConsent, req.SMSCode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		dep.ConsentMethod = "sms"
+	}
+
+	// 4. 没有档案的新建档案
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if !exists {
+			patient = model.Patient{
+				Name:      req.RealName,
+				Phone:     req.Phone,
+				IDCard:    info.Number,
+				Gender:    info.Gender,
+				BirthDate: &info.BirthDate,
+			}
+			if err := tx.Create(&patient).Error; err != nil {
+				return err
+			}
+		}
+		dep.PatientID = patient.ID
+		return tx.Create(&dep).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登记家属失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "家属登记成功", "data": dep})
+}
+
+// RevokeDependent 解除家属关系
+func RevokeDependent(c *gin.Context) {
+	var dep model.Dependent
+	err := database.DB.Where("id = ? AND guardian_id = ? AND revoked_at IS NULL", c.Param("id"), c.GetUint("user_id")).
+		First(&dep).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "家属不存在"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.WithContext(c.Request.Context()).Model(&dep).Update("revoked_at", &now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "已解除家属关系"})
+}
+
+// ownPatientPhone 账号本人档案上的手机号
+func ownPatientPhone(user model.User) string {
+	if user.PatientID == nil {
+		return ""
+	}
+	var patient model.Patient
+	if err := database.DB.First(&patient, *user.PatientID).Error; err != nil {
+		return ""
+	}
+	return patient.Phone
+}
+
+// ageOn 计算周岁
+func ageOn(birth, now time.Time) int {
+	age := now.Year() - birth.Year()
+	if now.Month() < birth.Month() || (now.Month() == birth.Month() && now.Day() < birth.Day()) {
+		age--
+	}
+	return age
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// withCheckDigit 给身份证号前 17 位补上校验码
+func withCheckDigit(first17 string) string {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(first17[i]-'0') * w
+	}
+	return first17 + string("10X98765432"[sum%11])
+}
+
+// seedGuardian 一位有档案的患者账号
+func seedGuardian(t *testing.T, db *gorm.DB) model.User {
+	t.Helper()
+	self := model.Patient{Name: "赵六", Phone: "13800000001"}
+	if err := db.Create(&self).Error; err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Username: "zhaoliu", Password: "x", Role: "general_user", PatientID: &self.ID, OrgID: 1, Enabled: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// ownBookings 以患者账号查看挂号列表，返回挂号 ID
+func ownBookings(t *testing.T, user model.User) map[uint]bool {
+	t.Helper()
+	w := as(user).get(t, GetBookings, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []model.Booking `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[uint]bool)
+	for _, b := range resp.Data {
+		ids[b.ID] = true
+	}
+	return ids
+}
+
+// 用一个没有档案的身份证号登记同名的未成年家属，只会新建档案，看不到同名患者的就诊记录
+func TestDependentWithNewRecordDoesNotSeeNamesake(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		guardian := seedGuardian(t, db)
+		namesake := model.Patient{Name: "赵小明", IDCard: withCheckDigit("11010520150101003")}
+		db.Create(&namesake)
+		visit := model.Booking{PatientName: "赵小明", PatientID: &namesake.ID, DoctorID: 1, Status: "Completed"}
+		db.Create(&visit)
+
+		w := as(guardian).call(t, CreateDependent, http.MethodPost, map[string]interface{}{
+			"real_name": "赵小明", "id_card": withCheckDigit("11010520160202001"),
+			"relationship": "child", "guardian_confirmed": true,
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("登记失败 %d: %s", w.Code, w.Body.String())
+		}
+		var dep model.Dependent
+		db.First(&dep)
+		if dep.PatientID == namesake.ID {
+			t.Fatalf("不应关联到同名患者的档案")
+		}
+
+		if ids := ownBookings(t, guardian); ids[visit.ID] {
+			t.Fatalf("不应看到同名患者的挂号")
+		}
+		if basis, _ := patientAccessBasis(guardian, namesake.ID); basis != "" {
+			t.Fatalf("同名患者的访问依据 = %q, 期望无权", basis)
+		}
+	})
+}
+
+// 已有档案的未成年人：只有监护人声明不够，要档案登记的手机验证码；档案没有手机号的需到前台
+func TestDependentWithExistingRecordNeedsRecordPhone(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		sent := useSMS(t)
+		guardian := seedGuardian(t, db)
+		idCard := withCheckDigit("11010520150101003")
+		child := model.Patient{Name: "赵小明", Phone: "13900000002", IDCard: idCard}
+		db.Create(&child)
+		visit := model.Booking{PatientName: "赵小明", PatientID: &child.ID, DoctorID: 1, Status: "Completed"}
+		db.Create(&visit)
+
+		body := map[string]interface{}{"real_name": "赵小明", "id_card": idCard, "relationship": "child", "guardian_confirmed": true}
+		if w := as(guardian).call(t, CreateDependent, http.MethodPost, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("只有监护人声明: 状态码 %d, 期望 400", w.Code)
+		}
+		body["phone"] = "13700000003"
+		if w := as(guardian).call(t, CreateDependent, http.MethodPost, body); w.Code != http.StatusBadRequest {
+			t.Fatalf("手机号与档案不一致: 状态码 %d, 期望 400", w.Code)
+		}
+
+		body["phone"] = child.Phone
+		if w := as(guardian).call(t, SendDependentCode, http.MethodPost, map[string]string{"phone": child.Phone}); w.Code != http.StatusOK {
+			t.Fatalf("发送验证码失败 %d: %s", w.Code, w.Body.String())
+		}
+		body["sms_code"] = sent[child.Phone]
+		if w := as(guardian).call(t, CreateDependent, http.MethodPost, body); w.Code != http.StatusOK {
+			t.Fatalf("登记失败 %d: %s", w.Code, w.Body.String())
+		}
+		if ids := ownBookings(t, guardian); !ids[visit.ID] {
+			t.Fatalf("登记后应能看到家属的挂号")
+		}
+
+		// 没有手机号的档案
+		noPhoneID := withCheckDigit("11010520170303002")
+		db.Create(&model.Patient{Name: "赵小红", IDCard: noPhoneID})
+		w := as(guardian).call(t, CreateDependent, http.MethodPost, map[string]interface{}{
+			"real_name": "赵小红", "id_card": noPhoneID, "relationship": "child", "guardian_confirmed": true,
+		})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("档案没有手机号: 状态码 %d, 期望 400", w.Code)
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package api
+
+import (
+	"encoding/json"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 医生执业信息与公开医生目录 ---
+// 对应路由：GET /api/v1/doctors、GET /api/v1/doctors/:id (无需登录，患者挂号前选择医生)
+//          GET/PUT /api/v1/dashboard/doctor/profile (医生维护自己的简介、擅长、照片、出诊日)
+//          PUT /api/v1/dashboard/users/:id/doctor_profile (管理员维护全部信息，包括姓名、职称、挂号费)
+// 只有建立了执业信息、且账号启用中的医生会出现在公开目录里 (目录不暴露登录用户名)
+
+// 职称
+var doctorTitles = map[string]bool{"主任医师": true, "副主任医师": true, "主治医师": true, "住院医师": true, "医师": true}
+
+const (
+	maxSpecialties    = 10
+	maxSpecialtyLen   = 20
+	maxBioLen         = 2000
+	maxConsultFee     = 10000
+	maxDoctorNameLen  = 32
+	maxPhotoURLLength = 512
+)
+
+// DoctorCard 公开目录中的医生信息
+type DoctorCard struct {
+	ID              uint     `json:"id"`
+	Name            string   `json:"name"`
+	Title           string   `json:"title"`
+	DepartmentID    *uint    `json:"department_id"`
+	Department      string   `json:"department"`
+	Specialties     []string `json:"specialties"`
+	Bio             string   `json:"bio"`
+	PhotoURL        string   `json:"photo_url"`
+	ConsultationFee float64  `json:"consultation_fee"`
+	AvailableDays   []int    `json:"available_days"`
+}
+
+// DoctorOption 下拉框用的医生信息 (登录后可见)
+type DoctorOption struct {
+	ID           uint   `json:"id"`
+	Username     string `json:"username"`
+	Name         string `json:"name"`
+	Title        string `json:"title"`
+	DepartmentID *uint  `json:"department_id"`
+	Department   string `json:"department"`
+}
+
+// GetDoctorList 专门用于下拉框的医生列表接口 (公开给登录用户)
+// 只返回启用中的医生，不再返回账号的其他字段
+func GetDoctorList(c *gin.Context) {
+	var doctors []DoctorOption
+	database.DB.Model(&model.User{}).
+		Select("users.id, users.username, users.department_id, users.department, COALESCE(doctor_profiles.name, '') AS name, COALESCE(doctor_profiles.title, '') AS title").
+		Joins("LEFT JOIN doctor_profiles ON doctor_profiles.user_id = users.id").
+		Where("users.role = ? AND users.enabled = ?", "doctor", true).
+		Order("users.id").
+		Scan(&doctors)
+	c.JSON(http.StatusOK, gin.H{"data": doctors})
+}
+
+// GetDoctorDirectory 公开医生目录
+// 参数: department_id, department (名称), specialty (擅长), keyword (姓名), page, page_size
+func GetDoctorDirectory(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tx := publicDoctors()
+	if v := c.Query("department_id"); v != "" {
+		tx = tx.Where("users.department_id = ?", v)
+	}
+	if v := strings.TrimSpace(c.Query("department")); v != "" {
+		tx = tx.Where("users.department = ?", v)
+	}
+	if v := strings.TrimSpace(c.Query("specialty")); v != "" {
+		// 擅长领域按 JSON 数组存储，匹配带引号的完整元素
+		quoted, _ := json.Marshal(v)
+		tx = tx.Where("doctor_profiles.specialties LIKE ?", "%"+string(quoted)+"%")
+	}
+	if v := strings.TrimSpace(c.Query("keyword")); v != "" {
+		tx = tx.Where("doctor_profiles.name LIKE ?", "%"+v+"%")
+	}
+
+	var total int64
+	tx.Count(&total)
+
+	var profiles []model.DoctorProfile
+	if err := tx.Order("doctor_profiles.user_id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&profiles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取医生列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": doctorCards(profiles), "total": total, "page": page, "page_size": pageSize})
+}
+
+// GetDoctorDetail 公开医生详情
+func GetDoctorDetail(c *gin.Context) {
+	var profile model.DoctorProfile
+	if err := publicDoctors().Where("doctor_profiles.user_id = ?", c.Param("id")).First(&profile).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "医生不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": doctorCards([]model.DoctorProfile{profile})[0]})
+}
+
+// publicDoctors 可以公开展示的医生 (有执业信息、账号启用中且未删除)
+func publicDoctors() *gorm.DB {
+	return database.DB.Model(&model.DoctorProfile{}).
+		Joins("JOIN users ON users.id = doctor_profiles.user_id").
+		Where("users.role = ? AND users.enabled = ? AND users.deleted_at IS NULL", "doctor", true)
+}
+
+// doctorCards 补上科室信息
+func doctorCards(profiles []model.DoctorProfile) []DoctorCard {
+	ids := make([]uint, 0, len(profiles))
+	for _, p := range profiles {
+		ids = append(ids, p.UserID)
+	}
+	var users []model.User
+	database.DB.Select("id", "department_id", "department").Where("id IN ?", ids).Find(&users)
+	byID := make(map[uint]model.User, len(users))
+	for _, u := range users {
+		byID[u.ID] = u
+	}
+
+	cards := make([]DoctorCard, 0, len(profiles))
+	for _, p := range profiles {
+		u := byID[p.UserID]
+		cards = append(cards, DoctorCard{
+			ID:              p.UserID,
+			Name:            p.Name,
+			Title:           p.Title,
+			DepartmentID:    u.DepartmentID,
+			Department:      u.Department,
+			Specialties:     nonNilStrings(p.Specialties),
+			Bio:             p.Bio,
+			PhotoURL:        p.PhotoURL,
+			ConsultationFee: p.ConsultationFee,
+			AvailableDays:   nonNilInts(p.AvailableDays),
+		})
+	}
+	return cards
+}
+
+// DoctorProfileRequest 修改执业信息，不传的字段保持不变
+// 医生本人只能改 specialties / bio / photo_url / available_days
+type DoctorProfileRequest struct {
+	Name            *string   `json:"name"`
+	Title           *string   `json:"title"`
+	Specialties     *[]string `json:"specialties"`
+	Bio             *string   `json:"bio"`
+	PhotoURL        *string   `json:"photo_url"`
+	ConsultationFee *float64  `json:"consultation_fee"`
+	AvailableDays   *[]int    `json:"available_days"`
+}
+
+// GetMyDoctorProfile 医生查看自己的执业信息
+func GetMyDoctorProfile(c *gin.Context) {
+	var profile model.DoctorProfile
+	if err := database.DB.First(&profile, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "执业信息尚未由管理员建立"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": profile})
+}
+
+// UpdateMyDoctorProfile 医生修改自己的简介、擅长、照片和出诊日
+func UpdateMyDoctorProfile(c *gin.Context) {
+	var req DoctorProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	if req.Name != nil || req.Title != nil || req.ConsultationFee != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "姓名、职称和挂号费需要由管理员修改"})
+		return
+	}
+
+	var profile model.DoctorProfile
+	if err := database.DB.First(&profile, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "执业信息尚未由管理员建立"})
+		return
+	}
+	if msg := applyDoctorProfile(&profile, req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Save(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "执业信息已更新", "data": profile})
+}
+
+// UpdateDoctorProfile 管理员建立 / 修改医生执业信息
+// 对应路由: PUT /api/v1/dashboard/users/:id/doctor_profile
+func UpdateDoctorProfile(c *gin.Context) {
+	var req DoctorProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	user, ok := manageableUser(c, false)
+	if !ok {
+		return
+	}
+	if user.Role != "doctor" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只有医生账号可以设置执业信息"})
+		return
+	}
+
+	// 不存在时新建 (First 失败时 profile 保持零值)
+	var profile model.DoctorProfile
+	database.DB.First(&profile, user.ID)
+	profile.UserID = user.ID
+	if msg := applyDoctorProfile(&profile, req); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if profile.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写医生姓名"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Save(&profile).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "执业信息已保存", "data": profile})
+}
+
+// applyDoctorProfile 校验并写入请求中传了的字段，返回错误提示 (空字符串表示通过)
+func applyDoctorProfile(p *model.DoctorProfile, req DoctorProfileRequest) string {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if len([]rune(name)) > maxDoctorNameLen {
+			return "姓名过长"
+		}
+		p.Name = name
+	}
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title != "" && !doctorTitles[title] {
+			return "职称只能是 主任医师 / 副主任医师 / 主治医师 / 住院医师 / 医师"
+		}
+		p.Title = title
+	}
+	if req.Specialties != nil {
+		var list []string
+		seen := make(map[string]bool)
+		for _, s := range *req.Specialties {
+			s = strings.TrimSpace(s)
+			if s == "" || seen[s] {
+				continue
+			}
+			if len([]rune(s)) > maxSpecialtyLen {
+				return "单个擅长领域不能超过 20 个字"
+			}
+			seen[s] = true
+			list = append(list, s)
+		}
+		if len(list) > maxSpecialties {
+			return "擅长领域最多 10 个"
+		}
+		p.Specialties = list
+	}
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if len([]rune(bio)) > maxBioLen {
+			return "简介不能超过 2000 字"
+		}
+		p.Bio = bio
+	}
+	if req.PhotoURL != nil {
+		photo := strings.TrimSpace(*req.PhotoURL)
+		if photo != "" && !validPhotoURL(photo) {
+			return "照片地址无效"
+		}
+		p.PhotoURL = photo
+	}
+	if req.ConsultationFee != nil {
+		if *req.ConsultationFee < 0 || *req.ConsultationFee > maxConsultFee {
+			return "挂号费金额无效"
+		}
+		p.ConsultationFee = *req.ConsultationFee
+	}
+	if req.AvailableDays != nil {
+		seen := make(map[int]bool)
+		days := []int{}
+		for _, d := range *req.AvailableDays {
+			if d < 0 || d > 6 {
+				return "出诊日只能是 0 (周日) 到 6 (周六)"
+			}
+			if !seen[d] {
+				seen[d] = true
+				days = append(days, d)
+			}
+		}
+		sort.Ints(days)
+		p.AvailableDays = days
+	}
+	return ""
+}
+
+// validPhotoURL 照片只能是本站上传的相对路径或 http(s) 地址 (防止 javascript: 之类的地址)
+func validPhotoURL(s string) bool {
+	if len(s) > maxPhotoURLLength {
+		return false
+	}
+	if strings.HasPrefix(s, "/") && !strings.HasPrefix(s, "//") {
+		return true
+	}
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func nonNilInts(s []int) []int {
+	if s == nil {
+		return []int{}
+	}
+	return s
+}
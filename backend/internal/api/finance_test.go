@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 今日收入按服务器时区的自然日 [今天 0 点, 明天 0 点) 统计，两种数据库结果一致
+func TestGetFinanceStatsDateRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		orders := []model.Order{
+			{TotalAmount: 100, Status: "Paid", CreatedAt: today},                       // 今天第一刻
+			{TotalAmount: 20.5, Status: "Paid", CreatedAt: today.Add(12 * time.Hour)},  // 今天中午
+			{TotalAmount: 7, Status: "Paid", CreatedAt: today.Add(-time.Second)},       // 昨天最后一秒
+			{TotalAmount: 9, Status: "Paid", CreatedAt: today.AddDate(0, 0, 1)},        // 明天第一刻
+			{TotalAmount: 1000, Status: "Unpaid", CreatedAt: today.Add(8 * time.Hour)}, // 未缴费
+			{TotalAmount: 3.5, Status: "Paid", CreatedAt: today.AddDate(0, 0, -30)},    // 一个月前
+		}
+		if err := db.Create(&orders).Error; err != nil {
+			t.Fatalf("创建订单失败: %v", err)
+		}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/dashboard/finance/stats", nil)
+		GetFinanceStats(c)
+		if w.Code != http.StatusOK {
+			t.Fatalf("状态码 %d: %s", w.Code, w.Body.String())
+		}
+
+		var got struct {
+			TotalIncome float64 `json:"total_income"`
+			TodayIncome float64 `json:"today_income"`
+			OrderCount  int64   `json:"order_count"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.TodayIncome != 120.5 {
+			t.Errorf("今日收入 = %v, 期望 120.5", got.TodayIncome)
+		}
+		if got.TotalIncome != 140 {
+			t.Errorf("总收入 = %v, 期望 140", got.TotalIncome)
+		}
+		if got.OrderCount != 5 {
+			t.Errorf("已缴费订单数 = %d, 期望 5", got.OrderCount)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/sms"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// useDB 把测试库设为全局 database.DB，测试结束后恢复
+func useDB(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	old := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = old })
+}
+
+// useConfig 以默认配置加上 overrides (例如 "auth.lockout.max_attempts=3") 作为当前配置
+func useConfig(t *testing.T, overrides ...string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(path, overrides...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useFieldKeys 生成并加载临时的字段加密密钥 (病历、档案等加密字段需要)
+func useFieldKeys(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := fieldcrypt.Generate(dir); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := fieldcrypt.Load(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldcrypt.Use(keys)
+	t.Cleanup(func() { fieldcrypt.Use(nil) })
+}
+
+// sentSMS 测试中发出的短信，按手机号记录最近一条验证码
+type sentSMS map[string]string
+
+var smsCode = regexp.MustCompile(`验证码为 (\d{6})`)
+
+func (s sentSMS) Send(ctx context.Context, phone, message string) error {
+	if m := smsCode.FindStringSubmatch(message); m != nil {
+		s[phone] = m[1]
+	}
+	return nil
+}
+
+// useSMS 截获短信发送，返回收到的验证码
+func useSMS(t *testing.T) sentSMS {
+	t.Helper()
+	sent := sentSMS{}
+	old := sms.Default
+	sms.Default = sent
+	t.Cleanup(func() { sms.Default = old })
+	return sent
+}
+
+// caller 以某个登录身份调用 handler
+type caller struct {
+	UserID uint
+	Role   string
+	OrgID  uint
+}
+
+// call 调用 handler，body 为 nil 时不带请求体；params 为路径参数 (例如 "id", "3")
+func (u caller) call(t *testing.T, handler gin.HandlerFunc, method string, body interface{}, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	return u.request(t, handler, method, "/", body, params...)
+}
+
+// get 以 GET 调用 handler，query 为查询串 (例如 "patient_id=3")
+func (u caller) get(t *testing.T, handler gin.HandlerFunc, query string, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	return u.request(t, handler, http.MethodGet, "/?"+query, nil, params...)
+}
+
+func (u caller) request(t *testing.T, handler gin.HandlerFunc, method, target string, body interface{}, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Request = httptest.NewRequest(method, target, &buf)
+	c.Request.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(params); i += 2 {
+		c.Params = append(c.Params, gin.Param{Key: params[i], Value: params[i+1]})
+	}
+	c.Set("user_id", u.UserID)
+	c.Set("role", u.Role)
+	c.Set("org_id", u.OrgID)
+
+	handler(c)
+	return w
+}
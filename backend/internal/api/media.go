@@ -0,0 +1,436 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/media"
+	"hospital-system/internal/model"
+	"hospital-system/internal/scan"
+	"hospital-system/internal/storage"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 上传文件 (医院图片、医生照片、病历附件) ---
+// 对应路由：POST   /api/v1/dashboard/media (multipart: file, category, title, owner_id, sort_order)
+//          GET    /api/v1/dashboard/media?category=&owner_id=
+//          PUT    /api/v1/dashboard/media/:id
+//          DELETE /api/v1/dashboard/media/:id
+//          GET    /uploads/*key (只对外提供医院图片和医生照片)
+// 文件类型按内容识别并经过安全扫描，图片会生成缩略图 (key 后加 _thumb)
+
+// 文件分类
+const (
+	mediaHospital = "hospital" // 医院图片 (首页轮播)
+	mediaDoctor   = "doctor"   // 医生照片
+	mediaRecord   = "record"   // 病历附件，不公开访问
+)
+
+// 缩略图长边像素
+const thumbSize = 320
+
+// mediaCategory 每类文件允许的类型和是否可以公开访问
+type mediaCategory struct {
+	public   bool
+	allowPDF bool
+}
+
+var mediaCategories = map[string]mediaCategory{
+	mediaHospital: {public: true},
+	mediaDoctor:   {public: true},
+	mediaRecord:   {allowPDF: true},
+}
+
+var errUploadTooLarge = errors.New("文件过大")
+
+// MediaItem 返回给前端的文件信息
+type MediaItem struct {
+	model.MediaFile
+	URL      string `json:"url"`
+	ThumbURL string `json:"thumb_url"`
+}
+
+func mediaItem(m model.MediaFile) MediaItem {
+	item := MediaItem{MediaFile: m, URL: "/uploads/" + m.Key}
+	if m.ThumbKey != "" {
+		item.ThumbURL = "/uploads/" + m.ThumbKey
+	}
+	return item
+}
+
+// uploadLimit 单个文件大小上限 (字节)
+func uploadLimit(contentType string) int64 {
+	cfg := config.Get().Storage
+	if media.IsImage(contentType) {
+		if cfg.MaxImageMB > 0 {
+			return int64(cfg.MaxImageMB) << 20
+		}
+		return 5 << 20
+	}
+	if cfg.MaxFileMB > 0 {
+		return int64(cfg.MaxFileMB) << 20
+	}
+	return 20 << 20
+}
+
+// readUpload 读入上传的文件，超过所有类型的最大上限时直接拒绝
+func readUpload(fh *multipart.FileHeader) ([]byte, error) {
+	limit := max(uploadLimit(media.TypeJPEG), uploadLimit(media.TypePDF))
+	if fh.Size > limit {
+		return nil, errUploadTooLarge
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errUploadTooLarge
+	}
+	return data, nil
+}
+
+// storeUpload 校验上传文件并写入存储，返回尚未入库的记录
+// 出错时已写入存储的内容会被清理，返回的 status 可直接用于响应
+func storeUpload(ctx context.Context, category string, fh *multipart.FileHeader) (model.MediaFile, int, error) {
+	rule := mediaCategories[category]
+
+	// 1. 读取内容，按内容识别类型
+	data, err := readUpload(fh)
+	if errors.Is(err, errUploadTooLarge) {
+		return model.MediaFile{}, http.StatusRequestEntityTooLarge, err
+	}
+	if err != nil {
+		return model.MediaFile{}, http.StatusBadRequest, errors.New("读取上传文件失败")
+	}
+	contentType := media.Sniff(data)
+	if !media.IsImage(contentType) && !(rule.allowPDF && contentType == media.TypePDF) {
+		if rule.allowPDF {
+			return model.MediaFile{}, http.StatusUnsupportedMediaType, errors.New("只支持 JPG、PNG、GIF 图片或 PDF 文件")
+		}
+		return model.MediaFile{}, http.StatusUnsupportedMediaType, errors.New("只支持 JPG、PNG、GIF 图片")
+	}
+	if int64(len(data)) > uploadLimit(contentType) {
+		return model.MediaFile{}, http.StatusRequestEntityTooLarge, errUploadTooLarge
+	}
+
+	// 2. 安全扫描，未通过的文件不会写入存储
+	result, err := scan.Default.Scan(ctx, fh.Filename, bytes.NewReader(data))
+	if err != nil {
+		logging.Errorf("文件扫描失败: %v", err)
+		return model.MediaFile{}, http.StatusServiceUnavailable, errors.New("文件安全扫描暂不可用，请稍后再试")
+	}
+	if result.Infected {
+		logging.Warnf("上传文件 %q 未通过安全扫描: %s", fh.Filename, result.Threat)
+		return model.MediaFile{}, http.StatusUnprocessableEntity, errors.New("文件未通过安全扫描")
+	}
+
+	sum := sha256.Sum256(data)
+	m := model.MediaFile{
+		Category:     category,
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		SHA256:       hex.EncodeToString(sum[:]),
+		OriginalName: path.Base(strings.ReplaceAll(fh.Filename, "\\", "/")),
+	}
+
+	// 3. 图片检查尺寸并生成缩略图
+	var thumb []byte
+	var thumbType string
+	if media.IsImage(contentType) {
+		if m.Width, m.Height, err = media.Inspect(data); err != nil {
+			return model.MediaFile{}, http.StatusBadRequest, err
+		}
+		if thumb, thumbType, err = media.Thumbnail(data, thumbSize); err != nil {
+			return model.MediaFile{}, http.StatusBadRequest, err
+		}
+	}
+
+	// 4. 生成随机文件名，按分类和月份分目录
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return model.MediaFile{}, http.StatusInternalServerError, errors.New("生成文件名失败")
+	}
+	base := category + "/" + time.Now().Format("2006/01") + "/" + hex.EncodeToString(buf)
+	m.Key = base + media.Extension(contentType)
+
+	// 5. 写入存储
+	if err := storage.Default.Put(ctx, m.Key, bytes.NewReader(data), m.Size, contentType); err != nil {
+		logging.Errorf("保存上传文件失败: %v", err)
+		return model.MediaFile{}, http.StatusInternalServerError, errors.New("保存文件失败")
+	}
+	if thumb != nil {
+		m.ThumbKey = base + "_thumb" + media.Extension(thumbType)
+		if err := storage.Default.Put(ctx, m.ThumbKey, bytes.NewReader(thumb), int64(len(thumb)), thumbType); err != nil {
+			logging.Warnf("保存缩略图失败: %v", err)
+			removeStored(ctx, m)
+			return model.MediaFile{}, http.StatusInternalServerError, errors.New("保存文件失败")
+		}
+	}
+	return m, http.StatusOK, nil
+}
+
+// removeStored 删除存储中的文件和缩略图 (失败只记日志，不影响业务)
+func removeStored(ctx context.Context, m model.MediaFile) {
+	for _, key := range []string{m.Key, m.ThumbKey} {
+		if key == "" {
+			continue
+		}
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			logging.Warnf("删除文件 %s 失败: %v", key, err)
+		}
+	}
+}
+
+// UploadMedia 管理员上传医院图片或医生照片
+// 医生照片需要 owner_id (医生账号)，上传后自动设为该医生的照片
+// 病历附件不走这里，由病历模块上传并做访问控制
+func UploadMedia(c *gin.Context) {
+	category := c.PostForm("category")
+	if category != mediaHospital && category != mediaDoctor {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "category 只能是 hospital 或 doctor"})
+		return
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传文件"})
+		return
+	}
+	sortOrder, _ := strconv.Atoi(c.PostForm("sort_order"))
+
+	// 1. 医生照片先确认医生账号可以管理
+	var owner *model.User
+	if category == mediaDoctor {
+		var user model.User
+		if err := scopeUsers(c, database.DB).First(&user, c.PostForm("owner_id")).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请指定医生账号 (owner_id)"})
+			return
+		}
+		if user.Role != "doctor" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "只能为医生账号上传照片"})
+			return
+		}
+		owner = &user
+	}
+
+	// 2. 校验并写入存储
+	ctx := c.Request.Context()
+	m, status, err := storeUpload(ctx, category, fh)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	m.Title = strings.TrimSpace(c.PostForm("title"))
+	m.SortOrder = sortOrder
+	m.UploadedBy = c.GetUint("user_id")
+	m.OrgID = currentOrg(c)
+	if owner != nil {
+		m.OwnerID = &owner.ID
+		if owner.OrgID != 0 {
+			m.OrgID = owner.OrgID
+		}
+	}
+
+	// 3. 入库，医生照片同时更新执业信息 (还没有执业信息时只保存文件)
+	db := database.DB.WithContext(ctx)
+	if err := db.Create(&m).Error; err != nil {
+		removeStored(ctx, m)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	item := mediaItem(m)
+	if owner != nil {
+		var profile model.DoctorProfile
+		if db.First(&profile, owner.ID).Error == nil {
+			profile.PhotoURL = item.URL
+			db.Save(&profile)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "上传成功", "data": item})
+}
+
+// GetMediaList 上传文件列表
+// 参数: category, owner_id, page, page_size
+func GetMediaList(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// 病历附件只能通过病历查看
+	tx := scopeMedia(c, database.DB.Model(&model.MediaFile{})).Where("category IN ?", []string{mediaHospital, mediaDoctor})
+	if v := c.Query("category"); v != "" {
+		tx = tx.Where("category = ?", v)
+	}
+	if v := c.Query("owner_id"); v != "" {
+		tx = tx.Where("owner_id = ?", v)
+	}
+
+	var total int64
+	tx.Count(&total)
+
+	var files []model.MediaFile
+	if err := tx.Order("category, sort_order, id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取文件列表失败"})
+		return
+	}
+	items := make([]MediaItem, 0, len(files))
+	for _, f := range files {
+		items = append(items, mediaItem(f))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": items, "total": total, "page": page, "page_size": pageSize})
+}
+
+// scopeMedia 机构管理员只能看到本机构的文件，全局管理员不限
+func scopeMedia(c *gin.Context, tx *gorm.DB) *gorm.DB {
+	if c.GetString("role") != "global_admin" {
+		tx = tx.Where("org_id = ?", currentOrg(c))
+	}
+	return tx
+}
+
+// manageableMedia 按路由参数 :id 找到可以在这里管理的文件 (不含病历附件、其他机构的文件)
+func manageableMedia(c *gin.Context) (model.MediaFile, bool) {
+	var m model.MediaFile
+	if err := scopeMedia(c, database.DB).Where("category <> ?", mediaRecord).First(&m, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return m, false
+	}
+	return m, true
+}
+
+// MediaUpdateRequest 修改标题 / 排序
+type MediaUpdateRequest struct {
+	Title     *string `json:"title"`
+	SortOrder *int    `json:"sort_order"`
+}
+
+// UpdateMedia 修改文件标题和排序 (内容不可修改，需要换图请重新上传)
+func UpdateMedia(c *gin.Context) {
+	var req MediaUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	m, ok := manageableMedia(c)
+	if !ok {
+		return
+	}
+	if req.Title != nil {
+		m.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.SortOrder != nil {
+		m.SortOrder = *req.SortOrder
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Save(&m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "已更新", "data": mediaItem(m)})
+}
+
+// DeleteMedia 删除文件，正在用作医生照片的同时清空
+func DeleteMedia(c *gin.Context) {
+	m, ok := manageableMedia(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+	db := database.DB.WithContext(ctx)
+	if err := db.Delete(&m).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	db.Model(&model.DoctorProfile{}).Where("photo_url = ?", mediaItem(m).URL).Update("photo_url", "")
+	removeStored(ctx, m)
+	c.JSON(http.StatusOK, gin.H{"msg": "已删除"})
+}
+
+// ServeUpload 对外提供医院图片和医生照片
+// 对应路由：GET /uploads/*key
+// 只认数据库里登记过的公开文件；文件名随机且内容不会变，可以长期缓存
+func ServeUpload(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if _, err := storage.CleanKey(key); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	var m model.MediaFile
+	if err := database.DB.Where("key = ? OR thumb_key = ?", key, key).First(&m).Error; err != nil ||
+		!mediaCategories[m.Category].public {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	// 缩略图只有 PNG 和 JPEG 两种
+	contentType := m.ContentType
+	if key == m.ThumbKey {
+		contentType = media.TypeJPEG
+		if path.Ext(key) == ".png" {
+			contentType = media.TypePNG
+		}
+	}
+
+	f, err := storage.Default.Open(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logging.Warnf("读取文件 %s 失败: %v", key, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	etag := `"` + m.SHA256 + `"`
+	if key == m.ThumbKey {
+		etag = `"` + m.SHA256 + `-thumb"`
+	}
+	h := c.Writer.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	h.Set("ETag", etag)
+	h.Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, path.Base(key), m.CreatedAt, f)
+}
+
+// --- 医院图片信息模块 ---
+// GetHospitalImages 首页轮播图片，按排序值和上传顺序排列
+func GetHospitalImages(c *gin.Context) {
+	var files []model.MediaFile
+	if err := database.DB.Where("category = ?", mediaHospital).Order("sort_order, id").Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片失败"})
+		return
+	}
+	data := make([]gin.H, 0, len(files))
+	for _, f := range files {
+		item := mediaItem(f)
+		data = append(data, gin.H{"id": f.ID, "url": item.URL, "thumb_url": item.ThumbURL, "title": f.Title})
+	}
+	c.JSON(http.StatusOK, gin.H{"data": data})
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 机构管理员只能查看、修改和删除本机构的文件，全局管理员不限
+func TestMediaScopedToOrg(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		own := model.MediaFile{Category: mediaHospital, Key: "hospital/own.png", OrgID: 1}
+		other := model.MediaFile{Category: mediaHospital, Key: "hospital/other.png", OrgID: 2}
+		for _, m := range []*model.MediaFile{&own, &other} {
+			if err := db.Create(m).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		admin := createStaff(t, db, "admin1", "org_admin", nil)
+
+		list := func(user model.User) map[uint]bool {
+			t.Helper()
+			w := as(user).get(t, GetMediaList, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("状态码 %d: %s", w.Code, w.Body.String())
+			}
+			var resp struct {
+				Data []MediaItem `json:"data"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			ids := make(map[uint]bool)
+			for _, m := range resp.Data {
+				ids[m.ID] = true
+			}
+			return ids
+		}
+		if ids := list(admin); !ids[own.ID] || ids[other.ID] {
+			t.Fatalf("机构管理员看到的文件: %v", ids)
+		}
+
+		id := fmt.Sprint(other.ID)
+		if w := as(admin).call(t, UpdateMedia, http.MethodPut, map[string]string{"title": "改"}, "id", id); w.Code != http.StatusNotFound {
+			t.Fatalf("修改其他机构的文件: 状态码 %d, 期望 404", w.Code)
+		}
+		if w := as(admin).call(t, DeleteMedia, http.MethodDelete, nil, "id", id); w.Code != http.StatusNotFound {
+			t.Fatalf("删除其他机构的文件: 状态码 %d, 期望 404", w.Code)
+		}
+
+		global := createStaff(t, db, "root", "global_admin", nil)
+		if ids := list(global); !ids[own.ID] || !ids[other.ID] {
+			t.Fatalf("全局管理员看到的文件: %v", ids)
+		}
+	})
+}
@@ -0,0 +1,329 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/api/middleware"
+	"hospital-system/internal/credential"
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- 两步验证 (MFA) ---
+// 登录流程：
+//   1. POST /login 密码正确后，已开启两步验证的账号只拿到 challenge_token
+//   2. POST /login/mfa 提交 challenge_token + 验证码 (或恢复码)，换取正式 Token
+// 被强制要求两步验证但还没绑定的账号，登录后拿到受限 Token，只能访问 /me 完成绑定
+
+// 挑战 Token 有效期
+const mfaChallengeTTL = 5 * time.Minute
+
+// mfaEnrollmentRequired 该用户是否必须先绑定两步验证
+// 统一身份认证账号的两步验证由身份提供方负责
+func mfaEnrollmentRequired(user model.User) bool {
+	return user.IsLocal() && !user.TOTPEnabled && credential.MFARequired(user.Role)
+}
+
+// issueMFAChallenge 签发两步验证挑战 Token (不能访问任何业务接口)
+func issueMFAChallenge(user model.User) (string, error) {
+	return middleware.SignToken(middleware.TypeMFAChallenge, jwt.MapClaims{
+		"user_id": user.ID,
+		"tv":      user.TokenVersion,
+		"exp":     time.Now().Add(mfaChallengeTTL).Unix(),
+	})
+}
+
+type LoginMFARequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`          // 验证器 App 上的 6 位数字
+	RecoveryCode   string `json:"recovery_code"` // 手机丢失时使用恢复码
+}
+
+// LoginMFAHandler 登录第二步：校验验证码，签发正式 Token
+func LoginMFAHandler(c *gin.Context) {
+	var req LoginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	// 1. 校验挑战 Token
+	claims, err := middleware.ParseToken(req.ChallengeToken, middleware.TypeMFAChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证已过期，请重新登录"})
+		return
+	}
+	uid, _ := claims["user_id"].(float64)
+	tv, _ := claims["tv"].(float64)
+
+	var user model.User
+	if err := database.DB.First(&user, uint(uid)).Error; err != nil ||
+		user.TokenVersion != uint(tv) || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证已过期，请重新登录"})
+		return
+	}
+	if !user.Enabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": disabledMsg})
+		return
+	}
+
+	// 2. 验证码同样计入失败次数，防止在挑战有效期内暴力枚举
+	if credential.IsLocked(&user) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMsg})
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	usedRecovery := false
+	ok := false
+	if req.Code != "" {
+		ok = credential.CheckTOTP(db, &user, req.Code)
+	} else {
+		ok = credential.UseRecoveryCode(db, user.ID, req.RecoveryCode)
+		usedRecovery = ok
+	}
+	if !ok {
+		if err := credential.RecordFailure(db, &user); err != nil {
+			logging.Warnf("记录登录失败次数出错: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证码错误"})
+		return
+	}
+	if err := credential.RecordSuccess(db, &user); errors.Is(err, credential.ErrLocked) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMsg})
+		return
+	} else if err != nil {
+		logging.Warnf("重置登录失败次数出错: %v", err)
+	}
+
+	if usedRecovery {
+		log.Printf("用户 %s 使用恢复码登录", user.Username)
+	}
+	respondLogin(c, user)
+}
+
+// --- 个人两步验证设置 (/me/mfa) ---
+
+// loadCurrentUser 读取当前登录用户，失败时直接写响应
+func loadCurrentUser(c *gin.Context) (model.User, bool) {
+	var user model.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return user, false
+	}
+	return user, true
+}
+
+// GetMFAStatus 查看自己的两步验证状态
+func GetMFAStatus(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	var remaining int64
+	database.DB.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"required":                 credential.MFARequired(user.Role),
+		"recovery_codes_remaining": remaining,
+	}})
+}
+
+// EnrollMFA 生成新的 TOTP 密钥，返回 otpauth 链接供前端生成二维码
+// 此时尚未生效，需要调用 ActivateMFA 提交一次验证码确认绑定成功
+func EnrollMFA(c *gin.Context) {
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.IsLocal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "统一身份认证账号的两步验证由身份提供方负责"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已开启两步验证，如需更换请先关闭"})
+		return
+	}
+
+	secret, err := credential.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+	err = database.DB.WithContext(c.Request.Context()).Model(&user).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": credential.ProvisioningURI(user.Username, secret),
+	})
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// ActivateMFA 提交验证码确认绑定，返回恢复码 (只显示这一次) 和新的 Token
+func ActivateMFA(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "已开启两步验证"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先生成绑定二维码"})
+		return
+	}
+
+	step, valid := credential.VerifyTOTP(user.TOTPSecret, req.Code, user.TOTPLastStep, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+
+	// 开启后 TokenVersion 递增，其他设备需要重新登录并通过两步验证
+	db := database.DB.WithContext(c.Request.Context())
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.TokenVersion++
+	err := db.Model(&user).Select("totp_enabled", "totp_last_step", "token_version").Updates(&user).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "开启两步验证失败"})
+		return
+	}
+
+	codes, err := credential.GenerateRecoveryCodes(db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+	token, err := issueToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "两步验证已开启，请妥善保存恢复码", "recovery_codes": codes, "token": token})
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// DisableMFA 关闭自己的两步验证 (需要密码 + 验证码；被强制要求的角色不能关闭)
+func DisableMFA(c *gin.Context) {
+	var req DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未开启两步验证"})
+		return
+	}
+	if credential.MFARequired(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "当前角色必须开启两步验证，如需更换手机请联系管理员重置"})
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	err := reverify(db, &user,
+		func() bool { return user.CheckPassword(req.Password) },
+		func() bool { return credential.CheckTOTP(db, &user, req.Code) })
+	switch {
+	case errors.Is(err, credential.ErrLocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": reverifyLockedMsg})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "密码或验证码错误"})
+		return
+	}
+
+	if err := credential.ResetMFA(db, &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭两步验证失败"})
+		return
+	}
+	token, err := issueToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "两步验证已关闭", "token": token})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码 (旧的全部作废)
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	user, ok := loadCurrentUser(c)
+	if !ok {
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "未开启两步验证"})
+		return
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	if !credential.CheckTOTP(db, &user, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "验证码错误"})
+		return
+	}
+
+	codes, err := credential.GenerateRecoveryCodes(db, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "恢复码已更新，旧恢复码全部作废", "recovery_codes": codes})
+}
+
+// ResetUserMFA 管理员重置用户的两步验证 (用户手机丢失且恢复码用完时)
+// 对应路由: DELETE /api/v1/dashboard/users/:id/mfa
+// 重置后用户所有 Token 失效；被强制要求的角色下次登录需重新绑定
+func ResetUserMFA(c *gin.Context) {
+	user, ok := manageableUser(c, false)
+	if !ok {
+		return
+	}
+
+	if err := credential.ResetMFA(database.DB.WithContext(c.Request.Context()), &user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置两步验证失败"})
+		return
+	}
+
+	log.Printf("管理员 %d 重置了用户 %s 的两步验证", c.GetUint("user_id"), user.Username)
+	c.JSON(http.StatusOK, gin.H{"msg": "两步验证已重置"})
+}
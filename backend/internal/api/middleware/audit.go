@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"hospital-system/internal/audit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditMiddleware 把当前操作人放进请求的 context，供 GORM 审计回调读取
+// 需要放在 AuthMiddleware 之后，未登录接口 (注册) 记录为匿名操作
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := &audit.Actor{
+			UserID: c.GetUint("user_id"),
+			Role:   c.GetString("role"),
+			OrgID:  c.GetUint("org_id"),
+			IP:     c.ClientIP(),
+			Action: c.Request.Method + " " + c.FullPath(),
+		}
+		c.Request = c.Request.WithContext(audit.WithActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
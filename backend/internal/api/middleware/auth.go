@@ -1,20 +1,113 @@
 package middleware
 
 import (
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/signing"
 	"net/http"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var JwtKey []byte
+// keys 签发与校验 Token 的密钥 (见 internal/signing)
+var keys *signing.KeySet
 
-func InitAuth(secret string) {
-	JwtKey = []byte(secret)
+func InitAuth(set *signing.KeySet) {
+	keys = set
+}
+
+// Keys 当前加载的密钥，用于对外发布 JWKS
+func Keys() *signing.KeySet {
+	return keys
+}
+
+// --- Token 类型 ---
+// 所有 Token 都用同一把密钥签发 (公钥通过 JWKS 公开)，靠 typ 和 aud 两个声明区分用途，
+// ParseToken 只接受调用方指定的类型，一种 Token 不能拿到别处当另一种用
+//
+//	typ            aud                       用途
+//	access         hospital-system           正式登录 Token
+//	restricted     hospital-system           必须先修改密码 / 绑定两步验证，只能访问 /me 下的接口
+//	mfa_challenge  hospital-system/internal  登录时的两步验证挑战
+//	oidc_state     hospital-system/internal  统一身份认证登录过程中的 Cookie (state / nonce / PKCE)
+//
+// 其他服务按 JWKS 校验本系统的登录 Token 时，必须同时要求 typ = access、aud = hospital-system
+const (
+	TypeAccess       = "access"
+	TypeRestricted   = "restricted"
+	TypeMFAChallenge = "mfa_challenge"
+	TypeOIDCState    = "oidc_state"
+
+	AudienceAPI      = "hospital-system"
+	audienceInternal = "hospital-system/internal"
+)
+
+// audienceOf 各类型 Token 的 aud：只有登录 Token 面向业务接口，其余只在本系统内部使用
+func audienceOf(typ string) string {
+	if typ == TypeAccess || typ == TypeRestricted {
+		return AudienceAPI
+	}
+	return audienceInternal
+}
+
+// SignToken 使用当前签发密钥签发一种类型的 Token，Header 中带上 kid 方便轮换
+func SignToken(typ string, claims jwt.MapClaims) (string, error) {
+	claims["typ"] = typ
+	claims["aud"] = audienceOf(typ)
+	active := keys.Active()
+	token := jwt.NewWithClaims(active.Method(), claims)
+	token.Header["kid"] = active.KID
+	return token.SignedString(active.PrivateKey)
+}
+
+// ParseToken 校验签名、有效期和类型，返回 Token 中的声明
+// 只接受 RS256 / EdDSA，且算法必须与 kid 对应的密钥一致，防止算法混淆攻击
+// typ 必须是 types 之一，aud 必须与该类型一致
+func ParseToken(tokenString string, types ...string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Get(kid)
+		if !ok {
+			return nil, fmt.Errorf("未知的密钥 %q", kid)
+		}
+		if token.Method.Alg() != key.Alg {
+			return nil, fmt.Errorf("签名算法 %s 与密钥不匹配", token.Method.Alg())
+		}
+		return key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{signing.AlgRS256, signing.AlgEdDSA}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	typ, _ := claims["typ"].(string)
+	if !slices.Contains(types, typ) {
+		return nil, fmt.Errorf("Token 类型 %q 不符", typ)
+	}
+	aud, err := claims.GetAudience()
+	if err != nil || !slices.Contains(aud, audienceOf(typ)) {
+		return nil, fmt.Errorf("Token 受众 %v 不符", aud)
+	}
+	return claims, nil
 }
 
 func AuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(false)
+}
+
+// AccountAuthMiddleware 用于 /me 下的账户自助接口
+// 与 AuthMiddleware 相同，但允许 "必须先修改密码 / 绑定两步验证" 的受限 Token 通过
+func AccountAuthMiddleware() gin.HandlerFunc {
+	return authMiddleware(true)
+}
+
+func authMiddleware(allowRestricted bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -24,30 +117,59 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := authHeader[7:]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return JwtKey, nil
-		})
-
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// 1. 处理 user_id (从 float64 转为 uint)
-			if uid, ok := claims["user_id"].(float64); ok {
-				c.Set("user_id", uint(uid))
-			}
+		// 0. 只接受登录 Token；两步验证挑战等一次性用途的 Token 在这里被拒绝
+		claims, err := ParseToken(tokenString, TypeAccess, TypeRestricted)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的Token: " + err.Error()})
+			c.Abort()
+			return
+		}
 
-			// 2. 处理 role (必须转为 string，否则后续 string 比对会失败)
-			if role, ok := claims["role"].(string); ok {
-				c.Set("role", role)
-			}
+		// 1. 处理 user_id (从 float64 转为 uint)
+		uid, _ := claims["user_id"].(float64)
+		c.Set("user_id", uint(uid))
 
-			// 3. 处理 org_id (从 float64 转为 uint)
-			if oid, ok := claims["org_id"].(float64); ok {
-				c.Set("org_id", uint(oid))
-			}
+		// 1.1 Token 版本必须与数据库一致 (修改密码后旧 Token 失效，删除的用户也会被拒绝)
+		tv, _ := claims["tv"].(float64)
+		var current model.User
+		err = database.DB.Select("id", "token_version", "enabled").First(&current, uint(uid)).Error
+		if err != nil || current.TokenVersion != uint(tv) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录"})
+			c.Abort()
+			return
+		}
 
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的Token: " + err.Error()})
+		// 1.2 账号被停用
+		if !current.Enabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "账号已停用，请联系管理员"})
 			c.Abort()
+			return
+		}
+
+		// 2. 处理 role (必须转为 string，否则后续 string 比对会失败)
+		if role, ok := claims["role"].(string); ok {
+			c.Set("role", role)
+		}
+
+		// 3. 处理 org_id (从 float64 转为 uint)
+		if oid, ok := claims["org_id"].(float64); ok {
+			c.Set("org_id", uint(oid))
 		}
+
+		// 4. 受限 Token：必须先修改密码 / 绑定两步验证才能访问其他接口
+		if !allowRestricted && claims["typ"] == TypeRestricted {
+			if pwdChange, _ := claims["pwd_change"].(bool); pwdChange {
+				c.JSON(http.StatusForbidden, gin.H{"error": "请先修改初始密码", "must_change_password": true})
+				c.Abort()
+				return
+			}
+			if mfaEnroll, _ := claims["mfa_enroll"].(bool); mfaEnroll {
+				c.JSON(http.StatusForbidden, gin.H{"error": "请先绑定两步验证", "mfa_enrollment_required": true})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
 	}
 }
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"hospital-system/internal/signing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// useKeys 在临时目录生成 EdDSA 和 RS256 各一把密钥，以 active 算法的那把签发
+func useKeys(t *testing.T, active string) (dir, edKID, rsaKID string) {
+	t.Helper()
+	dir = t.TempDir()
+	var err error
+	if edKID, err = signing.Generate(dir, signing.AlgEdDSA); err != nil {
+		t.Fatal(err)
+	}
+	if rsaKID, err = signing.Generate(dir, signing.AlgRS256); err != nil {
+		t.Fatal(err)
+	}
+	activeKID := edKID
+	if active == signing.AlgRS256 {
+		activeKID = rsaKID
+	}
+	set, err := signing.Load(dir, activeKID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitAuth(set)
+	t.Cleanup(func() { InitAuth(nil) })
+	return dir, edKID, rsaKID
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "role": "doctor", "typ": TypeAccess, "aud": AudienceAPI, "exp": time.Now().Add(time.Hour).Unix()}
+}
+
+// signWith 用指定密钥签发，kid 写入任意值
+func signWith(t *testing.T, key *signing.Key, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method(), claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParseToken(t *testing.T) {
+	for _, alg := range []string{signing.AlgEdDSA, signing.AlgRS256} {
+		t.Run(alg, func(t *testing.T) {
+			useKeys(t, alg)
+			token, err := SignToken(TypeAccess, validClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := ParseToken(token, TypeAccess)
+			if err != nil {
+				t.Fatalf("ParseToken: %v", err)
+			}
+			if claims["role"] != "doctor" {
+				t.Errorf("role = %v", claims["role"])
+			}
+			header, _, _ := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+			if header.Header["kid"] != keys.Active().KID || header.Header["alg"] != alg {
+				t.Errorf("Header = %v", header.Header)
+			}
+		})
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	_, edKID, rsaKID := useKeys(t, signing.AlgEdDSA)
+	ed, _ := keys.Get(edKID)
+	rsaKey, _ := keys.Get(rsaKID)
+
+	// alg=none
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	// 算法混淆：用 RSA 公钥 (PEM) 当 HMAC 密钥签 HS256
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	hs.Header["kid"] = rsaKID
+	confused, _ := hs.SignedString([]byte(publicPEM(t, rsaKey)))
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	noExp := validClaims()
+	delete(noExp, "exp")
+	noTyp := validClaims()
+	delete(noTyp, "typ")
+	// 类型改成 access 但受众仍是内部的，以及没有受众的
+	internalAud := validClaims()
+	internalAud["aud"] = audienceInternal
+	noAud := validClaims()
+	delete(noAud, "aud")
+	challenge, _ := SignToken(TypeMFAChallenge, jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Minute).Unix()})
+
+	tests := []struct {
+		name  string
+		token string
+		want  string // 错误信息中应包含的内容，为空时只要求失败
+	}{
+		{"没有 kid", signWith(t, ed, "", validClaims()), "未知的密钥"},
+		{"未知 kid", signWith(t, ed, "no-such-kid", validClaims()), "未知的密钥"},
+		{"kid 与签名算法不符", signWith(t, ed, rsaKID, validClaims()), "与密钥不匹配"},
+		{"alg=none", none, ""},
+		{"HS256 算法混淆", confused, ""},
+		{"已过期", signWith(t, ed, edKID, expired), ""},
+		{"没有 exp", signWith(t, ed, edKID, noExp), ""},
+		{"签名被篡改", tamper(signWith(t, ed, edKID, validClaims())), ""},
+		{"没有 typ", signWith(t, ed, edKID, noTyp), "类型"},
+		{"两步验证挑战当登录 Token", challenge, "类型"},
+		{"受众是内部", signWith(t, ed, edKID, internalAud), "受众"},
+		{"没有受众", signWith(t, ed, edKID, noAud), "受众"},
+	}
+	for _, tt := range tests {
+		_, err := ParseToken(tt.token, TypeAccess)
+		if err == nil {
+			t.Errorf("%s: 应被拒绝", tt.name)
+			continue
+		}
+		if tt.want != "" && !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: 错误 = %v，应包含 %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// 轮换后旧密钥只保留公钥：旧 Token 仍能校验，新 Token 用新密钥签发
+func TestParseTokenAfterRotation(t *testing.T) {
+	dir, edKID, rsaKID := useKeys(t, signing.AlgEdDSA)
+	old, err := SignToken(TypeAccess, validClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.Retire(dir, edKID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signing.Load(dir, edKID); err == nil {
+		t.Error("只有公钥的密钥不能作为签发密钥")
+	}
+	set, err := signing.Load(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitAuth(set)
+	if keys.Active().KID != rsaKID {
+		t.Fatalf("active = %s，应自动选择仍有私钥的 %s", keys.Active().KID, rsaKID)
+	}
+
+	if _, err := ParseToken(old, TypeAccess); err != nil {
+		t.Errorf("旧 Token 应仍能校验: %v", err)
+	}
+	token, _ := SignToken(TypeAccess, validClaims())
+	if _, err := ParseToken(token, TypeAccess); err != nil {
+		t.Errorf("新 Token: %v", err)
+	}
+}
+
+// publicPEM 公钥的 PEM (公开可得，算法混淆攻击就是拿它当 HMAC 密钥)
+func publicPEM(t *testing.T, key *signing.Key) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// tamper 改动签名中的一个字符
+func tamper(token string) string {
+	b := []byte(token)
+	i := strings.LastIndex(token, ".") + 2
+	if b[i] == 'A' {
+		b[i] = 'B'
+	} else {
+		b[i] = 'A'
+	}
+	return string(b)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/idcard"
+	"hospital-system/internal/model"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 患者档案 (Patients) ---
+// 对应路由：/api/v1/dashboard/patients
+// 前台挂号员为线下首诊的患者建档，患者之后自助注册时按身份证号关联到同一份档案
+
+type PatientRequest struct {
+	Name   string `json:"name" binding:"required"`
+	IDCard string `json:"id_card" binding:"required"`
+	Phone  string `json:"phone"`
+}
+
+// PatientDetail 档案列表，附带是否已有患者自助注册的账号
+type PatientDetail struct {
+	model.Patient
+	Username string `json:"username"`
+}
+
+// maskPatient 不在 encryption.full_value_roles 中的角色只看到脱敏后的身份证号和手机号
+func maskPatient(c *gin.Context, p *model.Patient) {
+	if slices.Contains(config.Get().Encryption.FullValueRoles, c.GetString("role")) {
+		return
+	}
+	p.IDCard = fieldcrypt.MaskIDCard(p.IDCard)
+	p.Phone = fieldcrypt.MaskPhone(p.Phone)
+}
+
+// GetPatients 查询患者档案
+// 参数: keyword (姓名模糊匹配；手机号、身份证号加密存储，需要输入完整号码), page, page_size
+func GetPatients(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tx := database.DB.Table("patients").
+		Select("patients.*, users.username").
+		Joins("LEFT JOIN users ON users.patient_id = patients.id AND users.deleted_at IS NULL")
+	if kw := strings.TrimSpace(c.Query("keyword")); kw != "" {
+		hash := fieldcrypt.BlindIndex(kw)
+		tx = tx.Where("patients.name LIKE ? OR patients.phone_hash = ? OR patients.id_card_hash = ?", "%"+kw+"%", hash, hash)
+	}
+
+	var total int64
+	tx.Count(&total)
+
+	var patients []PatientDetail
+	if err := tx.Order("patients.id desc").Offset((page - 1) * pageSize).Limit(pageSize).Scan(&patients).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取患者档案失败"})
+		return
+	}
+	for i := range patients {
+		maskPatient(c, &patients[i].Patient)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": patients, "total": total, "page": page, "page_size": pageSize})
+}
+
+// CreatePatient 前台建档 (同一身份证号只能建一份档案)
+func CreatePatient(c *gin.Context) {
+	var req PatientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	info, err := idcard.Parse(req.IDCard)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existing model.Patient
+	err = database.DB.Where("id_card_hash = ?", fieldcrypt.BlindIndex(info.Number)).First(&existing).Error
+	if err == nil {
+		maskPatient(c, &existing)
+		c.JSON(http.StatusConflict, gin.H{"error": "该身份证号已建档", "data": existing})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "建档失败"})
+		return
+	}
+
+	patient := model.Patient{
+		Name:      strings.TrimSpace(req.Name),
+		Phone:     req.Phone,
+		IDCard:    info.Number,
+		Gender:    info.Gender,
+		BirthDate: &info.BirthDate,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&patient).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "建档失败"})
+		return
+	}
+	maskPatient(c, &patient)
+	c.JSON(http.StatusOK, gin.H{"msg": "建档成功", "data": patient})
+}
@@ -0,0 +1,342 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 过敏史与配伍禁忌 (Prescribing Safety) ---
+// 医生开药时检查患者过敏史以及与在用药物的相互作用
+
+// 近多少天内开出的药视为 "在用药物"
+const activePrescriptionDays = 30
+
+// 规则级别
+const (
+	LevelBlock = "block"
+	LevelWarn  = "warn"
+)
+
+// PrescriptionConflict 一条开药冲突
+type PrescriptionConflict struct {
+	Kind    string `json:"kind"`  // allergy, interaction, unverified
+	Level   string `json:"level"` // block, warn
+	Message string `json:"message"`
+}
+
+// checkPrescription 检查给某个挂号开某种药是否与过敏史或在用药物冲突
+// 返回 (禁止项, 警告项)
+func checkPrescription(tx *gorm.DB, booking model.Booking, med model.InventoryItem) ([]PrescriptionConflict, []PrescriptionConflict, error) {
+	var blocks, warns []PrescriptionConflict
+	add := func(c PrescriptionConflict) {
+		if c.Level == LevelBlock {
+			blocks = append(blocks, c)
+		} else {
+			warns = append(warns, c)
+		}
+	}
+
+	// 前台挂号时未建档的患者无从核对过敏史和在用药物，提醒医生当面确认
+	if booking.PatientID == nil {
+		add(PrescriptionConflict{
+			Kind:    "unverified",
+			Level:   LevelWarn,
+			Message: "患者未建档，无法核对过敏史和在用药物，请当面确认",
+		})
+		return blocks, warns, nil
+	}
+
+	// 1. 过敏史：过敏原命中药名或分类
+	var allergies []model.PatientAllergy
+	if err := tx.Where("patient_id = ?", *booking.PatientID).Find(&allergies).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, a := range allergies {
+		if !matchesItem(a.Allergen, med) {
+			continue
+		}
+		level := LevelWarn
+		if a.Severity == "severe" {
+			level = LevelBlock
+		}
+		add(PrescriptionConflict{
+			Kind:    "allergy",
+			Level:   level,
+			Message: fmt.Sprintf("患者对 %s 过敏 (%s)", a.Allergen, a.Reaction),
+		})
+	}
+
+	// 2. 在用药物：该患者近期订单里的药品 (不含本次挂号)
+	var activeMeds []model.InventoryItem
+	err := tx.Unscoped().Table("inventory_items").
+		Select("DISTINCT inventory_items.*").
+		Joins("JOIN orders ON orders.medicine_id = inventory_items.id").
+		Joins("JOIN bookings ON bookings.id = orders.booking_id").
+		Where("bookings.patient_id = ? AND bookings.id <> ?", *booking.PatientID, booking.ID).
+		Where("orders.created_at >= ?", time.Now().AddDate(0, 0, -activePrescriptionDays)).
+		Scan(&activeMeds).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(activeMeds) == 0 {
+		return blocks, warns, nil
+	}
+
+	// 3. 相互作用规则：A/B 两侧分别命中新开药和在用药物
+	var rules []model.DrugInteractionRule
+	if err := tx.Find(&rules).Error; err != nil {
+		return nil, nil, err
+	}
+	for _, r := range rules {
+		for _, active := range activeMeds {
+			hit := (matchesItem(r.ItemA, med) && matchesItem(r.ItemB, active)) ||
+				(matchesItem(r.ItemB, med) && matchesItem(r.ItemA, active))
+			if !hit {
+				continue
+			}
+			add(PrescriptionConflict{
+				Kind:    "interaction",
+				Level:   r.Level,
+				Message: fmt.Sprintf("%s 与在用药物 %s 存在相互作用: %s", med.Name, active.Name, r.Description),
+			})
+		}
+	}
+
+	return blocks, warns, nil
+}
+
+// matchesItem 判断规则/过敏原里写的名称是否指向该药品 (药名包含或分类相同)
+func matchesItem(name string, med model.InventoryItem) bool {
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(med.Name), name) || strings.ToLower(med.Category) == name
+}
+
+// describeConflicts 把冲突列表拼成一行文字，用于保存忽略记录
+func describeConflicts(conflicts []PrescriptionConflict) string {
+	msgs := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		msgs = append(msgs, c.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// --- 过敏史管理 ---
+
+type AllergyRequest struct {
+	PatientID uint   `json:"patient_id" binding:"required"`
+	Allergen  string `json:"allergen" binding:"required"`
+	Severity  string `json:"severity"`
+	Reaction  string `json:"reaction"`
+}
+
+// GetAllergies 查看过敏史 (患者只能看自己和家属的)
+// 参数: patient_id (患者本人无需传，查看家属时传家属的档案 ID)
+func GetAllergies(c *gin.Context) {
+	role := c.GetString("role")
+	userID := c.GetUint("user_id")
+
+	requested, _ := strconv.ParseUint(c.Query("patient_id"), 10, 64)
+	patientID := uint(requested)
+	if role == "general_user" {
+		var currentUser model.User
+		if err := database.DB.First(&currentUser, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+			return
+		}
+		patientID = ownPatientID(currentUser, patientID)
+		basis, err := patientAccessBasis(currentUser, patientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "权限校验失败"})
+			return
+		}
+		if basis == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该患者的过敏史"})
+			return
+		}
+	}
+	if patientID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定患者档案"})
+		return
+	}
+
+	var allergies []model.PatientAllergy
+	database.DB.Where("patient_id = ?", patientID).Order("created_at desc").Find(&allergies)
+	c.JSON(http.StatusOK, gin.H{"data": allergies})
+}
+
+// CreateAllergy 登记过敏史
+func CreateAllergy(c *gin.Context) {
+	var req AllergyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	switch req.Severity {
+	case "":
+		req.Severity = "moderate"
+	case "mild", "moderate", "severe":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "严重程度只能是 mild/moderate/severe"})
+		return
+	}
+
+	var patient model.Patient
+	if err := database.DB.Where("anonymized_at IS NULL").First(&patient, req.PatientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者档案不存在"})
+		return
+	}
+
+	allergy := model.PatientAllergy{
+		PatientID:   patient.ID,
+		PatientName: patient.Name,
+		Allergen:    req.Allergen,
+		Severity:    req.Severity,
+		Reaction:    req.Reaction,
+		RecordedBy:  c.GetUint("user_id"),
+		CreatedAt:   time.Now(),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&allergy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存过敏史失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "过敏史已登记", "data": allergy})
+}
+
+// DeleteAllergy 删除过敏史
+func DeleteAllergy(c *gin.Context) {
+	id := c.Param("id")
+	result := database.DB.WithContext(c.Request.Context()).Delete(&model.PatientAllergy{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "过敏史不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "删除成功"})
+}
+
+// --- 配伍禁忌规则 ---
+
+// GetInteractionRules 查看规则列表
+func GetInteractionRules(c *gin.Context) {
+	search := c.Query("search")
+
+	var rules []model.DrugInteractionRule
+	tx := database.DB.Order("item_a asc")
+	if search != "" {
+		tx = tx.Where("item_a LIKE ? OR item_b LIKE ?", "%"+search+"%", "%"+search+"%")
+	}
+	tx.Find(&rules)
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// ImportInteractionRules 从 CSV 文件导入规则
+// 表头: item_a,item_b,level,description；传 replace=true 时先清空旧规则
+func ImportInteractionRules(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传规则文件"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法读取文件"})
+		return
+	}
+	defer file.Close()
+
+	rules, err := parseInteractionRules(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		if c.Query("replace") == "true" {
+			if err := tx.Where("1 = 1").Delete(&model.DrugInteractionRule{}).Error; err != nil {
+				return err
+			}
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入规则失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "导入成功", "count": len(rules)})
+}
+
+// parseInteractionRules 解析 CSV，任何一行有问题都整体拒绝
+func parseInteractionRules(r io.Reader) ([]model.DrugInteractionRule, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("文件为空或格式错误")
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	for _, required := range []string{"item_a", "item_b", "level"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("缺少列: %s", required)
+		}
+	}
+
+	get := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var rules []model.DrugInteractionRule
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行格式错误: %v", line, err)
+		}
+
+		rule := model.DrugInteractionRule{
+			ItemA:       get(row, "item_a"),
+			ItemB:       get(row, "item_b"),
+			Level:       strings.ToLower(get(row, "level")),
+			Description: get(row, "description"),
+			CreatedAt:   time.Now(),
+		}
+		if rule.ItemA == "" || rule.ItemB == "" {
+			return nil, fmt.Errorf("第 %d 行缺少药品名称", line)
+		}
+		if rule.Level != LevelBlock && rule.Level != LevelWarn {
+			return nil, fmt.Errorf("第 %d 行级别只能是 block 或 warn", line)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
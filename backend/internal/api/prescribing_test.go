@@ -0,0 +1,145 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// prescribingFixture 两位同名患者，各有一次挂号；药品：阿莫西林 (青霉素类)、华法林、阿司匹林
+type prescribingFixture struct {
+	patient, namesake              model.Patient
+	booking, namesakeBooking       model.Booking
+	amoxicillin, warfarin, aspirin model.InventoryItem
+}
+
+func seedPrescribing(t *testing.T, db *gorm.DB) prescribingFixture {
+	t.Helper()
+	var f prescribingFixture
+	f.patient = model.Patient{Name: "李四"}
+	f.namesake = model.Patient{Name: "李四"}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(db.Create(&f.patient).Error)
+	must(db.Create(&f.namesake).Error)
+	f.booking = model.Booking{PatientName: "李四", PatientID: &f.patient.ID, DoctorID: 1, Status: "Pending"}
+	f.namesakeBooking = model.Booking{PatientName: "李四", PatientID: &f.namesake.ID, DoctorID: 1, Status: "Pending"}
+	must(db.Create(&f.booking).Error)
+	must(db.Create(&f.namesakeBooking).Error)
+
+	f.amoxicillin = model.InventoryItem{Name: "阿莫西林胶囊", Category: "青霉素类", OrgID: 1}
+	f.warfarin = model.InventoryItem{Name: "华法林钠片", Category: "抗凝药", OrgID: 1}
+	f.aspirin = model.InventoryItem{Name: "阿司匹林肠溶片", Category: "解热镇痛药", OrgID: 1}
+	for _, item := range []*model.InventoryItem{&f.amoxicillin, &f.warfarin, &f.aspirin} {
+		must(db.Create(item).Error)
+	}
+	return f
+}
+
+// prescribe 以某次挂号开药，返回 (禁止项, 警告项)
+func prescribe(t *testing.T, db *gorm.DB, booking model.Booking, med model.InventoryItem) ([]PrescriptionConflict, []PrescriptionConflict) {
+	t.Helper()
+	blocks, warns, err := checkPrescription(db, booking, med)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks, warns
+}
+
+// 严重过敏禁止开药，一般过敏只警告；同名的另一位患者不受影响
+func TestCheckPrescriptionAllergy(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		f := seedPrescribing(t, db)
+		db.Create(&model.PatientAllergy{PatientID: f.patient.ID, PatientName: "李四", Allergen: "青霉素类", Severity: "severe", Reaction: "休克"})
+		db.Create(&model.PatientAllergy{PatientID: f.patient.ID, PatientName: "李四", Allergen: "阿司匹林", Severity: "mild", Reaction: "皮疹"})
+
+		blocks, _ := prescribe(t, db, f.booking, f.amoxicillin)
+		if len(blocks) != 1 || blocks[0].Kind != "allergy" {
+			t.Fatalf("严重过敏应禁止开药: %+v", blocks)
+		}
+		blocks, warns := prescribe(t, db, f.booking, f.aspirin)
+		if len(blocks) != 0 || len(warns) != 1 || warns[0].Kind != "allergy" {
+			t.Fatalf("一般过敏应只警告: blocks=%+v warns=%+v", blocks, warns)
+		}
+
+		blocks, warns = prescribe(t, db, f.namesakeBooking, f.amoxicillin)
+		if len(blocks)+len(warns) != 0 {
+			t.Fatalf("同名患者不应受过敏史影响: blocks=%+v warns=%+v", blocks, warns)
+		}
+	})
+}
+
+// 相互作用：新开药与本人近期的在用药物命中规则，同名患者的用药不算
+func TestCheckPrescriptionInteraction(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		f := seedPrescribing(t, db)
+		db.Create(&model.DrugInteractionRule{ItemA: "抗凝药", ItemB: "阿司匹林", Level: LevelBlock, Description: "出血风险"})
+
+		// 同名患者在用华法林，不影响本人
+		db.Create(&model.Order{BookingID: f.namesakeBooking.ID, MedicineID: f.warfarin.ID, Quantity: 1, Status: "Paid"})
+		if blocks, warns := prescribe(t, db, f.booking, f.aspirin); len(blocks)+len(warns) != 0 {
+			t.Fatalf("同名患者的在用药物不应参与检查: blocks=%+v warns=%+v", blocks, warns)
+		}
+
+		// 本人上次就诊开了华法林
+		earlier := model.Booking{PatientName: "李四", PatientID: &f.patient.ID, DoctorID: 1, Status: "Completed"}
+		db.Create(&earlier)
+		db.Create(&model.Order{BookingID: earlier.ID, MedicineID: f.warfarin.ID, Quantity: 1, Status: "Paid"})
+		blocks, _ := prescribe(t, db, f.booking, f.aspirin)
+		if len(blocks) != 1 || blocks[0].Kind != "interaction" || !strings.Contains(blocks[0].Message, "华法林") {
+			t.Fatalf("应命中相互作用规则: %+v", blocks)
+		}
+
+		// 规则两侧对调同样命中：在用阿司匹林时开抗凝药
+		other := model.Booking{PatientName: "李四", PatientID: &f.patient.ID, DoctorID: 1, Status: "Completed"}
+		db.Create(&other)
+		db.Create(&model.Order{BookingID: other.ID, MedicineID: f.aspirin.ID, Quantity: 1, Status: "Paid"})
+		if blocks, _ := prescribe(t, db, f.booking, f.warfarin); len(blocks) != 1 || !strings.Contains(blocks[0].Message, "阿司匹林") {
+			t.Fatalf("规则两侧对调应同样命中: %+v", blocks)
+		}
+	})
+}
+
+// 前台挂号未建档的患者无法核对，给出警告而不是放行
+func TestCheckPrescriptionWithoutPatientRecord(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		f := seedPrescribing(t, db)
+		walkIn := model.Booking{PatientName: "李四", DoctorID: 1, Status: "Pending"}
+		db.Create(&walkIn)
+
+		blocks, warns := prescribe(t, db, walkIn, f.amoxicillin)
+		if len(blocks) != 0 || len(warns) != 1 || warns[0].Kind != "unverified" {
+			t.Fatalf("未建档应给出警告: blocks=%+v warns=%+v", blocks, warns)
+		}
+	})
+}
+
+// 删除不存在的过敏史返回 404
+func TestDeleteAllergyNotFound(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		f := seedPrescribing(t, db)
+		doctor := createStaff(t, db, "doc", "doctor", nil)
+		allergy := model.PatientAllergy{PatientID: f.patient.ID, PatientName: "李四", Allergen: "青霉素类"}
+		db.Create(&allergy)
+
+		id := fmt.Sprint(allergy.ID)
+		if w := as(doctor).call(t, DeleteAllergy, http.MethodDelete, nil, "id", id); w.Code != http.StatusOK {
+			t.Fatalf("删除失败 %d: %s", w.Code, w.Body.String())
+		}
+		if w := as(doctor).call(t, DeleteAllergy, http.MethodDelete, nil, "id", id); w.Code != http.StatusNotFound {
+			t.Fatalf("重复删除: 状态码 %d, 期望 404", w.Code)
+		}
+	})
+}
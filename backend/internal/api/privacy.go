@@ -0,0 +1,287 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/privacy"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 患者数据导出、删除申请与保留期限 (Privacy) ---
+// 对应路由：/api/v1/dashboard/privacy 和 /api/v1/dashboard/patients/:id/export
+//   1. 患者导出本人的全部数据 (JSON)；没有账号的患者由前台代为导出，必须填写理由，记入病历访问日志
+//   2. 患者本人或前台提交删除申请，全局管理员审批，通过后立即匿名化 (见 internal/privacy)
+//   3. 全局管理员查看保留期限、到期数据量，手动执行清理
+
+// ExportMyData 患者导出本人的全部数据
+func ExportMyData(c *gin.Context) {
+	var user model.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+	if user.PatientID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "账号未关联患者档案"})
+		return
+	}
+	writeExport(c, *user.PatientID, BasisPatient, "")
+}
+
+// ExportPatientData 前台代患者导出 (患者本人到场申请)
+// 参数: reason (必填，例如 "患者本人持身份证到前台申请")
+func ExportPatientData(c *gin.Context) {
+	reason := strings.TrimSpace(c.Query("reason"))
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写导出理由"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+	writeExport(c, uint(id), BasisSubjectRequest, reason)
+}
+
+// writeExport 以 JSON 附件的形式返回一位患者的全部数据
+func writeExport(c *gin.Context, patientID uint, basis, reason string) {
+	bundle, err := privacy.Export(database.DB, patientID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者档案不存在"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+		return
+	}
+
+	// 导出内容包含全部病历，和查看病历一样记入访问日志
+	logRecordAccess(c, patientID, bundle.Patient.Name, nil, "export", basis, reason)
+
+	filename := fmt.Sprintf("patient_%d_%s.json", patientID, time.Now().Format("20060102_150405"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "private, no-store")
+	c.JSON(http.StatusOK, bundle)
+}
+
+// --- 删除申请 ---
+
+type ErasureRequestBody struct {
+	PatientID uint   `json:"patient_id"` // 前台代为提交时必填；患者本人提交时忽略，使用账号绑定的档案
+	Reason    string `json:"reason"`
+}
+
+// CreateErasureRequest 提交删除申请
+func CreateErasureRequest(c *gin.Context) {
+	var body ErasureRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	// 1. 确定患者：患者本人只能申请删除自己的数据
+	userID := c.GetUint("user_id")
+	if c.GetString("role") == "general_user" {
+		var user model.User
+		if err := database.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+			return
+		}
+		if user.PatientID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "账号未关联患者档案"})
+			return
+		}
+		body.PatientID = *user.PatientID
+	}
+	if body.PatientID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定患者档案"})
+		return
+	}
+
+	var patient model.Patient
+	if err := database.DB.First(&patient, body.PatientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者档案不存在"})
+		return
+	}
+	if patient.AnonymizedAt != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该档案已匿名化"})
+		return
+	}
+
+	// 2. 同一患者同时只能有一个待审批的申请
+	var pending int64
+	database.DB.Model(&model.ErasureRequest{}).
+		Where("patient_id = ? AND status = ?", body.PatientID, model.ErasurePending).
+		Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "该患者已有待审批的删除申请"})
+		return
+	}
+
+	req := model.ErasureRequest{
+		PatientID:   body.PatientID,
+		RequestedBy: userID,
+		Reason:      strings.TrimSpace(body.Reason),
+		Status:      model.ErasurePending,
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&req).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "提交失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "已提交，等待管理员审批", "data": req})
+}
+
+// GetErasureRequests 删除申请列表
+// 全局管理员看全部，其他人只看自己提交的；参数: status, page, page_size
+func GetErasureRequests(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tx := database.DB.Model(&model.ErasureRequest{})
+	if c.GetString("role") != "global_admin" {
+		tx = tx.Where("requested_by = ?", c.GetUint("user_id"))
+	}
+	if status := c.Query("status"); status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+
+	var total int64
+	tx.Count(&total)
+
+	var list []model.ErasureRequest
+	if err := tx.Order("id desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取删除申请失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list, "total": total, "page": page, "page_size": pageSize})
+}
+
+type ErasureReviewRequest struct {
+	Note string `json:"note"` // 驳回时必填
+}
+
+// pendingErasureRequest 按路径中的 id 取出待审批的申请；不能审批自己提交的申请
+func pendingErasureRequest(c *gin.Context) (model.ErasureRequest, bool) {
+	var req model.ErasureRequest
+	if err := database.DB.First(&req, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+		return req, false
+	}
+	if req.Status != model.ErasurePending {
+		c.JSON(http.StatusConflict, gin.H{"error": privacy.ErrNotPending.Error()})
+		return req, false
+	}
+	if req.RequestedBy == c.GetUint("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能审批自己提交的申请"})
+		return req, false
+	}
+	return req, true
+}
+
+// ApproveErasureRequest 审批通过并立即匿名化该患者的全部数据 (不可恢复)
+func ApproveErasureRequest(c *gin.Context) {
+	var body ErasureReviewRequest
+	c.ShouldBindJSON(&body)
+	req, ok := pendingErasureRequest(c)
+	if !ok {
+		return
+	}
+
+	err := privacy.Approve(c.Request.Context(), database.DB, &req, c.GetUint("user_id"), strings.TrimSpace(body.Note))
+	switch {
+	case errors.Is(err, privacy.ErrNotPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者档案不存在"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败，数据未做任何修改"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"msg": "已匿名化该患者的全部数据", "data": req})
+	}
+}
+
+// RejectErasureRequest 驳回申请 (必须填写理由)
+func RejectErasureRequest(c *gin.Context) {
+	var body ErasureReviewRequest
+	if err := c.ShouldBindJSON(&body); err != nil || strings.TrimSpace(body.Note) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写驳回理由"})
+		return
+	}
+	req, ok := pendingErasureRequest(c)
+	if !ok {
+		return
+	}
+
+	reviewer := c.GetUint("user_id")
+	now := time.Now()
+	res := database.DB.WithContext(c.Request.Context()).Model(&req).
+		Where("status = ?", model.ErasurePending).
+		Updates(map[string]interface{}{
+			"status":      model.ErasureRejected,
+			"reviewed_by": reviewer,
+			"review_note": strings.TrimSpace(body.Note),
+			"reviewed_at": now,
+		})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": privacy.ErrNotPending.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "已驳回"})
+}
+
+// --- 保留期限 ---
+
+// GetRetentionStatus 当前保留期限、到期数据量和最近一次执行结果
+func GetRetentionStatus(c *gin.Context) {
+	due, err := privacy.Preview(database.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计到期数据失败"})
+		return
+	}
+	cfg := config.Get().Retention
+	c.JSON(http.StatusOK, gin.H{
+		"policy": gin.H{
+			"interval_hours":          cfg.IntervalHours,
+			"visit_days":              cfg.VisitDays,
+			"inactive_patient_days":   cfg.InactivePatientDays,
+			"access_log_days":         cfg.AccessLogDays,
+			"phone_verification_days": cfg.PhoneVerificationDays,
+		},
+		"due":  due,
+		"last": privacy.Status(),
+	})
+}
+
+// RunRetention 立即按保留期限清理一遍
+func RunRetention(c *gin.Context) {
+	// 页面关闭或请求断开时不中断正在进行的清理
+	result, err := privacy.Run(context.WithoutCancel(c.Request.Context()), database.DB, privacy.TriggerAPI)
+	switch {
+	case errors.Is(err, privacy.ErrRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清理失败: " + err.Error(), "data": result})
+	default:
+		c.JSON(http.StatusOK, gin.H{"msg": "清理完成", "data": result})
+	}
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 病历访问控制 (Record Access) ---
+// 只有以下人员可以查看病历：
+//   1. 患者本人，以及登记为家属的监护人 (Dependent)
+//   2. 接诊医生 (bookings.doctor_id)
+//   3. 患者授权科室的医生 (RecordConsent)
+//   4. 通过 "紧急访问" 临时获得权限的医生 (BreakGlassGrant)
+// 以上都按患者档案 ID 判断 (姓名会重名)，每一次访问都会写入 RecordAccessLog 供管理员审查
+
+// 访问依据
+const (
+	BasisPatient           = "patient"
+	BasisGuardian          = "guardian"
+	BasisTreatingDoctor    = "treating_doctor"
+	BasisDepartmentConsent = "department_consent"
+	BasisBreakGlass        = "break_glass"
+	BasisSubjectRequest    = "subject_request" // 患者本人申请，由前台代为导出 (privacy.go)
+)
+
+// 紧急访问的有效期
+const breakGlassDuration = 4 * time.Hour
+
+// 紧急访问理由的最少字数，防止随手填 "急"
+const breakGlassMinReason = 5
+
+// consentedPatients 某科室被授权的患者档案 (子查询)
+// 按科室 ID 匹配：科室改名、合并后授权随之转移，其他机构的同名科室不在授权范围内
+func consentedPatients(departmentID uint) *gorm.DB {
+	return database.DB.Model(&model.RecordConsent{}).
+		Select("patient_id").
+		Where("department_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", departmentID, time.Now())
+}
+
+// breakGlassPatients 某医生当前紧急访问中的患者档案 (子查询)
+func breakGlassPatients(userID uint) *gorm.DB {
+	return database.DB.Model(&model.BreakGlassGrant{}).
+		Select("patient_id").
+		Where("user_id = ? AND expires_at > ?", userID, time.Now())
+}
+
+// dependentPatients 某账号当前有效的家属档案 (子查询)
+func dependentPatients(guardianID uint) *gorm.DB {
+	return database.DB.Model(&model.Dependent{}).
+		Select("patient_id").
+		Where("guardian_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", guardianID, time.Now())
+}
+
+// whereOwnPatients 患者账号能看到的范围：本人 + 家属，column 为挂号的 patient_id 列
+func whereOwnPatients(db *gorm.DB, column string, user model.User) *gorm.DB {
+	if user.PatientID == nil {
+		return db.Where(column+" IN (?)", dependentPatients(user.ID))
+	}
+	return db.Where(column+" = ? OR "+column+" IN (?)", *user.PatientID, dependentPatients(user.ID))
+}
+
+// ownPatientID 患者账号要查看的档案：不指定时为本人的档案，指定时由 patientAccessBasis 判断是否为家属
+func ownPatientID(user model.User, requested uint) uint {
+	if requested == 0 && user.PatientID != nil {
+		return *user.PatientID
+	}
+	return requested
+}
+
+// patientAccessBasis 判断当前用户能否查看某位患者 (档案 ID) 的病历，返回访问依据，空字符串表示无权访问
+// 按档案 ID 而不是姓名判断，重名的患者互相看不到
+func patientAccessBasis(user model.User, patientID uint) (string, error) {
+	if patientID == 0 {
+		return "", nil
+	}
+
+	switch user.Role {
+	case "general_user":
+		if user.PatientID != nil && *user.PatientID == patientID {
+			return BasisPatient, nil
+		}
+		var count int64
+		err := database.DB.Table("(?) AS d", dependentPatients(user.ID)).
+			Where("d.patient_id = ?", patientID).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return BasisGuardian, nil
+		}
+
+	case "doctor":
+		// 1. 接诊医生
+		var count int64
+		err := database.DB.Model(&model.Booking{}).
+			Where("patient_id = ? AND doctor_id = ?", patientID, user.ID).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return BasisTreatingDoctor, nil
+		}
+
+		// 2. 科室授权或紧急访问
+		return grantedAccessBasis(user, patientID)
+	}
+
+	return "", nil
+}
+
+// grantedAccessBasis 医生不是接诊医生时，能否凭科室授权或紧急访问查看某位患者的病历
+func grantedAccessBasis(user model.User, patientID uint) (string, error) {
+	if patientID == 0 {
+		return "", nil
+	}
+
+	var count int64
+	// 1. 患者授权了医生所在科室 (没有科室的医生不适用)
+	if user.DepartmentID != nil {
+		err := database.DB.Table("(?) AS c", consentedPatients(*user.DepartmentID)).
+			Where("c.patient_id = ?", patientID).
+			Count(&count).Error
+		if err != nil {
+			return "", err
+		}
+		if count > 0 {
+			return BasisDepartmentConsent, nil
+		}
+	}
+
+	// 2. 紧急访问
+	err := database.DB.Table("(?) AS g", breakGlassPatients(user.ID)).
+		Where("g.patient_id = ?", patientID).
+		Count(&count).Error
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return BasisBreakGlass, nil
+	}
+	return "", nil
+}
+
+// logRecordAccess 写入病历访问日志，recordIDs 为空时记一条汇总访问
+// patientID 为 0 表示前台挂号时未建档的患者，此时只能按 patientName 审查
+func logRecordAccess(c *gin.Context, patientID uint, patientName string, recordIDs []uint, action, basis, reason string) {
+	if len(recordIDs) == 0 {
+		recordIDs = []uint{0}
+	}
+
+	logs := make([]model.RecordAccessLog, 0, len(recordIDs))
+	for _, id := range recordIDs {
+		logs = append(logs, model.RecordAccessLog{
+			UserID:      c.GetUint("user_id"),
+			Role:        c.GetString("role"),
+			PatientID:   patientID,
+			PatientName: patientName,
+			RecordID:    id,
+			Action:      action,
+			Basis:       basis,
+			Reason:      reason,
+			IP:          c.ClientIP(),
+			CreatedAt:   time.Now(),
+		})
+	}
+
+	// 日志写入失败不影响业务，但必须留下痕迹
+	if err := database.DB.Create(&logs).Error; err != nil {
+		logging.Errorf("写入病历访问日志失败: %v", err)
+	}
+}
+
+// --- 患者授权 (Consent) ---
+
+type ConsentRequest struct {
+	DepartmentID  uint `json:"department_id" binding:"required"`
+	ExpiresInDays int  `json:"expires_in_days"` // 0 表示长期有效
+}
+
+// GetConsents 患者查看自己的授权
+func GetConsents(c *gin.Context) {
+	var currentUser model.User
+	if err := database.DB.First(&currentUser, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+
+	var consents []model.RecordConsent
+	if currentUser.PatientID != nil {
+		database.DB.Where("patient_id = ?", *currentUser.PatientID).Order("created_at desc").Find(&consents)
+	}
+	c.JSON(http.StatusOK, gin.H{"data": consents})
+}
+
+// GrantConsent 患者授权某科室的医生查看自己的病历
+func GrantConsent(c *gin.Context) {
+	var req ConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	var currentUser model.User
+	if err := database.DB.First(&currentUser, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+
+	var dept model.Department
+	if err := database.DB.Where("id = ? AND active = ?", req.DepartmentID, true).First(&dept).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请选择授权的科室"})
+		return
+	}
+
+	// 授权按患者档案生效，账号没有关联档案时无从授权
+	var patient model.Patient
+	if currentUser.PatientID == nil || database.DB.First(&patient, *currentUser.PatientID).Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "账号未关联患者档案"})
+		return
+	}
+
+	consent := model.RecordConsent{
+		PatientID:    patient.ID,
+		PatientName:  patient.Name,
+		Department:   dept.Name,
+		DepartmentID: &dept.ID,
+		GrantedBy:    currentUser.ID,
+		CreatedAt:    time.Now(),
+	}
+	if req.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		consent.ExpiresAt = &expires
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Create(&consent).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "授权失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "授权成功", "data": consent})
+}
+
+// RevokeConsent 患者撤销授权
+func RevokeConsent(c *gin.Context) {
+	var currentUser model.User
+	if err := database.DB.First(&currentUser, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+
+	var consent model.RecordConsent
+	if currentUser.PatientID == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "授权不存在"})
+		return
+	}
+	if err := database.DB.Where("id = ? AND patient_id = ?", c.Param("id"), *currentUser.PatientID).First(&consent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "授权不存在"})
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.WithContext(c.Request.Context()).Model(&consent).Update("revoked_at", &now).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "已撤销授权"})
+}
+
+// --- 紧急访问 (Break the Glass) ---
+
+type BreakGlassRequest struct {
+	PatientID uint   `json:"patient_id" binding:"required"`
+	Reason    string `json:"reason" binding:"required"`
+}
+
+// BreakGlass 医生在紧急情况下临时获取某位患者的病历访问权限
+func BreakGlass(c *gin.Context) {
+	var req BreakGlassRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "必须指定患者档案并填写紧急访问理由"})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if len([]rune(reason)) < breakGlassMinReason {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请详细填写紧急访问理由"})
+		return
+	}
+
+	// 只能针对确实存在的档案申请，已匿名化的档案没有可看的内容
+	var patient model.Patient
+	if err := database.DB.Where("anonymized_at IS NULL").First(&patient, req.PatientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者档案不存在"})
+		return
+	}
+
+	grant := model.BreakGlassGrant{
+		UserID:      c.GetUint("user_id"),
+		PatientID:   patient.ID,
+		PatientName: patient.Name,
+		Reason:      reason,
+		ExpiresAt:   time.Now().Add(breakGlassDuration),
+		CreatedAt:   time.Now(),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&grant).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "紧急访问申请失败"})
+		return
+	}
+
+	// 运行日志只记授权编号，患者和理由在访问日志里按权限查看
+	log.Printf("【紧急访问】用户 %d 获得紧急访问授权 #%d", grant.UserID, grant.ID)
+	logRecordAccess(c, patient.ID, patient.Name, nil, "break_glass", BasisBreakGlass, reason)
+
+	c.JSON(http.StatusOK, gin.H{"msg": "已获得临时访问权限", "data": grant})
+}
+
+// --- 访问日志审查 ---
+
+// GetRecordAccessLogs 管理员查看病历访问日志
+// 参数: patient_id, patient_name, user_id, basis, action, page, page_size
+func GetRecordAccessLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tx := database.DB.Model(&model.RecordAccessLog{})
+	if v := c.Query("patient_id"); v != "" {
+		tx = tx.Where("patient_id = ?", v)
+	}
+	if v := c.Query("patient_name"); v != "" {
+		tx = tx.Where("patient_name = ?", v)
+	}
+	if v := c.Query("user_id"); v != "" {
+		tx = tx.Where("user_id = ?", v)
+	}
+	if v := c.Query("basis"); v != "" {
+		tx = tx.Where("basis = ?", v)
+	}
+	if v := c.Query("action"); v != "" {
+		tx = tx.Where("action = ?", v)
+	}
+
+	var total int64
+	tx.Count(&total)
+
+	var logs []model.RecordAccessLog
+	if err := tx.Order("created_at desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取访问日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": logs, "total": total, "page": page, "page_size": pageSize})
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// accessFixture 两位同名患者各有一次就诊，分别由 doctor 和 other 接诊
+type accessFixture struct {
+	alice, namesake             model.Patient // 同名的两份档案
+	account                     model.User    // alice 的患者账号
+	doctor, other, intern       model.User    // intern 是内科医生，不接诊任何人
+	medicine                    model.Department
+	aliceRecord, namesakeRecord model.MedicalRecord
+}
+
+func seedAccess(t *testing.T, db *gorm.DB) accessFixture {
+	t.Helper()
+	var f accessFixture
+	f.alice = model.Patient{Name: "张三"}
+	f.namesake = model.Patient{Name: "张三"}
+	for _, p := range []*model.Patient{&f.alice, &f.namesake} {
+		if err := db.Create(p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.account = model.User{Username: "zhangsan", Password: "x", Role: "general_user", PatientID: &f.alice.ID, OrgID: 1, Enabled: true}
+	if err := db.Create(&f.account).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.doctor = createStaff(t, db, "doc_a", "doctor", nil)
+	f.other = createStaff(t, db, "doc_b", "doctor", nil)
+	f.medicine = model.Department{OrgID: 1, Code: "D001", Name: "内科", Active: true}
+	if err := db.Create(&f.medicine).Error; err != nil {
+		t.Fatal(err)
+	}
+	f.intern = createStaff(t, db, "doc_c", "doctor", &f.medicine)
+
+	f.aliceRecord = seedVisit(t, db, f.alice, f.doctor.ID)
+	f.namesakeRecord = seedVisit(t, db, f.namesake, f.other.ID)
+	return f
+}
+
+// seedVisit 一次挂号及其病历
+func seedVisit(t *testing.T, db *gorm.DB, p model.Patient, doctorID uint) model.MedicalRecord {
+	t.Helper()
+	b := model.Booking{PatientName: p.Name, PatientID: &p.ID, Department: "内科", DoctorID: doctorID, Status: "Completed"}
+	if err := db.Create(&b).Error; err != nil {
+		t.Fatal(err)
+	}
+	rec := model.MedicalRecord{BookingID: b.ID, Diagnosis: fmt.Sprintf("诊断 %d", p.ID)}
+	if err := db.Create(&rec).Error; err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// as 以某个用户的身份调用
+func as(user model.User) caller {
+	return caller{UserID: user.ID, Role: user.Role, OrgID: user.OrgID}
+}
+
+// listRecords 以某个用户调用 GetMedicalRecords，返回看到的病历 ID
+func listRecords(t *testing.T, user model.User) map[uint]string {
+	t.Helper()
+	w := as(user).get(t, GetMedicalRecords, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data []MedicalRecordDetail `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint]string)
+	for _, r := range resp.Data {
+		seen[r.ID] = r.AccessBasis
+	}
+	return seen
+}
+
+// 接诊医生只能看到自己接诊的患者，同名的另一位患者看不到
+func TestTreatingDoctorDoesNotSeeNamesake(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		f := seedAccess(t, db)
+
+		seen := listRecords(t, f.doctor)
+		if seen[f.aliceRecord.ID] != BasisTreatingDoctor {
+			t.Fatalf("接诊医生应能看到自己接诊的病历: %v", seen)
+		}
+		if _, ok := seen[f.namesakeRecord.ID]; ok {
+			t.Fatalf("不应看到同名患者的病历: %v", seen)
+		}
+
+		basis, err := patientAccessBasis(f.doctor, f.namesake.ID)
+		if err != nil || basis != "" {
+			t.Fatalf("同名患者的访问依据 = %q, %v, 期望无权", basis, err)
+		}
+	})
+}
+
+// 科室授权：授权后本科室医生可以看，撤销后不能看，也不会顺带授权同名患者和其他机构的同名科室
+func TestDepartmentConsent(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		f := seedAccess(t, db)
+		patient := as(f.account)
+		otherOrg := model.Department{OrgID: 2, Code: "D001", Name: "内科", Active: true}
+		db.Create(&otherOrg)
+		outsider := createStaff(t, db, "doc_d", "doctor", &otherOrg)
+
+		if w := patient.call(t, GrantConsent, http.MethodPost, map[string]interface{}{"department_id": f.medicine.ID}); w.Code != http.StatusOK {
+			t.Fatalf("授权失败 %d: %s", w.Code, w.Body.String())
+		}
+		var consent model.RecordConsent
+		db.First(&consent)
+		if consent.PatientID != f.alice.ID {
+			t.Fatalf("授权的档案 = %d, 期望 %d", consent.PatientID, f.alice.ID)
+		}
+
+		seen := listRecords(t, f.intern)
+		if seen[f.aliceRecord.ID] != BasisDepartmentConsent {
+			t.Fatalf("授权科室的医生应能看到病历: %v", seen)
+		}
+		if _, ok := seen[f.namesakeRecord.ID]; ok {
+			t.Fatalf("授权不应扩展到同名患者: %v", seen)
+		}
+
+		// 没有科室的医生不适用科室授权，其他机构同名科室的医生也不适用
+		if basis, _ := patientAccessBasis(f.other, f.alice.ID); basis != "" {
+			t.Fatalf("无科室医生的访问依据 = %q, 期望无权", basis)
+		}
+		if basis, _ := patientAccessBasis(outsider, f.alice.ID); basis != "" {
+			t.Fatalf("其他机构同名科室医生的访问依据 = %q, 期望无权", basis)
+		}
+
+		// 科室改名后授权继续有效，展示的名称随之更新
+		admin := createStaff(t, db, "admin", "global_admin", nil)
+		w := as(admin).call(t, UpdateDepartment, http.MethodPut, map[string]interface{}{"code": "D001", "name": "普通内科"}, "id", fmt.Sprint(f.medicine.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("科室改名失败 %d: %s", w.Code, w.Body.String())
+		}
+		f.intern.Department = "普通内科"
+		if basis, _ := patientAccessBasis(f.intern, f.alice.ID); basis != BasisDepartmentConsent {
+			t.Fatalf("改名后访问依据 = %q, 期望 %q", basis, BasisDepartmentConsent)
+		}
+		db.First(&consent, consent.ID)
+		if consent.Department != "普通内科" {
+			t.Fatalf("授权上的科室名称 = %q, 期望随改名更新", consent.Department)
+		}
+		var untouched model.Department
+		db.First(&untouched, otherOrg.ID)
+		if untouched.Name != "内科" {
+			t.Fatalf("其他机构的同名科室被改名为 %q", untouched.Name)
+		}
+
+		if w := patient.call(t, RevokeConsent, http.MethodDelete, nil, "id", fmt.Sprint(consent.ID)); w.Code != http.StatusOK {
+			t.Fatalf("撤销失败 %d: %s", w.Code, w.Body.String())
+		}
+		if seen := listRecords(t, f.intern); len(seen) != 0 {
+			t.Fatalf("撤销后不应再看到病历: %v", seen)
+		}
+	})
+}
+
+// 紧急访问：理由太短被拒绝；获批后只能看指定档案，日志记录档案 ID
+func TestBreakGlass(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		f := seedAccess(t, db)
+		doc := as(f.intern)
+
+		w := doc.call(t, BreakGlass, http.MethodPost, map[string]interface{}{"patient_id": f.alice.ID, "reason": "急"})
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("理由太短: 状态码 %d, 期望 400", w.Code)
+		}
+		w = doc.call(t, BreakGlass, http.MethodPost, map[string]interface{}{"patient_id": 9999, "reason": "患者昏迷送急诊"})
+		if w.Code != http.StatusNotFound {
+			t.Fatalf("档案不存在: 状态码 %d, 期望 404", w.Code)
+		}
+		w = doc.call(t, BreakGlass, http.MethodPost, map[string]interface{}{"patient_id": f.alice.ID, "reason": "患者昏迷送急诊"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("紧急访问失败 %d: %s", w.Code, w.Body.String())
+		}
+
+		seen := listRecords(t, f.intern)
+		if seen[f.aliceRecord.ID] != BasisBreakGlass || len(seen) != 1 {
+			t.Fatalf("紧急访问应只看到指定患者的病历: %v", seen)
+		}
+
+		var logs []model.RecordAccessLog
+		db.Where("user_id = ? AND basis = ?", f.intern.ID, BasisBreakGlass).Find(&logs)
+		if len(logs) != 2 {
+			t.Fatalf("访问日志 %d 条, 期望 2 条 (申请 + 查看)", len(logs))
+		}
+		for _, l := range logs {
+			if l.PatientID != f.alice.ID {
+				t.Fatalf("访问日志的档案 = %d, 期望 %d", l.PatientID, f.alice.ID)
+			}
+		}
+
+		// 过期后失效
+		db.Model(&model.BreakGlassGrant{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+		if seen := listRecords(t, f.intern); len(seen) != 0 {
+			t.Fatalf("过期后不应再看到病历: %v", seen)
+		}
+	})
+}
+
+// 监护人：登记的家属可以看，解除后不能看，同名的另一位患者始终不能看
+func TestGuardianAccess(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		f := seedAccess(t, db)
+		child := model.Patient{Name: "小明"}
+		db.Create(&child)
+		dep := model.Dependent{GuardianID: f.account.ID, PatientID: child.ID, PatientName: child.Name, Relationship: "child", ConsentMethod: "guardian"}
+		db.Create(&dep)
+
+		cases := []struct {
+			patientID uint
+			want      string
+		}{
+			{f.alice.ID, BasisPatient},
+			{child.ID, BasisGuardian},
+			{f.namesake.ID, ""},
+			{0, ""},
+		}
+		for _, tc := range cases {
+			basis, err := patientAccessBasis(f.account, tc.patientID)
+			if err != nil || basis != tc.want {
+				t.Fatalf("档案 %d 的访问依据 = %q, %v, 期望 %q", tc.patientID, basis, err, tc.want)
+			}
+		}
+
+		now := time.Now()
+		db.Model(&dep).Update("revoked_at", &now)
+		if basis, _ := patientAccessBasis(f.account, child.ID); basis != "" {
+			t.Fatalf("解除家属关系后访问依据 = %q, 期望无权", basis)
+		}
+	})
+}
+
+// 挂号员、管理员不能直接查看病历
+func TestStaffCannotListRecords(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		seedAccess(t, db)
+		for _, role := range []string{"registration", "global_admin"} {
+			staff := createStaff(t, db, "staff_"+role, role, nil)
+			if w := as(staff).get(t, GetMedicalRecords, ""); w.Code != http.StatusForbidden {
+				t.Fatalf("%s: 状态码 %d, 期望 403", role, w.Code)
+			}
+		}
+	})
+}
+
+// 合并科室：对原科室的授权转给合并后的科室
+func TestMergeDepartmentMovesConsent(t *testing.T) {
+	useConfig(t)
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		f := seedAccess(t, db)
+		typo := model.Department{OrgID: 1, Code: "D002", Name: "内料", Active: true}
+		db.Create(&typo)
+		db.Create(&model.RecordConsent{PatientID: f.alice.ID, PatientName: "张三", Department: typo.Name, DepartmentID: &typo.ID, GrantedBy: f.account.ID})
+
+		admin := createStaff(t, db, "admin", "global_admin", nil)
+		w := as(admin).call(t, MergeDepartment, http.MethodPost, map[string]interface{}{"source_id": typo.ID}, "id", fmt.Sprint(f.medicine.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("合并失败 %d: %s", w.Code, w.Body.String())
+		}
+		if basis, _ := patientAccessBasis(f.intern, f.alice.ID); basis != BasisDepartmentConsent {
+			t.Fatalf("合并后访问依据 = %q, 期望 %q", basis, BasisDepartmentConsent)
+		}
+	})
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"hospital-system/internal/storage"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 病历附件 (Record Attachments) ---
+// 对应路由：GET    /api/v1/dashboard/medical_record/:id/attachments
+//          POST   /api/v1/dashboard/medical_record/:id/attachments (multipart: file, kind, note)
+//          GET    /api/v1/dashboard/medical_record/:id/attachments/:aid/download (支持 Range 断点续传)
+//          DELETE /api/v1/dashboard/medical_record/:id/attachments/:aid
+// 能看到病历的人才能看到和下载附件 (规则见 record_access.go)，每次访问都写入访问日志
+// 只有能访问该病历的医生可以上传，只有上传者本人可以删除
+
+// 附件类型
+var attachmentKinds = map[string]bool{
+	"report":  true, // 外院检查报告
+	"image":   true, // 影像 / 照片
+	"consent": true, // 签字的知情同意书
+	"other":   true,
+}
+
+// 每份病历的附件数量上限
+const maxAttachmentsPerRecord = 50
+
+// AttachmentDetail 附件列表项
+type AttachmentDetail struct {
+	model.RecordAttachment
+	FileName     string `json:"file_name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"` // 下载后可据此校验文件完整性
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	UploaderName string `json:"uploader_name"`
+}
+
+// recordRef 病历及其所属挂号的关键信息
+type recordRef struct {
+	ID          uint
+	PatientID   uint // 前台挂号时未建档的为 0
+	PatientName string
+	DoctorID    uint
+}
+
+// recordAccessBasis 判断当前用户能否查看某一份病历，规则与 GetMedicalRecords 一致
+// 医生只有接诊的是这次挂号才算接诊医生，否则需要科室授权或紧急访问
+func recordAccessBasis(user model.User, rec recordRef) (string, error) {
+	switch user.Role {
+	case "general_user":
+		return patientAccessBasis(user, rec.PatientID)
+
+	case "doctor":
+		if rec.DoctorID == user.ID {
+			return BasisTreatingDoctor, nil
+		}
+		return grantedAccessBasis(user, rec.PatientID)
+	}
+	return "", nil
+}
+
+// accessibleRecord 按路由参数 :id 找到当前用户有权查看的病历，返回病历、当前用户和访问依据
+func accessibleRecord(c *gin.Context) (recordRef, model.User, string, bool) {
+	var rec recordRef
+	var user model.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return rec, user, "", false
+	}
+
+	err := database.DB.Table("medical_records").
+		Select("medical_records.id, COALESCE(bookings.patient_id, 0) AS patient_id, bookings.patient_name, bookings.doctor_id").
+		Joins("JOIN bookings ON bookings.id = medical_records.booking_id").
+		Where("medical_records.id = ?", c.Param("id")).
+		Take(&rec).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "病历不存在"})
+		return rec, user, "", false
+	}
+
+	basis, err := recordAccessBasis(user, rec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "权限校验失败"})
+		return rec, user, "", false
+	}
+	if basis == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该病历"})
+		return rec, user, "", false
+	}
+	return rec, user, basis, true
+}
+
+// recordAttachments 病历的附件列表，带上文件信息和上传人
+func recordAttachments(recordID uint) *gorm.DB {
+	return database.DB.Table("record_attachments").
+		Select("record_attachments.*, media_files.original_name AS file_name, media_files.content_type, media_files.size, "+
+			"media_files.sha256, media_files.width, media_files.height, users.username AS uploader_name").
+		Joins("JOIN media_files ON media_files.id = record_attachments.media_id").
+		Joins("LEFT JOIN users ON users.id = record_attachments.uploaded_by").
+		Where("record_attachments.record_id = ?", recordID)
+}
+
+// GetRecordAttachments 查看病历附件列表
+func GetRecordAttachments(c *gin.Context) {
+	rec, _, basis, ok := accessibleRecord(c)
+	if !ok {
+		return
+	}
+
+	var list []AttachmentDetail
+	if err := recordAttachments(rec.ID).Order("record_attachments.id").Scan(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取附件失败"})
+		return
+	}
+	logRecordAccess(c, rec.PatientID, rec.PatientName, []uint{rec.ID}, "view_attachments", basis, "")
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// UploadRecordAttachment 医生给病历上传附件
+// 文件经过类型识别和安全扫描后才写入存储并对患者可见
+func UploadRecordAttachment(c *gin.Context) {
+	kind := c.DefaultPostForm("kind", "other")
+	if !attachmentKinds[kind] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind 只能是 report、image、consent、other"})
+		return
+	}
+	fh, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传文件"})
+		return
+	}
+
+	// 1. 权限：能访问这份病历的医生
+	rec, user, basis, ok := accessibleRecord(c)
+	if !ok {
+		return
+	}
+	var count int64
+	database.DB.Model(&model.RecordAttachment{}).Where("record_id = ?", rec.ID).Count(&count)
+	if count >= maxAttachmentsPerRecord {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "附件数量已达上限"})
+		return
+	}
+
+	// 2. 校验、扫描并写入存储
+	ctx := c.Request.Context()
+	m, status, err := storeUpload(ctx, mediaRecord, fh)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	m.UploadedBy = user.ID
+	m.OrgID = currentOrg(c)
+
+	// 3. 文件和附件记录一起入库
+	att := model.RecordAttachment{
+		RecordID:   rec.ID,
+		Kind:       kind,
+		Note:       strings.TrimSpace(c.PostForm("note")),
+		UploadedBy: user.ID,
+	}
+	err = database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&m).Error; err != nil {
+			return err
+		}
+		att.MediaID = m.ID
+		return tx.Create(&att).Error
+	})
+	if err != nil {
+		removeStored(ctx, m)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	logRecordAccess(c, rec.PatientID, rec.PatientName, []uint{rec.ID}, "upload_attachment", basis, "")
+
+	c.JSON(http.StatusOK, gin.H{"msg": "上传成功", "data": AttachmentDetail{
+		RecordAttachment: att,
+		FileName:         m.OriginalName,
+		ContentType:      m.ContentType,
+		Size:             m.Size,
+		SHA256:           m.SHA256,
+		Width:            m.Width,
+		Height:           m.Height,
+		UploaderName:     user.Username,
+	}})
+}
+
+// DownloadRecordAttachment 下载病历附件，支持 Range 请求 (大文件断点续传)
+func DownloadRecordAttachment(c *gin.Context) {
+	rec, _, basis, ok := accessibleRecord(c)
+	if !ok {
+		return
+	}
+
+	var att model.RecordAttachment
+	if err := database.DB.Where("record_id = ?", rec.ID).First(&att, c.Param("aid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+	var m model.MediaFile
+	if err := database.DB.First(&m, att.MediaID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+
+	f, err := storage.Default.Open(c.Request.Context(), m.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件文件已丢失"})
+		return
+	}
+	if err != nil {
+		logging.Warnf("读取附件 %s 失败: %v", m.Key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取附件失败"})
+		return
+	}
+	defer f.Close()
+
+	// 断点续传的后续分段不重复记日志
+	if c.GetHeader("Range") == "" {
+		logRecordAccess(c, rec.PatientID, rec.PatientName, []uint{rec.ID}, "download_attachment", basis, "")
+	}
+
+	h := c.Writer.Header()
+	h.Set("Content-Type", m.ContentType)
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": m.OriginalName}))
+	h.Set("Cache-Control", "private, no-store")
+	h.Set("ETag", `"`+m.SHA256+`"`)
+	h.Set("X-Checksum-SHA256", m.SHA256)
+	h.Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, "", m.CreatedAt, f)
+}
+
+// DeleteRecordAttachment 删除病历附件 (仅上传者本人，且仍有权访问该病历)
+func DeleteRecordAttachment(c *gin.Context) {
+	rec, user, basis, ok := accessibleRecord(c)
+	if !ok {
+		return
+	}
+
+	var att model.RecordAttachment
+	if err := database.DB.Where("record_id = ?", rec.ID).First(&att, c.Param("aid")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "附件不存在"})
+		return
+	}
+	if att.UploadedBy != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只能删除自己上传的附件"})
+		return
+	}
+
+	var m model.MediaFile
+	database.DB.First(&m, att.MediaID)
+
+	ctx := c.Request.Context()
+	err := database.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&att).Error; err != nil {
+			return err
+		}
+		if m.ID == 0 {
+			return nil
+		}
+		return tx.Delete(&m).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	removeStored(ctx, m)
+	logRecordAccess(c, rec.PatientID, rec.PatientName, []uint{rec.ID}, "delete_attachment", basis, "")
+	c.JSON(http.StatusOK, gin.H{"msg": "已删除"})
+}
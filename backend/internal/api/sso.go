@@ -0,0 +1,271 @@
+package api
+
+import (
+	"errors"
+	"hospital-system/config"
+	"hospital-system/internal/api/middleware"
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"hospital-system/internal/oidc"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// --- 员工统一身份认证 (SSO / OIDC) ---
+// 对应路由：GET /api/v1/oidc/login -> 跳转 IdP 登录页
+//          GET /api/v1/oidc/callback -> IdP 回调，换取本系统 Token
+// 首次登录的员工按用户组自动建号 (角色、科室由配置映射)，之后每次登录同步角色和科室
+
+// 登录过程中 state / nonce / PKCE verifier 存在签名过的 Cookie 里
+const (
+	oidcCookieName = "oidc_login"
+	oidcCookiePath = "/api/v1/oidc"
+	oidcLoginTTL   = 10 * time.Minute
+)
+
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *oidc.Provider
+)
+
+// getOIDCProvider 首次使用时做 Discovery，成功后缓存 (IdP 暂时不可用不影响服务启动)
+func getOIDCProvider(c *gin.Context) (*oidc.Provider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+
+	cfg := config.Get().Auth.OIDC
+	p, err := oidc.NewProvider(c.Request.Context(), oidc.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       cfg.Scopes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = p
+	return p, nil
+}
+
+// OIDCLogin 跳转到身份提供方登录
+func OIDCLogin(c *gin.Context) {
+	if !config.Get().Auth.OIDC.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用统一身份认证"})
+		return
+	}
+	provider, err := getOIDCProvider(c)
+	if err != nil {
+		logging.Errorf("OIDC 初始化失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "统一身份认证服务暂不可用"})
+		return
+	}
+
+	state, nonce, verifier := oidc.NewRandom(), oidc.NewRandom(), oidc.NewRandom()
+	cookie, err := middleware.SignToken(middleware.TypeOIDCState, jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcLoginTTL).Unix(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token生成失败"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcCookieName, cookie, int(oidcLoginTTL.Seconds()), oidcCookiePath, "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, provider.AuthURL(state, nonce, verifier))
+}
+
+// OIDCCallback IdP 登录完成后的回调
+func OIDCCallback(c *gin.Context) {
+	if !config.Get().Auth.OIDC.Enabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用统一身份认证"})
+		return
+	}
+
+	// 1. 用户在 IdP 取消登录或 IdP 报错
+	if e := c.Query("error"); e != "" {
+		ssoFailed(c, http.StatusUnauthorized, "统一身份认证失败: "+e)
+		return
+	}
+
+	// 2. 校验 state，防止 CSRF
+	raw, err := c.Cookie(oidcCookieName)
+	if err != nil {
+		ssoFailed(c, http.StatusBadRequest, "登录已超时，请重新登录")
+		return
+	}
+	c.SetCookie(oidcCookieName, "", -1, oidcCookiePath, "", c.Request.TLS != nil, true)
+
+	claims, err := middleware.ParseToken(raw, middleware.TypeOIDCState)
+	if err != nil || claims["state"] != c.Query("state") {
+		ssoFailed(c, http.StatusBadRequest, "登录已超时，请重新登录")
+		return
+	}
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+
+	// 3. 授权码换取 id_token
+	provider, err := getOIDCProvider(c)
+	if err != nil {
+		logging.Errorf("OIDC 初始化失败: %v", err)
+		ssoFailed(c, http.StatusBadGateway, "统一身份认证服务暂不可用")
+		return
+	}
+	idClaims, err := provider.Exchange(c.Request.Context(), c.Query("code"), verifier, nonce, config.Get().Auth.OIDC.GroupsClaim)
+	if err != nil {
+		logging.Warnf("OIDC 登录失败: %v", err)
+		ssoFailed(c, http.StatusUnauthorized, "统一身份认证失败")
+		return
+	}
+
+	// 4. 按需建号 / 同步角色
+	user, status, err := provisionSSOUser(c, idClaims)
+	if err != nil {
+		ssoFailed(c, status, err.Error())
+		return
+	}
+
+	// 5. 签发本系统 Token
+	frontend := config.Get().Auth.OIDC.FrontendRedirect
+	if frontend == "" {
+		respondLogin(c, user)
+		return
+	}
+	token, err := issueToken(user)
+	if err != nil {
+		ssoFailed(c, http.StatusInternalServerError, "Token生成失败")
+		return
+	}
+	// Token 放在 URL 片段里，不会出现在服务器访问日志和 Referer 中
+	c.Redirect(http.StatusFound, frontend+"#"+url.Values{"token": {token}}.Encode())
+}
+
+// ssoFailed 配置了前端地址时带着错误跳回前端，否则返回 JSON
+func ssoFailed(c *gin.Context, status int, msg string) {
+	if frontend := config.Get().Auth.OIDC.FrontendRedirect; frontend != "" {
+		c.Redirect(http.StatusFound, frontend+"#"+url.Values{"error": {msg}}.Encode())
+		return
+	}
+	c.JSON(status, gin.H{"error": msg})
+}
+
+// provisionSSOUser 找到或创建 SSO 对应的本地账号，返回 (用户, 失败时的状态码, 错误)
+func provisionSSOUser(c *gin.Context, claims *oidc.Claims) (model.User, int, error) {
+	cfg := config.Get().Auth.OIDC
+
+	// 1. 用户组映射为角色，没有命中的人不允许登录
+	role := ""
+	for _, m := range cfg.RoleMappings {
+		if containsString(claims.Groups, m.Group) {
+			role = m.Role
+			break
+		}
+	}
+	if role == "" {
+		return model.User{}, http.StatusForbidden, errors.New("您所在的用户组未被授权访问本系统")
+	}
+	orgID := cfg.OrgID
+	if orgID == 0 {
+		orgID = 1
+	}
+	var dept *model.Department
+	for _, m := range cfg.DepartmentMappings {
+		if containsString(claims.Groups, m.Group) {
+			var err error
+			if dept, err = resolveDepartment(database.DB, orgID, nil, m.Department); err != nil {
+				// 配置写错不影响登录，只是不分配科室
+				logging.Warnf("OIDC 科室映射 %s -> %s 无效: %v", m.Group, m.Department, err)
+			}
+			break
+		}
+	}
+
+	db := database.DB.WithContext(c.Request.Context())
+	subject := cfg.Issuer + "#" + claims.Subject
+
+	// 2. 已经建过号：同步角色和科室
+	var user model.User
+	err := database.DB.Unscoped().Where("external_subject = ?", subject).First(&user).Error
+	if err == nil {
+		if user.DeletedAt.Valid || !user.Enabled {
+			return user, http.StatusForbidden, errors.New(disabledMsg)
+		}
+		oldRole, oldDepartmentID := user.Role, user.DepartmentID
+		assignDepartment(&user, dept)
+		if oldRole != role || !sameID(oldDepartmentID, user.DepartmentID) {
+			// 角色变化后旧 Token 中的角色已经不对，全部作废
+			if oldRole != role {
+				user.TokenVersion++
+			}
+			user.Role = role
+			if err := db.Model(&user).Select("role", "department", "department_id", "token_version").Updates(&user).Error; err != nil {
+				return user, http.StatusInternalServerError, errors.New("同步账号信息失败")
+			}
+		}
+		return user, 0, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, http.StatusInternalServerError, errors.New("查询账号失败")
+	}
+
+	// 3. 首次登录：自动建号
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = claims.Subject
+	}
+	var count int64
+	database.DB.Unscoped().Model(&model.User{}).Where("username = ?", username).Count(&count)
+	if count > 0 {
+		// 不自动与同名本地账号合并，避免冒用
+		return user, http.StatusConflict, errors.New("用户名 " + username + " 已被本地账号占用，请联系管理员")
+	}
+
+	user = model.User{
+		Username:        username,
+		Password:        oidc.NewRandom(), // 随机密码，SSO 账号不能用密码登录
+		Role:            role,
+		OrgID:           orgID,
+		AuthSource:      model.AuthSourceOIDC,
+		ExternalSubject: &subject,
+	}
+	assignDepartment(&user, dept)
+	if err := db.Create(&user).Error; err != nil {
+		return user, http.StatusInternalServerError, errors.New("创建账号失败")
+	}
+	log.Printf("统一身份认证用户 %s 首次登录，已创建账号 (角色 %s)", username, role)
+	return user, 0, nil
+}
+
+// sameID 比较两个可空 ID
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,345 @@
+package api
+
+import (
+	"fmt"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// --- 患者时间线 (Timeline) ---
+// 对应页面：/timeline
+// 把挂号、诊断、处方、检验、订单、缴费合并成一条按时间排序的记录
+// 访问规则与病历相同 (见 record_access.go)
+
+// 时间线事件类型
+const (
+	EventBooking      = "booking"
+	EventDiagnosis    = "diagnosis"
+	EventPrescription = "prescription"
+	EventLabResult    = "lab_result"
+	EventOrder        = "order"
+	EventPayment      = "payment"
+)
+
+var timelineEventTypes = []string{EventBooking, EventDiagnosis, EventPrescription, EventLabResult, EventOrder, EventPayment}
+
+// timelineEventRank 事件类型在 timelineEventTypes 中的位置，时间相同时按此排序
+var timelineEventRank = func() map[string]int {
+	rank := make(map[string]int, len(timelineEventTypes))
+	for i, t := range timelineEventTypes {
+		rank[t] = i
+	}
+	return rank
+}()
+
+// TimelineEvent 时间线上的一条事件
+type TimelineEvent struct {
+	Type      string      `json:"type"`
+	Time      time.Time   `json:"time"`
+	BookingID uint        `json:"booking_id"`
+	RefID     uint        `json:"ref_id"` // 对应业务表的主键
+	Summary   string      `json:"summary"`
+	Data      interface{} `json:"data"`
+}
+
+// GetPatientTimeline 获取患者的就诊时间线
+// 参数: patient_id (患者本人无需传，查看家属时传家属的档案 ID), types=booking,diagnosis,..., page, page_size
+func GetPatientTimeline(c *gin.Context) {
+	role := c.GetString("role")
+	userID := c.GetUint("user_id")
+	requested, _ := strconv.ParseUint(c.Query("patient_id"), 10, 64)
+	patientID := uint(requested)
+
+	// 1. 权限分流：确定能看谁的时间线
+	var currentUser model.User
+	if err := database.DB.First(&currentUser, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户身份异常"})
+		return
+	}
+	if role == "general_user" {
+		// 患者不指定时看自己的，指定时只能是家属 (下面统一判断)
+		patientID = ownPatientID(currentUser, patientID)
+	}
+	if patientID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定患者档案"})
+		return
+	}
+
+	// 时间线包含诊断内容，和病历使用同一套访问规则
+	basis, err := patientAccessBasis(currentUser, patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "权限校验失败"})
+		return
+	}
+	if basis == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权查看该患者的就诊记录"})
+		return
+	}
+	var patient model.Patient
+	database.DB.First(&patient, patientID)
+	logRecordAccess(c, patientID, patient.Name, nil, "view_timeline", basis, "")
+
+	// 2. 解析事件类型过滤
+	wanted, err := parseEventTypes(c.Query("types"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 3. 解析分页参数
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	// 4. 收集事件
+	events, err := collectTimelineEvents(patientID, wanted)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取时间线失败"})
+		return
+	}
+
+	// 5. 按时间正序排列，时间相同时按类型顺序 (挂号 -> 诊断 -> ... -> 缴费)
+	sortTimelineEvents(events)
+
+	total := len(events)
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"patient_id":   patientID,
+		"patient_name": patient.Name,
+		"data":         events[start:end],
+		"total":        total,
+		"page":         page,
+		"page_size":    pageSize,
+	})
+}
+
+// sortTimelineEvents 按时间正序排列，时间相同时按事件类型顺序
+func sortTimelineEvents(events []TimelineEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Time.Equal(events[j].Time) {
+			return events[i].Time.Before(events[j].Time)
+		}
+		return timelineEventRank[events[i].Type] < timelineEventRank[events[j].Type]
+	})
+}
+
+// parseEventTypes 解析 types 参数，为空时返回全部类型
+func parseEventTypes(raw string) (map[string]bool, error) {
+	wanted := make(map[string]bool)
+	if raw == "" {
+		for _, t := range timelineEventTypes {
+			wanted[t] = true
+		}
+		return wanted, nil
+	}
+
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.TrimSpace(t)
+		valid := false
+		for _, known := range timelineEventTypes {
+			if t == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("未知的事件类型: %s", t)
+		}
+		wanted[t] = true
+	}
+	return wanted, nil
+}
+
+// collectTimelineEvents 查询某位患者的所有业务记录并转换成事件
+func collectTimelineEvents(patientID uint, wanted map[string]bool) ([]TimelineEvent, error) {
+	events := []TimelineEvent{}
+
+	// A. 挂号记录是所有事件的起点
+	var bookings []model.Booking
+	if err := database.DB.Where("patient_id = ?", patientID).Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+	if len(bookings) == 0 {
+		return events, nil
+	}
+
+	bookingIDs := make([]uint, 0, len(bookings))
+	for _, b := range bookings {
+		bookingIDs = append(bookingIDs, b.ID)
+		if wanted[EventBooking] {
+			events = append(events, TimelineEvent{
+				Type:      EventBooking,
+				Time:      b.CreatedAt,
+				BookingID: b.ID,
+				RefID:     b.ID,
+				Summary:   "挂号: " + b.Department,
+				Data:      b,
+			})
+		}
+	}
+
+	// B. 病历 -> 诊断 + 处方
+	if wanted[EventDiagnosis] || wanted[EventPrescription] {
+		var records []model.MedicalRecord
+		if err := database.DB.Where("booking_id IN ?", bookingIDs).Find(&records).Error; err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if wanted[EventDiagnosis] {
+				events = append(events, TimelineEvent{
+					Type:      EventDiagnosis,
+					Time:      r.CreatedAt,
+					BookingID: r.BookingID,
+					RefID:     r.ID,
+					Summary:   "诊断: " + r.Diagnosis,
+					Data:      r,
+				})
+			}
+			if wanted[EventPrescription] && r.Prescription != "" {
+				events = append(events, TimelineEvent{
+					Type:      EventPrescription,
+					Time:      r.CreatedAt,
+					BookingID: r.BookingID,
+					RefID:     r.ID,
+					Summary:   "处方: " + r.Prescription,
+					Data:      r,
+				})
+			}
+		}
+	}
+
+	// C. 检验结果
+	if wanted[EventLabResult] {
+		var labs []model.LabResult
+		if err := database.DB.Where("booking_id IN ?", bookingIDs).Find(&labs).Error; err != nil {
+			return nil, err
+		}
+		for _, l := range labs {
+			summary := "检验: " + l.ItemName + " " + l.Result + l.Unit
+			if l.Abnormal {
+				summary += " (异常)"
+			}
+			events = append(events, TimelineEvent{
+				Type:      EventLabResult,
+				Time:      l.CreatedAt,
+				BookingID: l.BookingID,
+				RefID:     l.ID,
+				Summary:   summary,
+				Data:      l,
+			})
+		}
+	}
+
+	// D. 订单 -> 开单 + 缴费 (已支付订单以 updated_at 作为缴费时间)
+	if wanted[EventOrder] || wanted[EventPayment] {
+		var orders []OrderDetail
+		err := database.DB.Table("orders").
+			Select("orders.*, bookings.patient_name, inventory_items.name as medicine_name, inventory_items.price as medicine_price").
+			Joins("JOIN bookings ON bookings.id = orders.booking_id").
+			Joins("LEFT JOIN inventory_items ON inventory_items.id = orders.medicine_id").
+			Where("orders.booking_id IN ?", bookingIDs).
+			Scan(&orders).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range orders {
+			if wanted[EventOrder] {
+				events = append(events, TimelineEvent{
+					Type:      EventOrder,
+					Time:      o.CreatedAt,
+					BookingID: o.BookingID,
+					RefID:     o.ID,
+					Summary:   fmt.Sprintf("开单: %s x %d, 金额 %.2f", o.MedicineName, o.Quantity, o.TotalAmount),
+					Data:      o,
+				})
+			}
+			if wanted[EventPayment] && o.Status == "Paid" {
+				paidAt := o.UpdatedAt
+				if paidAt.IsZero() {
+					// 历史数据可能没有 updated_at，退回到开单时间
+					paidAt = o.CreatedAt
+				}
+				events = append(events, TimelineEvent{
+					Type:      EventPayment,
+					Time:      paidAt,
+					BookingID: o.BookingID,
+					RefID:     o.ID,
+					Summary:   fmt.Sprintf("缴费: %.2f", o.TotalAmount),
+					Data:      o,
+				})
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// LabResultRequest 医生录入检验结果的参数
+type LabResultRequest struct {
+	BookingID      uint   `json:"booking_id" binding:"required"`
+	ItemName       string `json:"item_name" binding:"required"`
+	Result         string `json:"result" binding:"required"`
+	Unit           string `json:"unit"`
+	ReferenceRange string `json:"reference_range"`
+	Abnormal       bool   `json:"abnormal"`
+}
+
+// SubmitLabResult 录入检验结果
+func SubmitLabResult(c *gin.Context) {
+	var req LabResultRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	role := c.GetString("role")
+	userID := c.GetUint("user_id")
+
+	var booking model.Booking
+	if err := database.DB.First(&booking, req.BookingID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "挂号记录不存在"})
+		return
+	}
+	// 医生只能给自己接诊的挂号录入结果
+	if role == "doctor" && booking.DoctorID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "您不是该患者的接诊医生"})
+		return
+	}
+
+	lab := model.LabResult{
+		BookingID:      req.BookingID,
+		ItemName:       req.ItemName,
+		Result:         req.Result,
+		Unit:           req.Unit,
+		ReferenceRange: req.ReferenceRange,
+		Abnormal:       req.Abnormal,
+		DoctorID:       userID,
+		CreatedAt:      time.Now(),
+	}
+	if err := database.DB.WithContext(c.Request.Context()).Create(&lab).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存检验结果失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"msg": "检验结果已保存", "data": lab})
+}
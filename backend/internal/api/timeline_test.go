@@ -0,0 +1,28 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSortTimelineEventsTieBreak(t *testing.T) {
+	at := time.Date(2025, 3, 1, 9, 0, 0, 0, time.Local)
+	events := []TimelineEvent{
+		{Type: EventPayment, Time: at},
+		{Type: EventOrder, Time: at},
+		{Type: EventBooking, Time: at.Add(time.Minute)},
+		{Type: EventDiagnosis, Time: at},
+		{Type: EventBooking, Time: at},
+	}
+	sortTimelineEvents(events)
+
+	want := []string{EventBooking, EventDiagnosis, EventOrder, EventPayment, EventBooking}
+	for i, e := range events {
+		if e.Type != want[i] {
+			t.Fatalf("第 %d 条事件类型 = %s, 期望 %s", i, e.Type, want[i])
+		}
+	}
+	if !events[4].Time.After(at) {
+		t.Fatalf("较晚的事件应排在最后")
+	}
+}
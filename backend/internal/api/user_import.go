@@ -0,0 +1,365 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hospital-system/internal/credential"
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"hospital-system/internal/xlsx"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 批量导入 / 导出账号 ---
+// 对应路由：POST /api/v1/dashboard/users/import (multipart, 字段 file，支持 .csv / .xlsx)
+//          GET  /api/v1/dashboard/users/export?format=csv|xlsx (过滤参数同用户列表)
+// 导入表头: username,role,department,org_id,password (password 留空则自动生成)
+// 任何一行有错误都整体不导入；dry_run=true 时只校验并返回逐行报告
+// 导入成功后返回与上传格式相同的结果文件，其中包含自动生成的初始密码 (只出现这一次)
+
+const (
+	maxImportSize = 5 << 20
+	maxImportRows = 1000
+)
+
+// ImportRowError 导入文件中某一行的错误
+type ImportRowError struct {
+	Row      int      `json:"row"` // 与 Excel 中看到的行号一致 (表头是第 1 行)
+	Username string   `json:"username"`
+	Errors   []string `json:"errors"`
+}
+
+// importRow 解析后的一行
+type importRow struct {
+	line       int
+	username   string
+	role       string
+	department string
+	dept       *model.Department
+	orgID      uint
+	orgIDRaw   string
+	password   string
+	generated  bool
+}
+
+// ImportUsers 批量导入账号
+func ImportUsers(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传导入文件"})
+		return
+	}
+	if fileHeader.Size > maxImportSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导入文件不能超过 5MB"})
+		return
+	}
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), ".")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只支持 csv 和 xlsx 文件"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法读取文件"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无法读取文件"})
+		return
+	}
+
+	// 1. 解析表格
+	var table [][]string
+	if format == "xlsx" {
+		table, err = xlsx.ReadRows(bytes.NewReader(data), int64(len(data)))
+	} else {
+		table, err = readCSV(data)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := parseImportRows(table)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 2. 逐行校验
+	report := validateImportRows(c, rows)
+	if c.Query("dry_run") == "true" {
+		c.JSON(http.StatusOK, gin.H{"valid": len(report) == 0, "total": len(rows), "errors": report})
+		return
+	}
+	if len(report) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("导入文件有 %d 行错误，未导入任何账号", len(report)), "errors": report})
+		return
+	}
+
+	// 3. 生成初始密码
+	for i := range rows {
+		if rows[i].password != "" {
+			continue
+		}
+		if rows[i].password, err = credential.GeneratePassword(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成初始密码失败"})
+			return
+		}
+		rows[i].generated = true
+	}
+
+	// 4. 整体写入，任何一行失败都回滚
+	err = database.DB.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		for _, r := range rows {
+			user := model.User{
+				Username:           r.username,
+				Password:           r.password, // BeforeCreate 会自动加密
+				Role:               r.role,
+				OrgID:              r.orgID,
+				MustChangePassword: true, // 初始密码经过他人之手，首次登录必须修改
+			}
+			assignDepartment(&user, r.dept)
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("第 %d 行 (%s) 写入失败", r.line, r.username)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 5. 返回结果文件
+	result := [][]string{{"username", "role", "department", "org_id", "initial_password"}}
+	for _, r := range rows {
+		password := ""
+		if r.generated {
+			password = r.password
+		}
+		department := ""
+		if r.dept != nil {
+			department = r.dept.Name
+		}
+		result = append(result, []string{r.username, r.role, department, strconv.FormatUint(uint64(r.orgID), 10), password})
+	}
+	c.Header("X-Imported-Count", strconv.Itoa(len(rows)))
+	writeTable(c, format, "user_import_result", result)
+}
+
+// ExportUsers 按列表过滤条件导出账号 (不含任何凭据)
+func ExportUsers(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format 只能是 csv 或 xlsx"})
+		return
+	}
+
+	var users []model.User
+	if err := userQuery(c).Omit("password").Order("id").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+		return
+	}
+
+	// 前几列与导入表头一致，导出的文件可以直接改后再导入
+	table := [][]string{{"username", "role", "department", "org_id", "id", "auth_source", "enabled", "totp_enabled", "created_at"}}
+	for _, u := range users {
+		table = append(table, []string{
+			u.Username,
+			u.Role,
+			u.Department,
+			strconv.FormatUint(uint64(u.OrgID), 10),
+			strconv.FormatUint(uint64(u.ID), 10),
+			u.AuthSource,
+			strconv.FormatBool(u.Enabled),
+			strconv.FormatBool(u.TOTPEnabled),
+			u.CreatedAt.Format("2006-01-02 15:04:05"),
+		})
+	}
+	writeTable(c, format, "users", table)
+}
+
+// readCSV 读取 CSV (兼容 Excel 另存时带的 BOM)
+func readCSV(data []byte) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	table, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("CSV 格式错误: %v", err)
+	}
+	return table, nil
+}
+
+// parseImportRows 按表头取列，跳过空行；只有表头缺列、文件过大这类整体问题才返回错误
+func parseImportRows(table [][]string) ([]importRow, error) {
+	if len(table) == 0 {
+		return nil, errors.New("文件为空")
+	}
+	cols := make(map[string]int)
+	for i, h := range table[0] {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, required := range []string{"username", "role"} {
+		if _, ok := cols[required]; !ok {
+			return nil, fmt.Errorf("缺少列: %s", required)
+		}
+	}
+
+	get := func(row []string, name string) string {
+		i, ok := cols[name]
+		if !ok || i >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[i])
+	}
+
+	var rows []importRow
+	for i, row := range table[1:] {
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+		r := importRow{
+			line:       i + 2,
+			username:   get(row, "username"),
+			role:       strings.ToLower(get(row, "role")),
+			department: get(row, "department"),
+			password:   get(row, "password"),
+			orgIDRaw:   get(row, "org_id"),
+		}
+		rows = append(rows, r)
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("文件中没有数据行")
+	}
+	if len(rows) > maxImportRows {
+		return nil, fmt.Errorf("单次最多导入 %d 个账号", maxImportRows)
+	}
+	return rows, nil
+}
+
+// validateImportRows 逐行校验，返回所有有错误的行；会补全每行的机构编号
+func validateImportRows(c *gin.Context, rows []importRow) []ImportRowError {
+	isGlobal := c.GetString("role") == "global_admin"
+	ownOrg := c.GetUint("org_id")
+	if ownOrg == 0 {
+		ownOrg = 1
+	}
+
+	// 已存在的用户名 (含已删除的，用户名唯一索引不区分)
+	names := make([]string, 0, len(rows))
+	for _, r := range rows {
+		names = append(names, r.username)
+	}
+	var existing []string
+	database.DB.Unscoped().Model(&model.User{}).Where("username IN ?", names).Pluck("username", &existing)
+	taken := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		taken[name] = true
+	}
+
+	report := []ImportRowError{}
+	seen := make(map[string]int)
+	for i := range rows {
+		r := &rows[i]
+		var errs []string
+
+		switch {
+		case r.username == "":
+			errs = append(errs, "用户名不能为空")
+		case len([]rune(r.username)) > 64:
+			errs = append(errs, "用户名不能超过 64 个字符")
+		case taken[r.username]:
+			errs = append(errs, "用户名已存在")
+		case seen[r.username] > 0:
+			errs = append(errs, fmt.Sprintf("用户名与第 %d 行重复", seen[r.username]))
+		}
+		if r.username != "" && seen[r.username] == 0 {
+			seen[r.username] = r.line
+		}
+
+		if _, ok := roleLevels[r.role]; !ok {
+			errs = append(errs, "角色无效: "+r.role)
+		} else if !canGrantRole(c, r.role) {
+			errs = append(errs, "无权授予该角色: "+r.role)
+		}
+
+		if r.orgIDRaw == "" {
+			r.orgID = ownOrg
+		} else if id, err := strconv.ParseUint(r.orgIDRaw, 10, 32); err != nil || id == 0 {
+			errs = append(errs, "机构编号无效: "+r.orgIDRaw)
+		} else if r.orgID = uint(id); !isGlobal && r.orgID != ownOrg {
+			errs = append(errs, "只能导入到本机构")
+		}
+
+		if r.orgID != 0 {
+			dept, err := resolveDepartment(database.DB, r.orgID, nil, r.department)
+			if err != nil {
+				errs = append(errs, "科室不存在或已停用: "+r.department)
+			}
+			r.dept = dept
+		}
+
+		if r.password != "" {
+			if err := credential.ValidatePassword(r.password); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+
+		if len(errs) > 0 {
+			report = append(report, ImportRowError{Row: r.line, Username: r.username, Errors: errs})
+		}
+	}
+	return report
+}
+
+// writeTable 以附件形式返回 csv / xlsx 表格
+func writeTable(c *gin.Context, format, name string, table [][]string) {
+	filename := fmt.Sprintf("%s_%s.%s", name, time.Now().Format("20060102_150405"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+
+	var buf bytes.Buffer
+	contentType := "text/csv; charset=utf-8"
+	if format == "xlsx" {
+		contentType = xlsx.ContentType
+		if err := xlsx.WriteRows(&buf, name, table); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成文件失败"})
+			return
+		}
+	} else {
+		// 带 BOM，Excel 直接打开不会乱码
+		buf.WriteString("\ufeff")
+		w := csv.NewWriter(&buf)
+		for _, row := range table {
+			w.Write(escapeCSVRow(row))
+		}
+		w.Flush()
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// escapeCSVRow 以 = + - @ 开头的单元格前加单引号，防止在 Excel 中被当成公式执行
+func escapeCSVRow(row []string) []string {
+	out := make([]string, len(row))
+	for i, v := range row {
+		if v != "" && strings.ContainsRune("=+-@", rune(v[0])) {
+			v = "'" + v
+		}
+		out[i] = v
+	}
+	return out
+}
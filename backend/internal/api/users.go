@@ -0,0 +1,159 @@
+package api
+
+import (
+	"hospital-system/internal/database"
+	"hospital-system/internal/model"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// --- 用户管理权限 ---
+// 管理员只能授予不高于自己级别的角色，机构管理员只能管理本机构的账号
+
+// roleLevels 角色级别，未列出的角色视为无效
+var roleLevels = map[string]int{
+	"global_admin": 100,
+	"org_admin":    50,
+	"finance":      10,
+	"doctor":       10,
+	"registration": 10,
+	"storekeeper":  10,
+	"general_user": 1,
+}
+
+// canGrantRole 当前操作者能否授予该角色
+func canGrantRole(c *gin.Context, role string) bool {
+	level, ok := roleLevels[role]
+	return ok && level <= roleLevels[c.GetString("role")]
+}
+
+// scopeUsers 机构管理员只能看到本机构的账号
+func scopeUsers(c *gin.Context, tx *gorm.DB) *gorm.DB {
+	if c.GetString("role") != "global_admin" {
+		tx = tx.Where("org_id = ?", c.GetUint("org_id"))
+	}
+	return tx
+}
+
+// manageableUser 读取 URL 中的用户，并检查当前操作者是否有权管理
+// 失败时直接写响应并返回 false；unscoped 为 true 时包括已删除的账号
+func manageableUser(c *gin.Context, unscoped bool) (model.User, bool) {
+	tx := scopeUsers(c, database.DB)
+	if unscoped {
+		tx = tx.Unscoped()
+	}
+
+	var user model.User
+	if err := tx.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return user, false
+	}
+	if !canGrantRole(c, user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能管理比自己级别高的账号"})
+		return user, false
+	}
+	return user, true
+}
+
+// userQuery 按列表参数过滤用户 (列表和导出共用)
+func userQuery(c *gin.Context) *gorm.DB {
+	tx := scopeUsers(c, database.DB.Model(&model.User{}))
+	if c.Query("deleted") == "true" {
+		tx = tx.Unscoped().Where("deleted_at IS NOT NULL")
+	}
+	if v := strings.TrimSpace(c.Query("keyword")); v != "" {
+		tx = tx.Where("username LIKE ?", "%"+v+"%")
+	}
+	if v := c.Query("role"); v != "" {
+		tx = tx.Where("role = ?", v)
+	}
+	if v := c.Query("department"); v != "" {
+		tx = tx.Where("department = ?", v)
+	}
+	if v := c.Query("org_id"); v != "" {
+		tx = tx.Where("org_id = ?", v)
+	}
+	if v := c.Query("enabled"); v != "" {
+		tx = tx.Where("enabled = ?", v == "true")
+	}
+	return tx
+}
+
+// ManageUserStatus 用户列表
+// 参数: keyword (用户名), role, department, org_id, enabled (true/false), deleted (true 只看已删除), page, page_size
+func ManageUserStatus(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	tx := userQuery(c)
+	var total int64
+	tx.Count(&total)
+
+	var users []model.User
+	if err := tx.Omit("password").Order("id").Offset((page - 1) * pageSize).Limit(pageSize).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户列表失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": users, "total": total, "page": page, "page_size": pageSize})
+}
+
+// SetUserEnabled 启用 / 停用账号 (停用后已登录的 Token 立即失效)
+// 对应路由: PUT /api/v1/dashboard/users/:id/enabled
+func SetUserEnabled(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "参数错误"})
+		return
+	}
+
+	user, ok := manageableUser(c, false)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能停用自己的账号"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Model(&user).Update("enabled", *req.Enabled).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	msg := "账号已停用"
+	if *req.Enabled {
+		msg = "账号已启用"
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": msg})
+}
+
+// RestoreUser 恢复已删除的账号
+// 对应路由: POST /api/v1/dashboard/users/:id/restore
+func RestoreUser(c *gin.Context) {
+	user, ok := manageableUser(c, true)
+	if !ok {
+		return
+	}
+	if !user.DeletedAt.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "账号未被删除"})
+		return
+	}
+
+	if err := database.DB.WithContext(c.Request.Context()).Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"msg": "账号已恢复"})
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func createStaff(t *testing.T, db *gorm.DB, username, role string, dept *model.Department) model.User {
+	t.Helper()
+	user := model.User{Username: username, Password: "Initial-pass1", Role: role, OrgID: 1, Enabled: true}
+	assignDepartment(&user, dept)
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+// 新密码不符合策略时，同一请求里的角色修改也不能保存
+func TestUpdateUserWeakPasswordRollsBack(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		admin := createStaff(t, db, "admin", "global_admin", nil)
+		target := createStaff(t, db, "staff", "storekeeper", nil)
+
+		w := caller{UserID: admin.ID, Role: admin.Role, OrgID: 1}.call(t, UpdateUser, http.MethodPut,
+			map[string]interface{}{"role": "finance", "password": "weak"}, "id", fmt.Sprint(target.ID))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("状态码 %d, 期望 400: %s", w.Code, w.Body.String())
+		}
+
+		var fresh model.User
+		db.First(&fresh, target.ID)
+		if fresh.Role != "storekeeper" || fresh.TokenVersion != target.TokenVersion || !fresh.CheckPassword("Initial-pass1") {
+			t.Fatalf("请求失败后账号被修改: 角色 %s, TokenVersion %d", fresh.Role, fresh.TokenVersion)
+		}
+
+		w = caller{UserID: admin.ID, Role: admin.Role, OrgID: 1}.call(t, UpdateUser, http.MethodPut,
+			map[string]interface{}{"role": "finance", "password": "Strong-pass2"}, "id", fmt.Sprint(target.ID))
+		if w.Code != http.StatusOK {
+			t.Fatalf("状态码 %d, 期望 200: %s", w.Code, w.Body.String())
+		}
+		db.First(&fresh, target.ID)
+		if fresh.Role != "finance" || !fresh.CheckPassword("Strong-pass2") || !fresh.MustChangePassword {
+			t.Fatalf("角色或密码没有保存: %+v", fresh)
+		}
+	})
+}
+
+// 请求中没有科室字段时保留原科室，明确传空字符串时清空
+func TestUpdateUserKeepsDepartmentWhenOmitted(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		dept := model.Department{OrgID: 1, Code: "D001", Name: "心内科", Active: true}
+		if err := db.Create(&dept).Error; err != nil {
+			t.Fatal(err)
+		}
+		admin := createStaff(t, db, "admin", "global_admin", nil)
+		doctor := createStaff(t, db, "doctor", "doctor", &dept)
+		as := caller{UserID: admin.ID, Role: admin.Role, OrgID: 1}
+		id := fmt.Sprint(doctor.ID)
+
+		steps := []struct {
+			body     map[string]interface{}
+			wantDept string
+		}{
+			{map[string]interface{}{"role": "doctor"}, "心内科"},
+			{map[string]interface{}{"password": "Strong-pass2"}, "心内科"},
+			{map[string]interface{}{"department": ""}, ""},
+			{map[string]interface{}{"department_id": dept.ID}, "心内科"},
+		}
+		for i, step := range steps {
+			if w := as.call(t, UpdateUser, http.MethodPut, step.body, "id", id); w.Code != http.StatusOK {
+				t.Fatalf("第 %d 步状态码 %d: %s", i, w.Code, w.Body.String())
+			}
+			var fresh model.User
+			db.First(&fresh, doctor.ID)
+			if fresh.Department != step.wantDept || (step.wantDept == "") != (fresh.DepartmentID == nil) {
+				t.Fatalf("第 %d 步 (%v) 后科室 %q (%v), 期望 %q", i, step.body, fresh.Department, fresh.DepartmentID, step.wantDept)
+			}
+		}
+	})
+}
+
+// 修改密码时猜错旧密码计入登录失败次数：达到上限后锁定，锁定期内正确的旧密码也不行，登录同样被拒
+func TestChangePasswordLockout(t *testing.T) {
+	useConfig(t, "auth.lockout.max_attempts=3")
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		useDB(t, db)
+		user := createStaff(t, db, "doc", "doctor", nil)
+
+		change := func(old string) int {
+			return as(user).call(t, ChangePassword, http.MethodPost,
+				map[string]string{"old_password": old, "new_password": "Strong-pass2"}).Code
+		}
+		for i := 0; i < 3; i++ {
+			if code := change("wrong-pass"); code != http.StatusBadRequest {
+				t.Fatalf("第 %d 次旧密码错误: 状态码 %d, 期望 400", i+1, code)
+			}
+		}
+		if code := change("Initial-pass1"); code != http.StatusForbidden {
+			t.Fatalf("锁定期内: 状态码 %d, 期望 403", code)
+		}
+
+		w := caller{}.call(t, LoginHandler, http.MethodPost, map[string]string{"username": "doc", "password": "Initial-pass1"})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("锁定期内登录: 状态码 %d, 期望 401", w.Code)
+		}
+		var fresh model.User
+		db.First(&fresh, user.ID)
+		if !fresh.CheckPassword("Initial-pass1") {
+			t.Fatal("锁定期内密码不应被修改")
+		}
+	})
+}
@@ -0,0 +1,413 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Actor 发起本次写操作的人 (由 HTTP 中间件放入 context)
+type Actor struct {
+	UserID uint
+	Role   string
+	OrgID  uint
+	IP     string
+	Action string // 例如 "PUT /api/v1/dashboard/users/:id"
+}
+
+type actorKey struct{}
+
+// WithActor 把操作人放进 context，handler 里用 DB.WithContext(ctx) 后回调即可读到
+func WithActor(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom 从 context 中取出操作人，没有时返回 nil (系统操作)
+func ActorFrom(ctx context.Context) *Actor {
+	if ctx == nil {
+		return nil
+	}
+	actor, _ := ctx.Value(actorKey{}).(*Actor)
+	return actor
+}
+
+// 不记录审计的表：审计表本身以及本身就是日志的表
+var skipTables = map[string]bool{
+	"audit_logs":         true,
+	"record_access_logs": true,
+}
+
+// 审计里需要打码的字段
+var redactedColumns = map[string]bool{
+	"password":      true,
+	"password_hash": true,
+	"token_hash":    true,
+	"totp_secret":   true,
+	"code_hash":     true,
+}
+
+const beforeKey = "audit:before"
+
+// 默认事务提交的回调；审计记录必须在它之前写入 (只写 After 时 GORM 会把回调排到提交之后，审计就不在业务事务里了)
+const commitCallback = "gorm:commit_or_rollback_transaction"
+
+// Register 注册 GORM 回调，所有 Create/Update/Delete 都会写入审计日志
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Before(commitCallback).Register("audit:after_create", afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("audit:before_update", beforeChange); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before(commitCallback).Register("audit:after_update", afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("audit:before_delete", beforeChange); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before(commitCallback).Register("audit:after_delete", afterDelete)
+}
+
+func skip(db *gorm.DB) bool {
+	stmt := db.Statement
+	return db.Error != nil || stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil || skipTables[stmt.Table]
+}
+
+// beforeChange 修改/删除前先把受影响的行查出来
+func beforeChange(db *gorm.DB) {
+	if skip(db) {
+		return
+	}
+	rows, err := snapshot(db, nil)
+	if err != nil {
+		logging.Errorf("审计: 读取修改前数据失败: %v", err)
+		return
+	}
+	db.Statement.Settings.Store(beforeKey, rows)
+}
+
+func afterCreate(db *gorm.DB) {
+	if skip(db) || db.RowsAffected == 0 {
+		return
+	}
+	ids := modelIDs(db)
+	if len(ids) == 0 {
+		return
+	}
+	rows, err := snapshot(db, ids)
+	if err != nil {
+		db.AddError(fmt.Errorf("审计: 读取新增数据失败: %w", err))
+		return
+	}
+	for _, row := range rows {
+		write(db, "create", nil, row)
+	}
+}
+
+func afterUpdate(db *gorm.DB) {
+	if skip(db) || db.RowsAffected == 0 {
+		return
+	}
+	before := loadBefore(db)
+	if len(before) == 0 {
+		return
+	}
+	after, err := snapshot(db, rowIDs(db, before))
+	if err != nil {
+		db.AddError(fmt.Errorf("审计: 读取修改后数据失败: %w", err))
+		return
+	}
+	afterByID := indexRows(db, after)
+	for _, row := range before {
+		newRow := afterByID[rowID(db, row)]
+		if encode(row) == encode(newRow) {
+			continue // 没有实际变化
+		}
+		write(db, "update", row, newRow)
+	}
+}
+
+func afterDelete(db *gorm.DB) {
+	if skip(db) || db.RowsAffected == 0 {
+		return
+	}
+	before := loadBefore(db)
+	if len(before) == 0 {
+		return
+	}
+	// 软删除的行仍然能查到 (deleted_at 有值)，硬删除则为空
+	after, err := snapshot(db, rowIDs(db, before))
+	if err != nil {
+		db.AddError(fmt.Errorf("审计: 读取删除后数据失败: %w", err))
+		return
+	}
+	afterByID := indexRows(db, after)
+	for _, row := range before {
+		write(db, "delete", row, afterByID[rowID(db, row)])
+	}
+}
+
+func loadBefore(db *gorm.DB) []map[string]interface{} {
+	v, ok := db.Statement.Settings.Load(beforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := v.([]map[string]interface{})
+	return rows
+}
+
+// snapshot 在同一个事务里按条件查出整行数据 (含软删除的行)
+// ids 为空时沿用当前语句的 WHERE 条件和模型主键
+func snapshot(db *gorm.DB, ids []interface{}) ([]map[string]interface{}, error) {
+	stmt := db.Statement
+	pk := stmt.Schema.PrioritizedPrimaryField
+	// 用同类型的空模型查询：Delete(&X{}, id) 生成的条件里主键列是占位符，需要模型才能解析
+	q := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Unscoped().
+		Model(reflect.New(stmt.Schema.ModelType).Interface()).Table(stmt.Table)
+
+	if ids != nil {
+		q = q.Where(clause.IN{Column: clause.Column{Name: pk.DBName}, Values: ids})
+	} else {
+		conditions := 0
+		if c, ok := stmt.Clauses["WHERE"]; ok {
+			if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+				q = q.Where(where)
+				conditions++
+			}
+		}
+		if modelIDs := modelIDs(db); len(modelIDs) > 0 {
+			q = q.Where(clause.IN{Column: clause.Column{Name: pk.DBName}, Values: modelIDs})
+			conditions++
+		}
+		if conditions == 0 {
+			// 没有条件的全表操作 GORM 本身会拒绝，这里不做快照
+			return nil, nil
+		}
+	}
+
+	return scanMaps(q)
+}
+
+// scanMaps 按原始列值读出每一行
+// 不用 Find(&[]map)：带模型查询时 GORM 会按字段类型扫描，serializer 字段 (JSON 列) 会扫描失败
+func scanMaps(q *gorm.DB) ([]map[string]interface{}, error) {
+	rs, err := q.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rs.Close()
+
+	cols, err := rs.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	for rs.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rs.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[col] = values[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows, rs.Err()
+}
+
+// modelIDs 取出语句模型上已有的主键值 (单个结构体或切片)
+func modelIDs(db *gorm.DB) []interface{} {
+	stmt := db.Statement
+	pk := stmt.Schema.PrioritizedPrimaryField
+	rv := reflect.Indirect(stmt.ReflectValue)
+
+	var ids []interface{}
+	collect := func(v reflect.Value) {
+		v = reflect.Indirect(v)
+		if v.Kind() != reflect.Struct {
+			return
+		}
+		if id, zero := pk.ValueOf(stmt.Context, v); !zero {
+			ids = append(ids, id)
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		collect(rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			collect(rv.Index(i))
+		}
+	}
+	return ids
+}
+
+func rowID(db *gorm.DB, row map[string]interface{}) string {
+	return fmt.Sprint(row[db.Statement.Schema.PrioritizedPrimaryField.DBName])
+}
+
+func rowIDs(db *gorm.DB, rows []map[string]interface{}) []interface{} {
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	ids := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row[pk])
+	}
+	return ids
+}
+
+func indexRows(db *gorm.DB, rows []map[string]interface{}) map[string]map[string]interface{} {
+	m := make(map[string]map[string]interface{}, len(rows))
+	for _, row := range rows {
+		m[rowID(db, row)] = row
+	}
+	return m
+}
+
+// encode 把一行数据转成 JSON (敏感字段打码)，nil 返回空字符串
+func encode(row map[string]interface{}) string {
+	if row == nil {
+		return ""
+	}
+	clean := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		if redactedColumns[k] {
+			v = "***"
+		}
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC().Format(time.RFC3339Nano)
+		}
+		clean[k] = v
+	}
+	b, _ := json.Marshal(clean) // map 的 key 会按字母序输出，结果稳定
+	return string(b)
+}
+
+// chainLockKey PostgreSQL 上串行追加哈希链用的事务级咨询锁
+const chainLockKey int64 = 0x6175646974 // "audit"
+
+// write 追加一条审计记录，与业务写操作处于同一事务中
+// 读取上一条 Hash 和写入必须与其他事务串行，否则两个事务会接在同一条记录后面 (链分叉或 hash 唯一索引冲突)：
+// SQLite 的业务写操作已经拿到了数据库写锁；PostgreSQL (READ COMMITTED) 需要先取咨询锁，事务结束时自动释放
+func write(db *gorm.DB, operation string, before, after map[string]interface{}) {
+	stmt := db.Statement
+	entry := model.AuditLog{
+		Operation:  operation,
+		EntityType: stmt.Table,
+		Before:     encode(before),
+		After:      encode(after),
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+	}
+	if after != nil {
+		entry.EntityID = rowID(db, after)
+	} else {
+		entry.EntityID = rowID(db, before)
+	}
+	if actor := ActorFrom(stmt.Context); actor != nil {
+		entry.ActorID = actor.UserID
+		entry.ActorRole = actor.Role
+		entry.OrgID = actor.OrgID
+		entry.IP = actor.IP
+		entry.Action = actor.Action
+	} else {
+		entry.Action = "system"
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	if tx.Dialector.Name() == "postgres" {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockKey).Error; err != nil {
+			db.AddError(fmt.Errorf("审计: 获取哈希链锁失败: %w", err))
+			return
+		}
+	}
+	var last model.AuditLog
+	if err := tx.Order("id desc").Limit(1).Find(&last).Error; err != nil {
+		db.AddError(fmt.Errorf("审计: 读取上一条记录失败: %w", err))
+		return
+	}
+	entry.PrevHash = last.Hash
+	entry.Hash = ComputeHash(entry)
+
+	if err := tx.Create(&entry).Error; err != nil {
+		db.AddError(fmt.Errorf("审计: 写入失败: %w", err))
+	}
+}
+
+// ComputeHash 计算一条记录的哈希 (包含上一条记录的哈希)
+func ComputeHash(e model.AuditLog) string {
+	fields := []string{
+		e.PrevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		fmt.Sprint(e.ActorID),
+		e.ActorRole,
+		fmt.Sprint(e.OrgID),
+		e.IP,
+		e.Action,
+		e.Operation,
+		e.EntityType,
+		e.EntityID,
+		e.Before,
+		e.After,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyResult 哈希链校验结果
+type VerifyResult struct {
+	Checked  int    `json:"checked"`   // 已校验条数
+	Valid    bool   `json:"valid"`     // 是否完整
+	BrokenID uint   `json:"broken_id"` // 第一条校验失败的记录
+	Reason   string `json:"reason"`
+}
+
+// Verify 从头到尾重新计算哈希链
+func Verify(db *gorm.DB) (VerifyResult, error) {
+	result := VerifyResult{Valid: true}
+	prevHash := ""
+
+	var batch []model.AuditLog
+	err := db.Model(&model.AuditLog{}).Order("id asc").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, e := range batch {
+			result.Checked++
+			switch {
+			case e.PrevHash != prevHash:
+				result.Valid, result.BrokenID, result.Reason = false, e.ID, "prev_hash 与上一条记录不符 (记录被删除或插入)"
+			case ComputeHash(e) != e.Hash:
+				result.Valid, result.BrokenID, result.Reason = false, e.ID, "内容与 hash 不符 (记录被修改)"
+			}
+			if !result.Valid {
+				return errStop
+			}
+			prevHash = e.Hash
+		}
+		return nil
+	}).Error
+	if errors.Is(err, errStop) {
+		err = nil
+	}
+	return result, err
+}
+
+// errStop 发现断链后中止批量遍历
+var errStop = errors.New("stop")
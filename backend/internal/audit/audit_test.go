@@ -0,0 +1,176 @@
+package audit_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"hospital-system/internal/audit"
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 并发写入时每条审计记录都接在上一条后面，链不分叉，业务写操作不因审计失败
+func TestChainConcurrentWrites(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		const workers, perWorker = 8, 5
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers*perWorker)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < perWorker; i++ {
+					m := model.InventoryItem{Name: fmt.Sprintf("药品-%d-%d", w, i), Category: "Medicine", Price: 1, Stock: 10}
+					if err := db.Create(&m).Error; err != nil {
+						errs <- err
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Errorf("写入失败: %v", err)
+		}
+
+		var count int64
+		db.Model(&model.AuditLog{}).Count(&count)
+		if count != workers*perWorker {
+			t.Fatalf("审计记录 %d 条, 期望 %d", count, workers*perWorker)
+		}
+		result, err := audit.Verify(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Valid || result.Checked != workers*perWorker {
+			t.Fatalf("哈希链校验失败: %+v", result)
+		}
+	})
+}
+
+// 审计记录与业务写操作在同一事务中：审计写入失败时业务写操作一起回滚
+func TestChainWrittenInsideTransaction(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		if err := db.Migrator().DropTable(&model.AuditLog{}); err != nil {
+			t.Fatal(err)
+		}
+		m := model.InventoryItem{Name: "阿莫西林", Category: "Medicine", Price: 12.5, Stock: 100}
+		if err := db.Create(&m).Error; err == nil {
+			t.Fatal("审计写入失败时 Create 应返回错误")
+		}
+		var count int64
+		db.Model(&model.InventoryItem{}).Count(&count)
+		if count != 0 {
+			t.Errorf("审计写入失败后业务数据应已回滚，实际有 %d 行", count)
+		}
+	})
+}
+
+// 操作人从 context 中取出记入审计
+func TestChainRecordsActor(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		ctx := audit.WithActor(context.Background(), &audit.Actor{UserID: 7, Role: "global_admin", IP: "10.0.0.1", Action: "POST /test"})
+		m := model.InventoryItem{Name: "阿莫西林", Category: "Medicine", Price: 12.5, Stock: 100}
+		if err := db.WithContext(ctx).Create(&m).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		var entry model.AuditLog
+		if err := db.Last(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+		if entry.ActorID != 7 || entry.Action != "POST /test" || entry.Operation != "create" ||
+			entry.EntityType != "inventory_items" || entry.EntityID != fmt.Sprint(m.ID) {
+			t.Fatalf("审计记录内容不符: %+v", entry)
+		}
+	})
+}
+
+// seedChain 新增、修改、删除几行物资，返回按顺序排列的审计记录
+func seedChain(t *testing.T, db *gorm.DB) []model.AuditLog {
+	t.Helper()
+	items := []model.InventoryItem{
+		{Name: "纱布", Category: "Consumable", Price: 2, Stock: 50},
+		{Name: "碘伏", Category: "Consumable", Price: 8, Stock: 20},
+		{Name: "布洛芬", Category: "Medicine", Price: 15, Stock: 30},
+	}
+	if err := db.Create(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&items[0]).Update("stock", 49).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(&items[1]).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []model.AuditLog
+	db.Order("id").Find(&entries)
+	if len(entries) != 5 {
+		t.Fatalf("审计记录 %d 条, 期望 5", len(entries))
+	}
+	result, err := audit.Verify(db)
+	if err != nil || !result.Valid || result.Checked != 5 {
+		t.Fatalf("未篡改时校验失败: %+v, %v", result, err)
+	}
+	return entries
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(db *gorm.DB, entries []model.AuditLog) error
+		broken func(entries []model.AuditLog) uint // 期望报告的记录
+	}{
+		{
+			name: "修改内容",
+			tamper: func(db *gorm.DB, e []model.AuditLog) error {
+				return db.Exec("UPDATE audit_logs SET after = ? WHERE id = ?", `{"stock":9999}`, e[3].ID).Error
+			},
+			broken: func(e []model.AuditLog) uint { return e[3].ID },
+		},
+		{
+			name: "修改内容并重算本条 hash",
+			tamper: func(db *gorm.DB, e []model.AuditLog) error {
+				forged := e[1]
+				forged.After = `{"name":"伪造"}`
+				return db.Exec("UPDATE audit_logs SET after = ?, hash = ? WHERE id = ?",
+					forged.After, audit.ComputeHash(forged), forged.ID).Error
+			},
+			broken: func(e []model.AuditLog) uint { return e[2].ID }, // 下一条的 prev_hash 对不上
+		},
+		{
+			name: "删除记录",
+			tamper: func(db *gorm.DB, e []model.AuditLog) error {
+				return db.Exec("DELETE FROM audit_logs WHERE id = ?", e[2].ID).Error
+			},
+			broken: func(e []model.AuditLog) uint { return e[3].ID },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+				entries := seedChain(t, db)
+				if err := tt.tamper(db, entries); err != nil {
+					t.Fatal(err)
+				}
+				result, err := audit.Verify(db)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Valid {
+					t.Fatalf("篡改后校验仍然通过: %+v", result)
+				}
+				if want := tt.broken(entries); result.BrokenID != want {
+					t.Fatalf("报告的记录 %d, 期望 %d (%s)", result.BrokenID, want, result.Reason)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"hospital-system/config"
+	"hospital-system/internal/logging"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// --- 数据库备份 ---
+// 只支持 SQLite。用 VACUUM INTO 生成快照：在一个读事务中复制整个库，得到某一时刻的一致副本，
+// WAL 模式下服务运行中也可以执行，不阻塞读写 (驱动没有提供 sqlite3_backup_* 接口，VACUUM INTO 是等价的在线方式)
+// 流程: 快照到临时文件 -> integrity_check -> (配置了密钥时) 加密 -> 改名为正式文件 -> 按保留份数删除旧备份
+// PostgreSQL 请使用 pg_dump 或数据库自身的备份方案
+
+// 备份来源
+const (
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+	TriggerCommand  = "command"
+)
+
+const (
+	filePrefix = "hospital-"
+	timeLayout = "20060102-150405"
+	statusFile = "last_backup.json"
+
+	// 定时备份检查间隔；失败后最迟一小时重试
+	scheduleCheck = time.Minute
+	retryInterval = time.Hour
+)
+
+var (
+	ErrUnsupported = errors.New("只有 SQLite 支持内置备份，PostgreSQL 请使用 pg_dump")
+	ErrRunning     = errors.New("已有备份正在进行")
+)
+
+// Result 一次备份的结果
+type Result struct {
+	Time       time.Time `json:"time"`
+	Trigger    string    `json:"trigger"`
+	Success    bool      `json:"success"`
+	File       string    `json:"file,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	SHA256     string    `json:"sha256,omitempty"`
+	Encrypted  bool      `json:"encrypted"`
+	DurationMS int64     `json:"duration_ms"`
+	Removed    []string  `json:"removed,omitempty"` // 按保留份数删除的旧备份
+	Error      string    `json:"error,omitempty"`
+}
+
+// File 备份目录中的一个备份文件
+type File struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Time      time.Time `json:"time"`
+	Encrypted bool      `json:"encrypted"`
+}
+
+var (
+	runMu sync.Mutex
+
+	statusMu   sync.Mutex
+	lastResult *Result
+)
+
+// Run 立即备份到 backup.dir，并按 backup.keep 删除旧备份
+func Run(ctx context.Context, db *gorm.DB, trigger string) (Result, error) {
+	if !runMu.TryLock() {
+		return Result{}, ErrRunning
+	}
+	defer runMu.Unlock()
+
+	cfg := config.Get().Backup
+	start := time.Now()
+	result := Result{Time: start, Trigger: trigger, Encrypted: cfg.EncryptionKey != ""}
+	name := filePrefix + start.Format(timeLayout) + ".db"
+	if result.Encrypted {
+		name += ".enc"
+	}
+
+	err := func() error {
+		if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+			return err
+		}
+		size, sum, err := Export(ctx, db, filepath.Join(cfg.Dir, name), cfg.EncryptionKey)
+		if err != nil {
+			return err
+		}
+		result.File, result.Size, result.SHA256 = name, size, sum
+
+		// 轮换失败不影响本次备份
+		removed, err := rotate(cfg.Dir, cfg.Keep)
+		if err != nil {
+			logging.Warnf("删除旧备份失败: %v", err)
+		}
+		result.Removed = removed
+		return nil
+	}()
+	result.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		logging.Errorf("数据库备份 (%s) 失败: %v", trigger, err)
+	} else {
+		result.Success = true
+		log.Printf("数据库备份 (%s) 完成: %s (%d 字节，%d ms)", trigger, name, result.Size, result.DurationMS)
+	}
+	saveStatus(cfg.Dir, result)
+	return result, err
+}
+
+// Export 把数据库当前时刻的一致快照写到 target (文件不能已存在)，passphrase 非空时加密
+// 返回写出的文件大小和 SHA-256
+func Export(ctx context.Context, db *gorm.DB, target, passphrase string) (int64, string, error) {
+	if db.Dialector.Name() != "sqlite" {
+		return 0, "", ErrUnsupported
+	}
+	if _, err := os.Stat(target); err == nil {
+		return 0, "", fmt.Errorf("%s 已存在", target)
+	}
+
+	// 1. 一致性快照
+	tmp := target + ".tmp"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+	if err := db.WithContext(ctx).Exec("VACUUM INTO ?", tmp).Error; err != nil {
+		return 0, "", fmt.Errorf("生成快照失败: %w", err)
+	}
+	if err := os.Chmod(tmp, 0600); err != nil {
+		return 0, "", err
+	}
+
+	// 2. 校验快照
+	if err := checkIntegrity(tmp); err != nil {
+		return 0, "", err
+	}
+
+	// 3. 加密或直接改名为正式文件
+	if passphrase == "" {
+		if err := os.Rename(tmp, target); err != nil {
+			return 0, "", err
+		}
+	} else if err := encryptFile(tmp, target, passphrase); err != nil {
+		return 0, "", err
+	}
+	return fileSum(target)
+}
+
+// checkIntegrity 对 SQLite 文件执行 integrity_check
+func checkIntegrity(path string) error {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logging.SQL()})
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	var problems []string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&problems).Error; err != nil {
+		return fmt.Errorf("完整性检查失败: %w", err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		return fmt.Errorf("完整性检查未通过: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// encryptFile 加密 src 写到 dst (先写临时文件，完成后改名)
+func encryptFile(src, dst, passphrase string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	part := dst + ".part"
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(part)
+	if err := encrypt(out, in, passphrase); err != nil {
+		out.Close()
+		return fmt.Errorf("加密备份失败: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, dst)
+}
+
+// fileSum 文件大小和 SHA-256
+func fileSum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// List 备份目录中的备份文件，新的在前
+func List(dir string) ([]File, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []File{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := []File{}
+	for _, e := range entries {
+		name := e.Name()
+		stamp, encrypted, ok := parseName(name)
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: name, Size: info.Size(), Time: stamp, Encrypted: encrypted})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Time.After(files[j].Time) })
+	return files, nil
+}
+
+// parseName 解析 hospital-20260101-020000.db[.enc]
+func parseName(name string) (stamp time.Time, encrypted bool, ok bool) {
+	rest, found := strings.CutPrefix(name, filePrefix)
+	if !found {
+		return time.Time{}, false, false
+	}
+	if s, found := strings.CutSuffix(rest, ".db.enc"); found {
+		rest, encrypted = s, true
+	} else if s, found := strings.CutSuffix(rest, ".db"); found {
+		rest = s
+	} else {
+		return time.Time{}, false, false
+	}
+	stamp, err := time.ParseInLocation(timeLayout, rest, time.Local)
+	return stamp, encrypted, err == nil
+}
+
+// rotate 只保留最近 keep 份备份
+func rotate(dir string, keep int) ([]string, error) {
+	if keep < 1 {
+		keep = 1
+	}
+	files, err := List(dir)
+	if err != nil || len(files) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, f := range files[keep:] {
+		if err := os.Remove(filepath.Join(dir, f.Name)); err != nil {
+			return removed, err
+		}
+		removed = append(removed, f.Name)
+	}
+	return removed, nil
+}
+
+// Status 最近一次备份的结果，还没有备份过时返回 nil
+// 以备份目录中的记录为准 (重启后、或命令行执行过备份时也能看到)，读取失败时用本进程记住的结果
+func Status() *Result {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	if data, err := os.ReadFile(filepath.Join(config.Get().Backup.Dir, statusFile)); err == nil {
+		var r Result
+		if json.Unmarshal(data, &r) == nil {
+			return &r
+		}
+	}
+	if lastResult == nil {
+		return nil
+	}
+	r := *lastResult
+	return &r
+}
+
+// saveStatus 记录最近一次备份的结果
+func saveStatus(dir string, r Result) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	lastResult = &r
+	data, _ := json.MarshalIndent(r, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, statusFile), data, 0600); err != nil {
+		logging.Warnf("保存备份状态失败: %v", err)
+	}
+}
+
+// Schedule 按 backup.interval_hours 定时备份，直到 ctx 结束 (间隔可热加载，0 表示关闭)
+func Schedule(ctx context.Context, db *gorm.DB) {
+	if db.Dialector.Name() != "sqlite" {
+		log.Println("当前数据库不是 SQLite，不启用内置定时备份")
+		return
+	}
+	ticker := time.NewTicker(scheduleCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		hours := config.Get().Backup.IntervalHours
+		if hours <= 0 {
+			continue
+		}
+		wait := time.Duration(hours) * time.Hour
+		if last := Status(); last != nil {
+			if !last.Success && wait > retryInterval {
+				wait = retryInterval
+			}
+			if time.Since(last.Time) < wait {
+				continue
+			}
+		}
+		Run(ctx, db, TriggerSchedule)
+	}
+}
@@ -0,0 +1,163 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// --- 备份文件加密 ---
+// 文件格式: magic(8) | salt(16) | nonce 前缀(4) | 分块...
+// 每块: 密文长度(4 字节大端) | AES-256-GCM 密文，nonce = 前缀 + 块序号，附加数据标记是否为最后一块，
+// 这样块被调换顺序、删除或文件被截断都能发现
+// 密钥由配置中的口令经 PBKDF2-SHA256 派生，每个文件使用独立的 salt
+
+const (
+	cryptMagic      = "HOSPBAK1"
+	cryptChunkSize  = 1 << 20
+	pbkdf2Iteration = 200_000
+	saltSize        = 16
+	noncePrefixSize = 4
+)
+
+var (
+	ErrWrongKey  = errors.New("备份密钥错误或文件已损坏")
+	ErrTruncated = errors.New("备份文件不完整")
+)
+
+// isEncrypted 文件头是否为加密备份
+func isEncrypted(r io.ReaderAt) bool {
+	head := make([]byte, len(cryptMagic))
+	if _, err := r.ReadAt(head, 0); err != nil {
+		return false
+	}
+	return string(head) == cryptMagic
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iteration, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, seq uint64) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	return binary.BigEndian.AppendUint64(nonce, seq)
+}
+
+// encrypt 加密 src 写入 dst
+func encrypt(dst io.Writer, src io.Reader, passphrase string) error {
+	// 1. 文件头
+	header := make([]byte, saltSize+noncePrefixSize)
+	if _, err := rand.Read(header); err != nil {
+		return err
+	}
+	salt, prefix := header[:saltSize], header[saltSize:]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(dst, cryptMagic); err != nil {
+		return err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	// 2. 逐块加密，预读一个字节判断当前块是不是最后一块 (空文件也写出一个空的最后一块)
+	br := bufio.NewReaderSize(src, cryptChunkSize)
+	buf := make([]byte, cryptChunkSize)
+	for seq := uint64(0); ; seq++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		last := n < cryptChunkSize
+		if !last {
+			if _, peekErr := br.Peek(1); peekErr == io.EOF {
+				last = true
+			}
+		}
+		sealed := gcm.Seal(nil, chunkNonce(prefix, seq), buf[:n], lastFlag(last))
+		if err := binary.Write(dst, binary.BigEndian, uint32(len(sealed))); err != nil {
+			return err
+		}
+		if _, err := dst.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decrypt 解密 src 写入 dst
+func decrypt(dst io.Writer, src io.Reader, passphrase string) error {
+	// 1. 文件头
+	header := make([]byte, len(cryptMagic)+saltSize+noncePrefixSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return ErrTruncated
+	}
+	if !bytes.HasPrefix(header, []byte(cryptMagic)) {
+		return fmt.Errorf("不是加密的备份文件")
+	}
+	header = header[len(cryptMagic):]
+	salt, prefix := header[:saltSize], header[saltSize:]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	// 2. 逐块解密，必须以标记为最后一块的块结束
+	maxSealed := uint32(cryptChunkSize + gcm.Overhead())
+	for seq := uint64(0); ; seq++ {
+		var size uint32
+		if err := binary.Read(src, binary.BigEndian, &size); err != nil {
+			return ErrTruncated
+		}
+		if size > maxSealed {
+			return ErrWrongKey
+		}
+		sealed := make([]byte, size)
+		if _, err := io.ReadFull(src, sealed); err != nil {
+			return ErrTruncated
+		}
+		nonce := chunkNonce(prefix, seq)
+		plain, err := gcm.Open(nil, nonce, sealed, lastFlag(false))
+		last := false
+		if err != nil {
+			if plain, err = gcm.Open(nil, nonce, sealed, lastFlag(true)); err != nil {
+				return ErrWrongKey
+			}
+			last = true
+		}
+		if _, err := dst.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+func lastFlag(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
@@ -0,0 +1,153 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"hospital-system/internal/database"
+	"hospital-system/internal/logging"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// --- 从备份恢复 ---
+// 必须先停止服务：运行中的服务一直打开着数据库，换掉文件后它仍在写旧文件 (已改名的那份)，恢复的数据会被覆盖或丢失
+// 所以数据库还有 -wal / -shm 文件 (服务在运行，或上次没有正常退出) 或被其他连接锁住时拒绝恢复
+// 恢复前原数据库改名保留，不会被删除
+
+// ErrInUse 数据库正在被使用
+var ErrInUse = errors.New("数据库正在使用中，请先停止服务再恢复")
+
+// Restore 用备份文件 src 替换 dbPath，加密备份需要 passphrase；返回原数据库被改名后的路径 (原来没有数据库时为空)
+func Restore(src, dbPath, passphrase string) (string, error) {
+	// 0. 确认没有程序在使用数据库
+	if err := checkNotInUse(dbPath); err != nil {
+		return "", err
+	}
+
+	// 1. 解密或复制到数据库旁边的临时文件 (同一目录下改名是原子的)
+	tmp := dbPath + ".restore"
+	os.Remove(tmp)
+	defer os.Remove(tmp)
+	if err := extract(src, tmp, passphrase); err != nil {
+		return "", err
+	}
+
+	// 2. 完整性检查，并确认备份的表结构版本本程序能够使用
+	if err := checkIntegrity(tmp); err != nil {
+		return "", err
+	}
+	if err := checkVersion(tmp); err != nil {
+		return "", err
+	}
+
+	// 3. 原数据库改名保留 (解密期间服务可能被启动，再检查一次)
+	if err := checkNotInUse(dbPath); err != nil {
+		return "", err
+	}
+	var previous string
+	if _, err := os.Stat(dbPath); err == nil {
+		previous = fmt.Sprintf("%s.before-restore-%s", dbPath, time.Now().Format(timeLayout))
+		if err := os.Rename(dbPath, previous); err != nil {
+			return "", err
+		}
+	}
+
+	// 4. 换上备份
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return previous, err
+	}
+	log.Printf("已从 %s 恢复数据库 %s", src, dbPath)
+	return previous, nil
+}
+
+// extract 把备份文件 (加密或未加密) 还原为 SQLite 文件 dst
+func extract(src, dst, passphrase string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if !isEncrypted(in) {
+		_, err = io.Copy(out, in)
+		return err
+	}
+	if passphrase == "" {
+		return errors.New("备份文件已加密，请配置 backup.encryption_key")
+	}
+	if err := decrypt(out, in, passphrase); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// checkNotInUse 数据库不存在，或者存在且没有 -wal / -shm 文件、能拿到排他锁
+func checkNotInUse(dbPath string) error {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + suffix); err == nil {
+			return fmt.Errorf("%w (存在 %s；如果服务已经停止，说明上次没有正常退出，请启动后再正常停止一次)", ErrInUse, dbPath+suffix)
+		}
+	}
+
+	// 其他程序 (例如 sqlite3 命令行) 正在使用数据库时拿不到排他锁；不等待 (驱动默认等 5 秒)，立即返回 SQLITE_BUSY
+	db, err := openSQLite(dbPath, "rw")
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("PRAGMA busy_timeout = 0").Error; err != nil {
+			return err
+		}
+		if err := conn.Exec("BEGIN EXCLUSIVE").Error; err != nil {
+			return fmt.Errorf("%w: %v", ErrInUse, err)
+		}
+		return conn.Exec("ROLLBACK").Error
+	})
+}
+
+// checkVersion 备份中的迁移版本不能比程序新
+// 只读打开：database.Open 会把备份切换为 WAL 模式并在旁边生成 -wal / -shm 文件
+func checkVersion(path string) error {
+	db, err := openSQLite(path, "ro")
+	if err != nil {
+		return err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	current, latest, err := database.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: 备份已迁移到版本 %d，本程序只支持到 %d，请使用更新的程序恢复", database.ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// openSQLite 按 mode (ro 只读 / rw 读写) 打开已有的 SQLite 文件，不设置任何 PRAGMA
+func openSQLite(path, mode string) (*gorm.DB, error) {
+	return gorm.Open(sqlite.Open("file:"+path+"?mode="+mode), &gorm.Config{Logger: logging.SQL()})
+}
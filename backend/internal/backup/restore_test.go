@@ -0,0 +1,137 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hospital-system/internal/database"
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// exportBackup 在一个新库中写入一个药品后导出为未加密备份，返回备份文件路径
+func exportBackup(t *testing.T, prepare func(db *gorm.DB)) string {
+	t.Helper()
+	db := dbtest.Open(t, database.DriverSQLite)
+	if err := db.Create(&model.InventoryItem{Name: "阿莫西林", Category: "药品", Price: 12.5, Stock: 10}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if prepare != nil {
+		prepare(db)
+	}
+	target := filepath.Join(t.TempDir(), "backup.db")
+	if _, _, err := Export(context.Background(), db, target, ""); err != nil {
+		t.Fatalf("导出备份失败: %v", err)
+	}
+	return target
+}
+
+// stoppedDB 一个已经关闭 (服务已停止) 的数据库文件
+func stoppedDB(t *testing.T) string {
+	t.Helper()
+	db := dbtest.OpenEmpty(t, database.DriverSQLite)
+	var path string
+	if err := db.Raw("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&path).Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	return path
+}
+
+func TestRestore(t *testing.T) {
+	src := exportBackup(t, nil)
+	dbPath := stoppedDB(t)
+
+	previous, err := Restore(src, dbPath, "")
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if _, err := os.Stat(previous); err != nil {
+		t.Errorf("原数据库应改名保留为 %s: %v", previous, err)
+	}
+	if _, err := os.Stat(dbPath + ".restore"); !errors.Is(err, os.ErrNotExist) {
+		t.Error("临时文件应已删除")
+	}
+
+	db, err := openSQLite(dbPath, "ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	defer sqlDB.Close()
+	var count int64
+	db.Model(&model.InventoryItem{}).Count(&count)
+	if count != 1 {
+		t.Errorf("恢复后药品数量 = %d，应为 1", count)
+	}
+}
+
+// 服务运行中 (数据库以 WAL 模式打开着)：拒绝恢复，原数据库不动
+func TestRestoreRefusesOpenDatabase(t *testing.T) {
+	src := exportBackup(t, nil)
+	running := dbtest.Open(t, database.DriverSQLite)
+	var dbPath string
+	running.Raw("SELECT file FROM pragma_database_list WHERE name = 'main'").Scan(&dbPath)
+
+	if _, err := Restore(src, dbPath, ""); !errors.Is(err, ErrInUse) {
+		t.Fatalf("err = %v，应为 ErrInUse", err)
+	}
+	if err := running.Create(&model.InventoryItem{Name: "布洛芬", Category: "药品", Price: 8, Stock: 5}).Error; err != nil {
+		t.Errorf("拒绝恢复后原数据库应仍可使用: %v", err)
+	}
+}
+
+// 其他程序持有锁 (非 WAL 模式，没有 -wal / -shm 文件)：拒绝恢复
+func TestRestoreRefusesLockedDatabase(t *testing.T) {
+	src := exportBackup(t, nil)
+	dbPath := filepath.Join(t.TempDir(), "locked.db")
+	other, err := openSQLite(dbPath, "rwc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := other.DB()
+	defer sqlDB.Close()
+	sqlDB.SetMaxOpenConns(1)
+	if err := other.Exec("CREATE TABLE t (id INTEGER)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Exec("BEGIN EXCLUSIVE").Error; err != nil {
+		t.Fatal(err)
+	}
+	defer other.Exec("ROLLBACK")
+
+	start := time.Now()
+	if _, err := Restore(src, dbPath, ""); !errors.Is(err, ErrInUse) {
+		t.Fatalf("err = %v，应为 ErrInUse", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("拿不到锁时应立即返回，不应等待")
+	}
+}
+
+// 备份比程序新：拒绝恢复；只读检查不应在临时文件旁留下 -wal / -shm
+func TestRestoreRejectsNewerBackup(t *testing.T) {
+	src := exportBackup(t, func(db *gorm.DB) {
+		db.Create(&database.SchemaMigration{Version: 9999, Name: "future", AppliedAt: time.Now()})
+	})
+	dbPath := stoppedDB(t)
+
+	if _, err := Restore(src, dbPath, ""); !errors.Is(err, database.ErrSchemaTooNew) {
+		t.Fatalf("err = %v，应为 ErrSchemaTooNew", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if _, err := os.Stat(dbPath + ".restore" + suffix); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("不应生成 %s", dbPath+".restore"+suffix)
+		}
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		t.Errorf("原数据库应保持不动: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package credential
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/model"
+	"math/big"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 未配置时使用的默认值
+const (
+	defaultMinLength       = 8
+	defaultHistorySize     = 5
+	defaultMaxAttempts     = 5
+	defaultCooldownMinutes = 15
+)
+
+// PolicyError 密码不符合策略，错误信息可以直接返回给用户
+type PolicyError string
+
+func (e PolicyError) Error() string { return string(e) }
+
+// ErrPasswordReused 新密码与最近使用过的密码相同
+const ErrPasswordReused = PolicyError("不能使用最近用过的密码")
+
+// dummyHash 用户不存在时也做一次 bcrypt 比对，避免通过响应时间判断用户名是否存在
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+// ValidatePassword 按配置的复杂度策略检查密码
+func ValidatePassword(password string) error {
+	policy := config.Get().Auth.Password
+
+	minLength := policy.MinLength
+	if minLength <= 0 {
+		minLength = defaultMinLength
+	}
+	if len([]rune(password)) < minLength {
+		return PolicyError(fmt.Sprintf("密码长度不能少于 %d 位", minLength))
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	switch {
+	case policy.RequireUpper && !hasUpper:
+		return PolicyError("密码必须包含大写字母")
+	case policy.RequireLower && !hasLower:
+		return PolicyError("密码必须包含小写字母")
+	case policy.RequireDigit && !hasDigit:
+		return PolicyError("密码必须包含数字")
+	case policy.RequireSymbol && !hasSymbol:
+		return PolicyError("密码必须包含特殊符号")
+	}
+	return nil
+}
+
+// 生成初始密码用的字符集 (去掉了容易看错的 0/O、1/l/I)
+const (
+	genUpper  = "ABCDEFGHJKLMNPQRSTUVWXYZ"
+	genLower  = "abcdefghijkmnopqrstuvwxyz"
+	genDigit  = "23456789"
+	genSymbol = "!#$%&*?" // 不含 = + - @，导出到 CSV 时不会被当成公式转义
+)
+
+// GeneratePassword 生成满足任何复杂度策略的随机初始密码
+func GeneratePassword() (string, error) {
+	length := config.Get().Auth.Password.MinLength
+	if length < 12 {
+		length = 12
+	}
+	all := genUpper + genLower + genDigit + genSymbol
+	sets := []string{genUpper, genLower, genDigit, genSymbol}
+	for len(sets) < length {
+		sets = append(sets, all)
+	}
+
+	out := make([]byte, len(sets))
+	for i, set := range sets {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+		if err != nil {
+			return "", err
+		}
+		out[i] = set[n.Int64()]
+	}
+
+	// 打乱顺序，避免前四位总是 大写/小写/数字/符号
+	for i := len(out) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out), nil
+}
+
+// CheckReuse 检查新密码是否与当前密码或最近 N 次密码相同
+func CheckReuse(db *gorm.DB, user *model.User, password string) error {
+	// 老账号可能没有历史记录，当前密码单独比对
+	if user.CheckPassword(password) {
+		return ErrPasswordReused
+	}
+
+	n := config.Get().Auth.Password.HistorySize
+	if n <= 0 {
+		n = defaultHistorySize
+	}
+
+	var history []model.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).Order("id desc").Limit(n).Find(&history).Error; err != nil {
+		return err
+	}
+	for _, h := range history {
+		if bcrypt.CompareHashAndPassword([]byte(h.PasswordHash), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// SetPassword 校验策略与历史后设置新密码
+// 同时递增 TokenVersion 使该用户所有旧 Token 失效；mustChange 表示下次登录必须再改一次 (管理员代设密码时)
+func SetPassword(db *gorm.DB, user *model.User, password string, mustChange bool) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	if err := CheckReuse(db, user, password); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 明文交给 User.BeforeSave 统一加密
+		user.Password = password
+		user.MustChangePassword = mustChange
+		user.PasswordChangedAt = &now
+		user.TokenVersion++
+		err := tx.Model(user).
+			Select("password", "must_change_password", "password_changed_at", "token_version").
+			Updates(user).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.PasswordHistory{UserID: user.ID, PasswordHash: user.Password}).Error
+	})
+}
+
+// --- 一次性重置凭证 ---
+
+// 重置凭证有效期
+const resetTokenTTL = 24 * time.Hour
+
+// ErrInvalidResetToken 凭证不存在、已使用或已过期
+var ErrInvalidResetToken = errors.New("重置凭证无效或已过期")
+
+// IssueResetToken 为用户生成一次性重置凭证，旧的未使用凭证同时作废
+// 返回的明文只会出现这一次，数据库里只保存哈希
+func IssueResetToken(db *gorm.DB, userID, createdBy uint) (string, time.Time, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	expires := time.Now().Add(resetTokenTTL)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&model.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", &now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.PasswordResetToken{
+			UserID:    userID,
+			TokenHash: hashToken(token),
+			CreatedBy: createdBy,
+			ExpiresAt: expires,
+		}).Error
+	})
+	return token, expires, err
+}
+
+// ConsumeResetToken 使用重置凭证设置新密码，成功后凭证作废并解除锁定
+func ConsumeResetToken(db *gorm.DB, token, password string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var rt model.PasswordResetToken
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(token), time.Now()).
+			First(&rt).Error
+		if err != nil {
+			return ErrInvalidResetToken
+		}
+
+		var user model.User
+		if err := tx.First(&user, rt.UserID).Error; err != nil {
+			return ErrInvalidResetToken
+		}
+		if err := SetPassword(tx, &user, password, false); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&rt).Update("used_at", &now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil}).Error
+	})
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsLocked 账号是否处于锁定期
+func IsLocked(user *model.User) bool {
+	return user.LockedUntil != nil && user.LockedUntil.After(time.Now())
+}
+
+// ErrLocked 验证通过时账号已被同时进行的失败尝试锁定
+var ErrLocked = errors.New("账号已锁定")
+
+// RecordFailure 记录一次登录失败，达到上限后锁定账号
+// 计数在一条 UPDATE 中按数据库里的当前值递增，并发的失败请求不会互相覆盖
+func RecordFailure(db *gorm.DB, user *model.User) error {
+	lockout := config.Get().Auth.Lockout
+	maxAttempts := lockout.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	cooldown := lockout.CooldownMinutes
+	if cooldown <= 0 {
+		cooldown = defaultCooldownMinutes
+	}
+
+	// 达到上限时锁定并重新计数
+	until := time.Now().Add(time.Duration(cooldown) * time.Minute)
+	return db.Model(user).Updates(map[string]interface{}{
+		"failed_attempts": gorm.Expr("CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END", maxAttempts),
+		"locked_until":    gorm.Expr("CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_until END", maxAttempts, until),
+	}).Error
+}
+
+// RecordSuccess 登录成功后清空失败计数
+// 验证期间账号被并发的失败请求锁定时返回 ErrLocked，调用方应按登录失败处理
+func RecordSuccess(db *gorm.DB, user *model.User) error {
+	now := time.Now()
+	var locked int64
+	if err := db.Model(&model.User{}).Where("id = ? AND locked_until > ?", user.ID, now).Count(&locked).Error; err != nil {
+		return err
+	}
+	if locked > 0 {
+		return ErrLocked
+	}
+	if user.FailedAttempts == 0 && user.LockedUntil == nil {
+		return nil
+	}
+	return db.Model(user).Where("locked_until IS NULL OR locked_until <= ?", now).
+		Updates(map[string]interface{}{"failed_attempts": 0, "locked_until": nil}).Error
+}
+
+// DummyCompare 用户不存在时调用，消除时间差
+func DummyCompare(password string) {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
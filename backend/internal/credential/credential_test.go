@@ -0,0 +1,183 @@
+package credential
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"hospital-system/config"
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// useConfig 以默认配置加上 overrides (例如 "auth.lockout.max_attempts=3") 作为当前配置
+func useConfig(t *testing.T, overrides ...string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadConfig(path, overrides...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createUser(t *testing.T, db *gorm.DB, username, password string) *model.User {
+	t.Helper()
+	user := &model.User{Username: username, Password: password, Role: "registration", Enabled: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+func reload(t *testing.T, db *gorm.DB, user *model.User) *model.User {
+	t.Helper()
+	var fresh model.User
+	if err := db.First(&fresh, user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &fresh
+}
+
+func TestValidatePassword(t *testing.T) {
+	useConfig(t,
+		"auth.password.min_length=10",
+		"auth.password.require_upper=true",
+		"auth.password.require_lower=true",
+		"auth.password.require_digit=true",
+		"auth.password.require_symbol=true",
+	)
+	tests := []struct {
+		password string
+		ok       bool
+	}{
+		{"Abcdef12#$", true},
+		{"Ab1#", false},        // 太短
+		{"abcdefgh12#", false}, // 缺大写
+		{"ABCDEFGH12#", false}, // 缺小写
+		{"Abcdefghij#", false}, // 缺数字
+		{"Abcdefgh123", false}, // 缺符号
+		{"密码Abcdef12#", true},  // 按字符计算长度
+	}
+	for _, tt := range tests {
+		err := ValidatePassword(tt.password)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidatePassword(%q) = %v, 期望通过: %v", tt.password, err, tt.ok)
+		}
+		var pe PolicyError
+		if err != nil && !errors.As(err, &pe) {
+			t.Errorf("ValidatePassword(%q) 应返回 PolicyError, 实际 %T", tt.password, err)
+		}
+	}
+}
+
+func TestSetPasswordHistory(t *testing.T) {
+	useConfig(t, "auth.password.history_size=2")
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		user := createUser(t, db, "alice", "Initial-pass1")
+		version := user.TokenVersion
+
+		if err := SetPassword(db, user, "Initial-pass1", false); !errors.Is(err, ErrPasswordReused) {
+			t.Fatalf("设置为当前密码: %v, 期望 ErrPasswordReused", err)
+		}
+		if err := SetPassword(db, user, "short", false); err == nil {
+			t.Fatal("不符合策略的密码不应设置成功")
+		}
+		for _, p := range []string{"Second-pass2", "Third-pass3", "Fourth-pass4"} {
+			if err := SetPassword(db, user, p, false); err != nil {
+				t.Fatalf("设置密码 %s 失败: %v", p, err)
+			}
+		}
+
+		// 最近 2 次之内的不能再用，更早的可以
+		if err := SetPassword(db, user, "Third-pass3", false); !errors.Is(err, ErrPasswordReused) {
+			t.Fatalf("重复使用最近的密码: %v", err)
+		}
+		if err := SetPassword(db, user, "Second-pass2", true); err != nil {
+			t.Fatalf("超出历史范围的旧密码应能使用: %v", err)
+		}
+
+		fresh := reload(t, db, user)
+		if !fresh.CheckPassword("Second-pass2") || !fresh.MustChangePassword {
+			t.Fatal("新密码或强制修改标记没有保存")
+		}
+		if fresh.TokenVersion != version+4 {
+			t.Fatalf("TokenVersion = %d, 期望 %d (每次修改密码递增)", fresh.TokenVersion, version+4)
+		}
+	})
+}
+
+func TestLockoutAfterMaxAttempts(t *testing.T) {
+	useConfig(t, "auth.lockout.max_attempts=3", "auth.lockout.cooldown_minutes=10")
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		user := createUser(t, db, "bob", "Initial-pass1")
+
+		for i := 0; i < 2; i++ {
+			if err := RecordFailure(db, user); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fresh := reload(t, db, user)
+		if IsLocked(fresh) || fresh.FailedAttempts != 2 {
+			t.Fatalf("失败 2 次: 锁定 %v, 计数 %d", IsLocked(fresh), fresh.FailedAttempts)
+		}
+
+		// 成功登录清空计数
+		if err := RecordSuccess(db, fresh); err != nil {
+			t.Fatal(err)
+		}
+		if fresh = reload(t, db, user); fresh.FailedAttempts != 0 {
+			t.Fatalf("登录成功后计数 %d, 期望 0", fresh.FailedAttempts)
+		}
+
+		for i := 0; i < 3; i++ {
+			RecordFailure(db, user)
+		}
+		fresh = reload(t, db, user)
+		if !IsLocked(fresh) || fresh.FailedAttempts != 0 {
+			t.Fatalf("失败 3 次: 锁定 %v, 计数 %d", IsLocked(fresh), fresh.FailedAttempts)
+		}
+		if d := time.Until(*fresh.LockedUntil); d < 9*time.Minute || d > 10*time.Minute {
+			t.Fatalf("锁定时长 %v, 期望约 10 分钟", d)
+		}
+		if err := RecordSuccess(db, fresh); !errors.Is(err, ErrLocked) {
+			t.Fatalf("锁定期内 RecordSuccess = %v, 期望 ErrLocked", err)
+		}
+	})
+}
+
+// 并发的失败请求都基于登录时读到的同一份用户数据，计数仍然逐次累加并锁定账号
+func TestLockoutConcurrentFailures(t *testing.T) {
+	useConfig(t, "auth.lockout.max_attempts=5")
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		user := createUser(t, db, "carol", "Initial-pass1")
+		stale := *user
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				u := stale
+				if err := RecordFailure(db, &u); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if fresh := reload(t, db, user); !IsLocked(fresh) {
+			t.Fatalf("并发失败 5 次后没有锁定 (计数 %d)", fresh.FailedAttempts)
+		}
+		// 与失败请求同时进行、密码正确的请求也不能登录
+		if err := RecordSuccess(db, &stale); !errors.Is(err, ErrLocked) {
+			t.Fatalf("RecordSuccess = %v, 期望 ErrLocked", err)
+		}
+	})
+}
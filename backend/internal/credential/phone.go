@@ -0,0 +1,103 @@
+package credential
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hospital-system/internal/model"
+	"hospital-system/internal/sms"
+	"math/big"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- 手机验证码 ---
+
+const (
+	phoneCodeTTL         = 5 * time.Minute
+	phoneCodeInterval    = time.Minute // 同一号码两次发送的最小间隔
+	phoneCodeDailyLimit  = 10          // 同一号码每天最多发送次数
+	phoneCodeMaxAttempts = 5           // 同一个验证码最多尝试次数
+)
+
+// 验证码用途
+const (
+	PurposeRegister         = "register"
+	PurposeDependentConsent = "dependent_consent" // 成年家属授权
+)
+
+var phonePattern = regexp.MustCompile(`^1[3-9]\d{9}$`)
+
+var (
+	ErrInvalidPhone     = PolicyError("手机号格式错误")
+	ErrPhoneCodeTooSoon = PolicyError("验证码发送过于频繁，请稍后再试")
+	ErrPhoneCodeLimit   = PolicyError("今日验证码发送次数已达上限")
+	ErrInvalidPhoneCode = errors.New("验证码错误或已过期")
+)
+
+// ValidPhone 是否为大陆手机号
+func ValidPhone(phone string) bool {
+	return phonePattern.MatchString(phone)
+}
+
+// SendPhoneCode 生成验证码并通过短信发送，数据库只保存哈希
+func SendPhoneCode(ctx context.Context, db *gorm.DB, phone, purpose string) error {
+	if !ValidPhone(phone) {
+		return ErrInvalidPhone
+	}
+
+	now := time.Now()
+	var last model.PhoneVerification
+	err := db.Where("phone = ?", phone).Order("id desc").First(&last).Error
+	if err == nil && now.Sub(last.CreatedAt) < phoneCodeInterval {
+		return ErrPhoneCodeTooSoon
+	}
+	var today int64
+	db.Model(&model.PhoneVerification{}).
+		Where("phone = ? AND created_at > ?", phone, now.Add(-24*time.Hour)).
+		Count(&today)
+	if today >= phoneCodeDailyLimit {
+		return ErrPhoneCodeLimit
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	err = db.Create(&model.PhoneVerification{
+		Phone:     phone,
+		Purpose:   purpose,
+		CodeHash:  hashToken(phone + ":" + code),
+		ExpiresAt: now.Add(phoneCodeTTL),
+		CreatedAt: now,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf("您的验证码为 %s，%d 分钟内有效。如非本人操作请忽略。", code, int(phoneCodeTTL.Minutes()))
+	return sms.Default.Send(ctx, phone, msg)
+}
+
+// VerifyPhoneCode 校验并消耗验证码 (只认最近一次发送的验证码)
+func VerifyPhoneCode(db *gorm.DB, phone, purpose, code string) error {
+	var v model.PhoneVerification
+	err := db.Where("phone = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", phone, purpose, time.Now()).
+		Order("id desc").First(&v).Error
+	if err != nil || v.Attempts >= phoneCodeMaxAttempts {
+		return ErrInvalidPhoneCode
+	}
+
+	if v.CodeHash != hashToken(phone+":"+code) {
+		db.Model(&v).Update("attempts", v.Attempts+1)
+		return ErrInvalidPhoneCode
+	}
+
+	now := time.Now()
+	return db.Model(&v).Update("used_at", &now).Error
+}
@@ -0,0 +1,183 @@
+package credential
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hospital-system/config"
+	"hospital-system/internal/model"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- TOTP 两步验证 (RFC 6238) ---
+// 30 秒一个时间窗，6 位数字，HMAC-SHA1，与 Google Authenticator / 微信小程序等通用
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpModulo = 1000000 // 10^totpDigits
+	totpSkew   = 1       // 允许前后各偏差一个时间窗
+
+	recoveryCodeCount = 10
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFARequired 该角色是否被强制要求开启两步验证
+func MFARequired(role string) bool {
+	for _, r := range config.Get().Auth.MFA.EnforcedRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateTOTPSecret 生成 160 位随机密钥 (Base32)
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(buf), nil
+}
+
+// ProvisioningURI 生成 otpauth:// 链接，前端直接渲染成二维码即可扫码绑定
+func ProvisioningURI(account, secret string) string {
+	issuer := config.Get().Auth.MFA.Issuer
+	if issuer == "" {
+		issuer = "Hospital System"
+	}
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// totpCode 计算某个时间窗的验证码
+func totpCode(secret string, step int64) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// 动态截断 (RFC 4226 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%totpModulo), nil
+}
+
+// VerifyTOTP 校验验证码，成功时返回命中的时间窗
+// lastStep 是该用户上一次成功使用的时间窗，同一个验证码不能用两次
+func VerifyTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// CheckTOTP 校验用户的验证码并记录时间窗 (防重放)
+// 条件更新：并发的两个请求用同一个验证码时，只有先写入时间窗的一个成功
+func CheckTOTP(db *gorm.DB, user *model.User, code string) bool {
+	step, ok := VerifyTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return false
+	}
+	result := db.Model(&model.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false
+	}
+	user.TOTPLastStep = step
+	return true
+}
+
+// GenerateRecoveryCodes 生成一组新的恢复码 (旧的全部作废)，返回明文
+func GenerateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(b32.EncodeToString(buf)) // 8 位
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		records = append(records, model.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	return codes, err
+}
+
+// UseRecoveryCode 使用一个恢复码 (每个只能用一次)
+func UseRecoveryCode(db *gorm.DB, userID uint, code string) bool {
+	now := time.Now()
+	result := db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		Update("used_at", &now)
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+// ResetMFA 清除用户的两步验证 (密钥、恢复码)，并让所有旧 Token 失效
+func ResetMFA(db *gorm.DB, user *model.User) error {
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.TOTPLastStep = 0
+	user.TokenVersion++
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).
+			Select("totp_secret", "totp_enabled", "totp_last_step", "token_version").
+			Updates(user).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
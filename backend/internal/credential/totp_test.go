@@ -0,0 +1,182 @@
+package credential
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"hospital-system/internal/database/dbtest"
+
+	"gorm.io/gorm"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量 (密钥为 ASCII "12345678901234567890")，取后 6 位
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		code, err := totpCode(rfcSecret, tt.unix/totpPeriod)
+		if err != nil || code != tt.code {
+			t.Errorf("T=%d: totpCode = %q, %v，应为 %s", tt.unix, code, err, tt.code)
+		}
+	}
+	// 小写、带空格的密钥 (用户手工输入) 同样可用
+	if code, _ := totpCode(" gezdgnbvgy3tqojqgezdgnbvgy3tqojq ", 59/totpPeriod); code != "287082" {
+		t.Errorf("小写密钥 totpCode = %q", code)
+	}
+	if _, err := totpCode("不是base32", 1); err == nil {
+		t.Error("非法密钥应返回错误")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	code := func(step int64) string {
+		c, _ := totpCode(rfcSecret, step)
+		return c
+	}
+
+	// 当前时间窗和前后各一个时间窗都接受，返回命中的时间窗
+	for _, step := range []int64{current - 1, current, current + 1} {
+		if got, ok := VerifyTOTP(rfcSecret, code(step), 0, now); !ok || got != step {
+			t.Errorf("时间窗 %d: VerifyTOTP = %d, %v", step-current, got, ok)
+		}
+	}
+	// 超出偏差
+	for _, step := range []int64{current - 2, current + 2} {
+		if _, ok := VerifyTOTP(rfcSecret, code(step), 0, now); ok {
+			t.Errorf("时间窗 %d 不应通过", step-current)
+		}
+	}
+	// 防重放：不接受已经用过的 (及更早的) 时间窗
+	if _, ok := VerifyTOTP(rfcSecret, code(current), current, now); ok {
+		t.Error("同一个验证码不能用两次")
+	}
+	if _, ok := VerifyTOTP(rfcSecret, code(current-1), current, now); ok {
+		t.Error("不应接受比上次更早的时间窗")
+	}
+	if _, ok := VerifyTOTP(rfcSecret, code(current+1), current, now); !ok {
+		t.Error("比上次更晚的时间窗应通过")
+	}
+	// 格式
+	if _, ok := VerifyTOTP(rfcSecret, " "+code(current)+" ", 0, now); !ok {
+		t.Error("应忽略首尾空格")
+	}
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := VerifyTOTP(rfcSecret, bad, 0, now); ok {
+			t.Errorf("%q 不应通过", bad)
+		}
+	}
+}
+
+// CheckTOTP 记录时间窗后，同一个验证码第二次使用失败
+func TestCheckTOTPReplay(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		secret, err := GenerateTOTPSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := createUser(t, db, "doctor1", "Passw0rd!")
+		user.TOTPSecret, user.TOTPEnabled = secret, true
+		db.Save(user)
+
+		code, _ := totpCode(secret, time.Now().Unix()/totpPeriod)
+		if !CheckTOTP(db, user, code) {
+			t.Fatal("正确的验证码应通过")
+		}
+		if fresh := reload(t, db, user); fresh.TOTPLastStep == 0 {
+			t.Error("应记录使用过的时间窗")
+		}
+		if CheckTOTP(db, reload(t, db, user), code) {
+			t.Error("同一个验证码不能用两次")
+		}
+	})
+}
+
+// 两个请求同时用同一个验证码 (都基于登录时读到的同一份用户数据)，只有一个通过
+func TestCheckTOTPConcurrent(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		secret, err := GenerateTOTPSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+		user := createUser(t, db, "doctor1", "Passw0rd!")
+		user.TOTPSecret, user.TOTPEnabled = secret, true
+		db.Save(user)
+		stale := *user
+
+		code, _ := totpCode(secret, time.Now().Unix()/totpPeriod)
+		var wg sync.WaitGroup
+		var passed atomic.Int32
+		for i := 0; i < 5; i++ {
+			wg.Go(func() {
+				u := stale
+				if CheckTOTP(db, &u, code) {
+					passed.Add(1)
+				}
+			})
+		}
+		wg.Wait()
+
+		if n := passed.Load(); n != 1 {
+			t.Fatalf("同一个验证码通过了 %d 次, 期望 1 次", n)
+		}
+	})
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	useConfig(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		user := createUser(t, db, "doctor1", "Passw0rd!")
+		codes, err := GenerateRecoveryCodes(db, user.ID)
+		if err != nil || len(codes) != recoveryCodeCount {
+			t.Fatalf("GenerateRecoveryCodes = %d 个, %v", len(codes), err)
+		}
+
+		// 每个只能用一次；忽略大小写和连字符
+		if !UseRecoveryCode(db, user.ID, codes[0]) {
+			t.Fatal("恢复码应可以使用")
+		}
+		if UseRecoveryCode(db, user.ID, codes[0]) {
+			t.Error("恢复码不能用两次")
+		}
+		if !UseRecoveryCode(db, user.ID, " "+strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))+" ") {
+			t.Error("恢复码应忽略大小写和连字符")
+		}
+
+		// 重新生成后旧的全部作废
+		if _, err := GenerateRecoveryCodes(db, user.ID); err != nil {
+			t.Fatal(err)
+		}
+		if UseRecoveryCode(db, user.ID, codes[2]) {
+			t.Error("重新生成后旧恢复码应作废")
+		}
+
+		// 重置两步验证：清除密钥和恢复码，旧 Token 失效
+		fresh := reload(t, db, user)
+		version := fresh.TokenVersion
+		if err := ResetMFA(db, fresh); err != nil {
+			t.Fatal(err)
+		}
+		fresh = reload(t, db, user)
+		if fresh.TOTPEnabled || fresh.TOTPSecret != "" || fresh.TokenVersion != version+1 {
+			t.Errorf("重置后: enabled=%v secret=%q token_version=%d", fresh.TOTPEnabled, fresh.TOTPSecret, fresh.TokenVersion)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"hospital-system/internal/model"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// migrateDepartments 把账号和挂号记录上的自由文本科室映射到科室表
+// 同一机构内去掉首尾空格后名称相同的视为同一科室，没有对应科室的自动创建 (编码 D001、D002 ...)
+// 只处理 department_id 为空的记录，重复执行没有副作用
+func migrateDepartments(db *gorm.DB) error {
+	type pair struct {
+		OrgID uint
+		Name  string
+	}
+	var pairs []pair
+
+	// 1. 账号按自身机构；挂号记录按接诊医生的机构 (没有医生的归到默认机构1)
+	err := db.Raw(`SELECT DISTINCT COALESCE(NULLIF(org_id, 0), 1) AS org_id, TRIM(department) AS name
+		FROM users WHERE department_id IS NULL AND TRIM(department) <> ''`).Scan(&pairs).Error
+	if err != nil {
+		return err
+	}
+	var bookingPairs []pair
+	err = db.Raw(`SELECT DISTINCT COALESCE(NULLIF(u.org_id, 0), 1) AS org_id, TRIM(b.department) AS name
+		FROM bookings b LEFT JOIN users u ON u.id = b.doctor_id
+		WHERE b.department_id IS NULL AND TRIM(b.department) <> ''`).Scan(&bookingPairs).Error
+	if err != nil {
+		return err
+	}
+	pairs = append(pairs, bookingPairs...)
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, p := range pairs {
+			// 2. 找到或创建科室
+			var dept model.Department
+			err := tx.Where("org_id = ? AND name = ?", p.OrgID, p.Name).First(&dept).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				code, err := nextDepartmentCode(tx, p.OrgID)
+				if err != nil {
+					return err
+				}
+				dept = model.Department{OrgID: p.OrgID, Code: code, Name: p.Name, Active: true}
+				if err := tx.Create(&dept).Error; err != nil {
+					return err
+				}
+				log.Printf("科室迁移: 机构 %d 新建科室 %s (%s)", p.OrgID, dept.Name, dept.Code)
+			} else if err != nil {
+				return err
+			}
+
+			// 3. 回填外键，顺便把名称规范化
+			updates := map[string]interface{}{"department_id": dept.ID, "department": dept.Name}
+			err = tx.Model(&model.User{}).Unscoped().
+				Where("department_id IS NULL AND TRIM(department) = ? AND COALESCE(NULLIF(org_id, 0), 1) = ?", p.Name, p.OrgID).
+				Updates(updates).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&model.Booking{}).
+				Where("department_id IS NULL AND TRIM(department) = ?", p.Name).
+				Where("COALESCE((SELECT NULLIF(org_id, 0) FROM users WHERE users.id = bookings.doctor_id), 1) = ?", p.OrgID).
+				Updates(updates).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// nextDepartmentCode 机构内下一个未被占用的 Dxxx 编码
+func nextDepartmentCode(tx *gorm.DB, orgID uint) (string, error) {
+	var count int64
+	if err := tx.Model(&model.Department{}).Where("org_id = ?", orgID).Count(&count).Error; err != nil {
+		return "", err
+	}
+	for n := count + 1; ; n++ {
+		code := fmt.Sprintf("D%03d", n)
+		var exists int64
+		tx.Model(&model.Department{}).Where("org_id = ? AND code = ?", orgID, code).Count(&exists)
+		if exists == 0 {
+			return code, nil
+		}
+	}
+}
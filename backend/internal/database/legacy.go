@@ -0,0 +1,146 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"hospital-system/internal/logging"
+
+	"gorm.io/gorm"
+)
+
+// --- 旧数据库纳入版本管理 ---
+// 引入版本化迁移之前，表结构由 AutoMigrate 在每次启动时补齐。
+// 第一次用新程序打开这样的数据库 (有业务表、没有迁移记录) 时 (只有 SQLite，PostgreSQL 从一开始就使用迁移)：
+//   1. 按基线补齐缺少的表、列和索引 (只增不删，不改已有列)
+//   2. 把自由文本科室映射到科室表
+//   3. 记录基线已执行，之后的迁移正常执行
+
+// 基线迁移的版本号
+const baselineVersion = 1
+
+// tableColumn PRAGMA table_info 的一行
+type tableColumn struct {
+	Name      string
+	Type      string
+	Notnull   int
+	DfltValue *string
+}
+
+// adoptLegacySchema 发现未纳入版本管理的旧数据库时按基线补齐并记录
+func adoptLegacySchema(db *gorm.DB, migrations []Migration) error {
+	if !isSQLite(db) || !db.Migrator().HasTable("users") {
+		return nil
+	}
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		var count int64
+		if err := db.Model(&SchemaMigration{}).Count(&count).Error; err != nil || count > 0 {
+			return err
+		}
+	}
+	log.Println("检测到未纳入版本管理的旧数据库，按基线补齐表结构...")
+	baseline := migrations[baselineVersion-1]
+
+	// ATTACH 只对当前连接有效，整个过程使用同一个连接
+	err := db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("ATTACH DATABASE ':memory:' AS baseline").Error; err != nil {
+			return err
+		}
+		defer conn.Exec("DETACH DATABASE baseline")
+
+		stmts := splitStatements(baseline.Up)
+		for _, stmt := range stmts {
+			if strings.HasPrefix(stmt, "CREATE TABLE `") {
+				if err := reconcileTable(conn, stmt); err != nil {
+					return err
+				}
+			}
+		}
+		for _, stmt := range stmts {
+			if !strings.HasPrefix(stmt, "CREATE INDEX") && !strings.HasPrefix(stmt, "CREATE UNIQUE INDEX") {
+				continue
+			}
+			stmt = strings.Replace(stmt, "INDEX `", "INDEX IF NOT EXISTS `", 1)
+			if err := conn.Exec(stmt).Error; err != nil {
+				// 唯一索引可能因为历史重复数据建不起来，记录下来由人工处理，不阻止启动
+				logging.Errorf("创建索引失败，请人工检查: %s: %v", stmt, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("补齐旧数据库表结构失败: %w", err)
+	}
+
+	if err := migrateDepartments(db); err != nil {
+		return fmt.Errorf("科室数据迁移失败: %w", err)
+	}
+
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+	return db.Create(&SchemaMigration{
+		Version:   baseline.Version,
+		Name:      baseline.Name,
+		Checksum:  baseline.Checksum,
+		AppliedAt: time.Now(),
+	}).Error
+}
+
+// reconcileTable 表不存在时按基线创建；存在时补上基线中有、当前没有的列
+func reconcileTable(conn *gorm.DB, createSQL string) error {
+	table := strings.SplitN(createSQL, "`", 3)[1]
+	if !conn.Migrator().HasTable(table) {
+		log.Printf("创建表 %s", table)
+		return conn.Exec(createSQL).Error
+	}
+
+	// 在内存库中建出基线版本的表，对比列
+	if err := conn.Exec(strings.Replace(createSQL, "CREATE TABLE `", "CREATE TABLE baseline.`", 1)).Error; err != nil {
+		return err
+	}
+	var want, have []tableColumn
+	if err := conn.Raw(fmt.Sprintf("PRAGMA baseline.table_info(`%s`)", table)).Scan(&want).Error; err != nil {
+		return err
+	}
+	if err := conn.Raw(fmt.Sprintf("PRAGMA main.table_info(`%s`)", table)).Scan(&have).Error; err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(have))
+	for _, c := range have {
+		existing[c.Name] = true
+	}
+
+	for _, c := range want {
+		if existing[c.Name] {
+			continue
+		}
+		def := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, c.Name, c.Type)
+		switch {
+		case c.DfltValue != nil && c.Notnull == 1:
+			def += " NOT NULL DEFAULT " + *c.DfltValue
+		case c.DfltValue != nil:
+			def += " DEFAULT " + *c.DfltValue
+		case c.Notnull == 1:
+			// SQLite 新增 NOT NULL 列必须有默认值
+			def += " NOT NULL DEFAULT " + zeroValue(c.Type)
+		}
+		log.Printf("表 %s 增加列 %s", table, c.Name)
+		if err := conn.Exec(def).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zeroValue 按列类型给出默认值
+func zeroValue(colType string) string {
+	switch strings.ToLower(colType) {
+	case "integer", "numeric", "real":
+		return "0"
+	default:
+		return "''"
+	}
+}
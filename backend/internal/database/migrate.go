@@ -0,0 +1,322 @@
+package database
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// --- 版本化迁移 ---
+// 迁移文件编译进程序：migrations/<方言>/<版本>_<名称>.up.sql 和对应的 .down.sql，版本号从 0001 连续递增
+// 每种数据库 (sqlite、postgres) 一套迁移，版本号和内容要一一对应，新增迁移时两边都要写
+// 已执行的版本记在 schema_migrations 表中，连同 up 文件的校验和 (发布后不要再修改已有的迁移文件)
+// 修改表结构时新增一个迁移，不要再依赖 AutoMigrate
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+var (
+	ErrSchemaTooNew      = errors.New("数据库版本比程序新")
+	ErrPendingMigrations = errors.New("有未执行的数据库迁移")
+)
+
+// Migration 一个迁移
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // up 文件的 SHA-256
+}
+
+// SchemaMigration schema_migrations 表中的一条记录
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationStatus 迁移状态
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // 执行后迁移文件又被修改过
+}
+
+// loadMigrations 读取编译进程序中当前数据库方言的迁移，按版本排序
+func loadMigrations(db *gorm.DB) ([]Migration, error) {
+	dir := path.Join("migrations", db.Dialector.Name())
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("迁移文件名格式错误: %s", name)
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: label}
+			byVersion[version] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("迁移 %d 的 up 和 down 文件名称不一致", version)
+		}
+		if direction == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("迁移 %d 缺少 up 或 down 文件", m.Version)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("迁移版本不连续: 缺少 %04d", i+1)
+		}
+	}
+	return list, nil
+}
+
+// splitStatements 按行尾分号拆分 SQL 语句，去掉 -- 注释行
+func splitStatements(sql string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if s := strings.TrimSpace(cur.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// appliedMigrations 已执行的迁移
+func appliedMigrations(db *gorm.DB) (map[int]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]SchemaMigration, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// checkNotNewer 数据库里有程序不认识的更高版本时拒绝继续 (用旧程序打开了新数据库)
+func checkNotNewer(applied map[int]SchemaMigration, migrations []Migration) error {
+	latest := len(migrations)
+	for v := range applied {
+		if v > latest {
+			return fmt.Errorf("%w: 数据库已迁移到版本 %d，本程序只支持到 %d，请升级程序", ErrSchemaTooNew, v, latest)
+		}
+	}
+	return nil
+}
+
+// MigrateUp 执行未执行的迁移，steps <= 0 表示全部执行，返回执行了的迁移
+func MigrateUp(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := adoptLegacySchema(db, migrations); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotNewer(applied, migrations); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if steps > 0 && len(done) >= steps {
+			break
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range splitStatements(m.Up) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("执行迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("已执行迁移 %04d_%s", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown 回滚最近执行的 steps 个迁移 (至少 1 个)，返回回滚了的迁移
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNotNewer(applied, migrations); err != nil {
+		return nil, err
+	}
+	if steps < 1 {
+		steps = 1
+	}
+
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range splitStatements(m.Down) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("回滚迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("已回滚迁移 %04d_%s", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Status 所有迁移的执行状态；unknown 为数据库中有、程序里没有的版本
+func Status(db *gorm.DB) (list []MigrationStatus, unknown []SchemaMigration, err error) {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range migrations {
+		s := MigrationStatus{Version: m.Version, Name: m.Name}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied, s.AppliedAt, s.Modified = true, a.AppliedAt, a.Checksum != m.Checksum
+			delete(applied, m.Version)
+		}
+		list = append(list, s)
+	}
+	for _, a := range applied {
+		unknown = append(unknown, a)
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i].Version < unknown[j].Version })
+	return list, unknown, nil
+}
+
+// SchemaVersion 数据库已执行到的最高版本和本程序支持的最高版本
+// 只读 (不像 Status 那样建 schema_migrations 表)，可以用于只读打开的数据库；没有迁移记录时 current 为 0
+func SchemaVersion(db *gorm.DB) (current, latest int, err error) {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return 0, 0, err
+	}
+	latest = len(migrations)
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, latest, nil
+	}
+	err = db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&current).Error
+	return current, latest, err
+}
+
+// prepareSchema 启动时检查数据库版本：太新则拒绝启动；有待执行的迁移时自动执行或拒绝启动
+func prepareSchema(db *gorm.DB, autoMigrate bool) error {
+	migrations, err := loadMigrations(db)
+	if err != nil {
+		return err
+	}
+	if err := adoptLegacySchema(db, migrations); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+	if err := checkNotNewer(applied, migrations); err != nil {
+		return err
+	}
+
+	pending := len(migrations) - len(applied)
+	if pending == 0 {
+		return nil
+	}
+	if !autoMigrate {
+		return fmt.Errorf("%w (%d 个)，请先运行 ./server migrate up", ErrPendingMigrations, pending)
+	}
+	_, err = MigrateUp(db, 0)
+	return err
+}
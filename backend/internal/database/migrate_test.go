@@ -0,0 +1,131 @@
+package database_test
+
+import (
+	"testing"
+
+	"hospital-system/internal/database"
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 全部迁移执行、全部回滚、再执行一遍，状态与表结构前后一致
+func TestMigrateUpDownUp(t *testing.T) {
+	for _, driver := range dbtest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			db := dbtest.OpenEmpty(t, driver)
+
+			done, err := database.MigrateUp(db, 0)
+			if err != nil {
+				t.Fatalf("执行迁移失败: %v", err)
+			}
+			if len(done) == 0 {
+				t.Fatal("空库没有执行任何迁移")
+			}
+			assertStatus(t, db, len(done), len(done))
+			for _, table := range []string{"users", "bookings", "orders", "audit_logs", "erasure_requests"} {
+				if !db.Migrator().HasTable(table) {
+					t.Fatalf("迁移后缺少表 %s", table)
+				}
+			}
+
+			// 再执行一次没有待执行的迁移
+			again, err := database.MigrateUp(db, 0)
+			if err != nil || len(again) != 0 {
+				t.Fatalf("重复执行迁移: %d 个, %v", len(again), err)
+			}
+
+			undone, err := database.MigrateDown(db, len(done))
+			if err != nil {
+				t.Fatalf("回滚迁移失败: %v", err)
+			}
+			if len(undone) != len(done) {
+				t.Fatalf("回滚了 %d 个迁移, 期望 %d", len(undone), len(done))
+			}
+			assertStatus(t, db, len(done), 0)
+			if db.Migrator().HasTable("users") {
+				t.Fatal("全部回滚后 users 表仍然存在")
+			}
+
+			if _, err := database.MigrateUp(db, 0); err != nil {
+				t.Fatalf("回滚后重新执行迁移失败: %v", err)
+			}
+			assertStatus(t, db, len(done), len(done))
+		})
+	}
+}
+
+// 按步执行：每次只执行一个迁移
+func TestMigrateSteps(t *testing.T) {
+	for _, driver := range dbtest.Drivers() {
+		t.Run(driver, func(t *testing.T) {
+			db := dbtest.OpenEmpty(t, driver)
+
+			done, err := database.MigrateUp(db, 1)
+			if err != nil || len(done) != 1 || done[0].Version != 1 {
+				t.Fatalf("执行第一个迁移: %v, %v", done, err)
+			}
+			list, _, err := database.Status(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertStatus(t, db, len(list), 1)
+
+			if _, err := database.MigrateUp(db, 0); err != nil {
+				t.Fatalf("执行剩余迁移失败: %v", err)
+			}
+			assertStatus(t, db, len(list), len(list))
+		})
+	}
+}
+
+// 账号、挂号记录的科室有外键约束：不能指向不存在的科室，仍被引用的科室不能删除
+func TestDepartmentForeignKeys(t *testing.T) {
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		dept := model.Department{OrgID: 1, Code: "D001", Name: "内科", Active: true}
+		if err := db.Create(&dept).Error; err != nil {
+			t.Fatal(err)
+		}
+		missing := dept.ID + 100
+		if err := db.Create(&model.User{Username: "ghost", Password: "x", Role: "doctor", DepartmentID: &missing}).Error; err == nil {
+			t.Error("账号指向不存在的科室应被拒绝")
+		}
+		if err := db.Create(&model.Booking{PatientName: "张三", DepartmentID: &missing}).Error; err == nil {
+			t.Error("挂号记录指向不存在的科室应被拒绝")
+		}
+
+		if err := db.Create(&model.Booking{PatientName: "张三", DepartmentID: &dept.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Delete(&dept).Error; err == nil {
+			t.Error("仍有挂号记录的科室不应能删除")
+		}
+	})
+}
+
+func assertStatus(t *testing.T, db *gorm.DB, total, applied int) {
+	t.Helper()
+	list, unknown, err := database.Status(db)
+	if err != nil {
+		t.Fatalf("读取迁移状态失败: %v", err)
+	}
+	if len(unknown) != 0 {
+		t.Fatalf("数据库中有程序不认识的迁移: %v", unknown)
+	}
+	if len(list) != total {
+		t.Fatalf("迁移总数 %d, 期望 %d", len(list), total)
+	}
+	n := 0
+	for _, s := range list {
+		if s.Modified {
+			t.Fatalf("迁移 %04d 的校验和不一致", s.Version)
+		}
+		if s.Applied {
+			n++
+		}
+	}
+	if n != applied {
+		t.Fatalf("已执行 %d 个迁移, 期望 %d", n, applied)
+	}
+}
@@ -0,0 +1,111 @@
+-- 基线：与 SQLite 基线相同的表结构 (PostgreSQL 类型)
+
+-- users
+CREATE TABLE "users" ("id" bigserial,"username" text NOT NULL,"password" text NOT NULL,"role" text NOT NULL,"org_id" bigint,"department" text,"department_id" bigint,"auth_source" text NOT NULL DEFAULT 'local',"external_subject" text,"patient_id" bigint,"enabled" boolean NOT NULL DEFAULT true,"failed_attempts" bigint,"locked_until" timestamptz,"must_change_password" boolean,"password_changed_at" timestamptz,"token_version" bigint NOT NULL DEFAULT 0,"totp_secret" text,"totp_enabled" boolean,"totp_last_step" bigint,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,PRIMARY KEY ("id"),CONSTRAINT "uni_users_username" UNIQUE ("username"));
+CREATE INDEX IF NOT EXISTS "idx_users_deleted_at" ON "users" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_patient_id" ON "users" ("patient_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_users_external_subject" ON "users" ("external_subject");
+CREATE INDEX IF NOT EXISTS "idx_users_department_id" ON "users" ("department_id");
+
+-- departments
+CREATE TABLE "departments" ("id" bigserial,"org_id" bigint NOT NULL,"code" text NOT NULL,"name" text NOT NULL,"parent_id" bigint,"head_id" bigint,"active" boolean NOT NULL DEFAULT true,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_departments_parent_id" ON "departments" ("parent_id");
+CREATE INDEX IF NOT EXISTS "idx_departments_name" ON "departments" ("name");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_department_org_code" ON "departments" ("org_id","code");
+
+-- doctor_profiles
+CREATE TABLE "doctor_profiles" ("user_id" bigint,"name" text NOT NULL,"title" text,"specialties" text,"bio" text,"photo_url" text,"consultation_fee" decimal,"available_days" text,"updated_at" timestamptz,PRIMARY KEY ("user_id"));
+
+-- media_files
+CREATE TABLE "media_files" ("id" bigserial,"category" text NOT NULL,"key" text NOT NULL,"thumb_key" text,"content_type" text,"size" bigint,"width" bigint,"height" bigint,"sha256" text,"title" text,"original_name" text,"owner_id" bigint,"sort_order" bigint,"uploaded_by" bigint,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_media_files_owner_id" ON "media_files" ("owner_id");
+CREATE INDEX IF NOT EXISTS "idx_media_files_thumb_key" ON "media_files" ("thumb_key");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_media_files_key" ON "media_files" ("key");
+CREATE INDEX IF NOT EXISTS "idx_media_files_category" ON "media_files" ("category");
+
+-- record_attachments
+CREATE TABLE "record_attachments" ("id" bigserial,"record_id" bigint NOT NULL,"media_id" bigint NOT NULL,"kind" text,"note" text,"uploaded_by" bigint,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_record_attachments_record_id" ON "record_attachments" ("record_id");
+
+-- password_histories
+CREATE TABLE "password_histories" ("id" bigserial,"user_id" bigint NOT NULL,"password_hash" text NOT NULL,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_password_histories_user_id" ON "password_histories" ("user_id");
+
+-- password_reset_tokens
+CREATE TABLE "password_reset_tokens" ("id" bigserial,"user_id" bigint NOT NULL,"token_hash" text NOT NULL,"created_by" bigint,"expires_at" timestamptz,"used_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_password_reset_tokens_token_hash" ON "password_reset_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_password_reset_tokens_user_id" ON "password_reset_tokens" ("user_id");
+
+-- recovery_codes
+CREATE TABLE "recovery_codes" ("id" bigserial,"user_id" bigint NOT NULL,"code_hash" text NOT NULL,"used_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
+
+-- inventory_items
+CREATE TABLE "inventory_items" ("id" bigserial,"name" text NOT NULL,"category" text,"price" decimal,"stock" bigint,"description" text,"org_id" bigint,"created_at" timestamptz,"updated_at" timestamptz,"deleted_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_inventory_items_deleted_at" ON "inventory_items" ("deleted_at");
+
+-- patients
+CREATE TABLE "patients" ("id" bigserial,"name" text,"phone" text,"id_card" text,"gender" text,"birth_date" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_patients_id_card" ON "patients" ("id_card");
+
+-- phone_verifications
+CREATE TABLE "phone_verifications" ("id" bigserial,"phone" text NOT NULL,"purpose" text NOT NULL,"code_hash" text NOT NULL,"attempts" bigint,"expires_at" timestamptz,"used_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_phone_verifications_phone" ON "phone_verifications" ("phone");
+
+-- bookings
+CREATE TABLE "bookings" ("id" bigserial,"patient_name" text,"patient_id" bigint,"age" bigint,"gender" text,"department" text,"department_id" bigint,"doctor_id" bigint,"status" text,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_bookings_department_id" ON "bookings" ("department_id");
+
+-- medical_records
+CREATE TABLE "medical_records" ("id" bigserial,"booking_id" bigint,"diagnosis" text,"prescription" text,"created_at" timestamptz,PRIMARY KEY ("id"));
+
+-- lab_results
+CREATE TABLE "lab_results" ("id" bigserial,"booking_id" bigint,"item_name" text NOT NULL,"result" text,"unit" text,"reference_range" text,"abnormal" boolean,"doctor_id" bigint,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_lab_results_booking_id" ON "lab_results" ("booking_id");
+
+-- orders
+CREATE TABLE "orders" ("id" bigserial,"booking_id" bigint,"total_amount" decimal,"status" text,"medicine_id" bigint,"quantity" bigint,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"));
+
+-- patient_allergies
+CREATE TABLE "patient_allergies" ("id" bigserial,"patient_name" text NOT NULL,"allergen" text NOT NULL,"severity" text,"reaction" text,"recorded_by" bigint,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_patient_allergies_patient_name" ON "patient_allergies" ("patient_name");
+
+-- drug_interaction_rules
+CREATE TABLE "drug_interaction_rules" ("id" bigserial,"item_a" text NOT NULL,"item_b" text NOT NULL,"level" text NOT NULL,"description" text,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_drug_interaction_rules_item_b" ON "drug_interaction_rules" ("item_b");
+CREATE INDEX IF NOT EXISTS "idx_drug_interaction_rules_item_a" ON "drug_interaction_rules" ("item_a");
+
+-- prescription_overrides
+CREATE TABLE "prescription_overrides" ("id" bigserial,"medical_record_id" bigint,"booking_id" bigint,"doctor_id" bigint,"medicine_id" bigint,"warnings" text,"reason" text NOT NULL,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_prescription_overrides_medical_record_id" ON "prescription_overrides" ("medical_record_id");
+
+-- record_consents
+CREATE TABLE "record_consents" ("id" bigserial,"patient_name" text NOT NULL,"department" text NOT NULL,"granted_by" bigint,"expires_at" timestamptz,"revoked_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_record_consents_patient_name" ON "record_consents" ("patient_name");
+
+-- dependents
+CREATE TABLE "dependents" ("id" bigserial,"guardian_id" bigint NOT NULL,"patient_id" bigint NOT NULL,"patient_name" text NOT NULL,"relationship" text NOT NULL,"consent_method" text NOT NULL,"expires_at" timestamptz,"revoked_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_dependents_patient_name" ON "dependents" ("patient_name");
+CREATE INDEX IF NOT EXISTS "idx_dependents_patient_id" ON "dependents" ("patient_id");
+CREATE INDEX IF NOT EXISTS "idx_dependents_guardian_id" ON "dependents" ("guardian_id");
+
+-- break_glass_grants
+CREATE TABLE "break_glass_grants" ("id" bigserial,"user_id" bigint NOT NULL,"patient_name" text NOT NULL,"reason" text NOT NULL,"expires_at" timestamptz,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_break_glass_grants_patient_name" ON "break_glass_grants" ("patient_name");
+CREATE INDEX IF NOT EXISTS "idx_break_glass_grants_user_id" ON "break_glass_grants" ("user_id");
+
+-- record_access_logs
+CREATE TABLE "record_access_logs" ("id" bigserial,"user_id" bigint,"role" text,"patient_name" text,"record_id" bigint,"action" text,"basis" text,"reason" text,"ip" text,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_record_access_logs_created_at" ON "record_access_logs" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_record_access_logs_patient_name" ON "record_access_logs" ("patient_name");
+CREATE INDEX IF NOT EXISTS "idx_record_access_logs_user_id" ON "record_access_logs" ("user_id");
+
+-- audit_logs
+CREATE TABLE "audit_logs" ("id" bigserial,"actor_id" bigint,"actor_role" text,"org_id" bigint,"ip" text,"action" text,"operation" text,"entity_type" text,"entity_id" text,"before" text,"after" text,"prev_hash" text,"hash" text,"created_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_created_at" ON "audit_logs" ("created_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_audit_logs_hash" ON "audit_logs" ("hash");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_entity_id" ON "audit_logs" ("entity_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_entity_type" ON "audit_logs" ("entity_type");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_operation" ON "audit_logs" ("operation");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_org_id" ON "audit_logs" ("org_id");
+CREATE INDEX IF NOT EXISTS "idx_audit_logs_actor_id" ON "audit_logs" ("actor_id");
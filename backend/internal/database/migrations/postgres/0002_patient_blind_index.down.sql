@@ -0,0 +1,7 @@
+-- 只恢复表结构，已加密的数据仍是密文，旧版本程序无法读取
+
+DROP INDEX IF EXISTS "idx_patients_id_card_hash";
+DROP INDEX IF EXISTS "idx_patients_phone_hash";
+ALTER TABLE "patients" DROP COLUMN "id_card_hash";
+ALTER TABLE "patients" DROP COLUMN "phone_hash";
+CREATE INDEX "idx_patients_id_card" ON "patients" ("id_card");
@@ -0,0 +1,8 @@
+-- 患者手机号、身份证号改为加密存储，按原值查找改用盲索引列；原值列上的索引不再有用
+-- 已有数据在启动时加密并补齐盲索引 (见 internal/database/reencrypt.go)
+
+ALTER TABLE "patients" ADD COLUMN "phone_hash" text;
+ALTER TABLE "patients" ADD COLUMN "id_card_hash" text;
+CREATE INDEX "idx_patients_phone_hash" ON "patients" ("phone_hash");
+CREATE INDEX "idx_patients_id_card_hash" ON "patients" ("id_card_hash");
+DROP INDEX IF EXISTS "idx_patients_id_card";
@@ -0,0 +1,8 @@
+-- 数据保留与患者数据删除：匿名化标记和删除申请表 (见 internal/privacy)
+
+ALTER TABLE "patients" ADD COLUMN "anonymized_at" timestamptz;
+ALTER TABLE "bookings" ADD COLUMN "anonymized_at" timestamptz;
+
+CREATE TABLE "erasure_requests" ("id" bigserial,"patient_id" bigint NOT NULL,"requested_by" bigint NOT NULL,"reason" text,"status" text NOT NULL,"reviewed_by" bigint,"review_note" text,"reviewed_at" timestamptz,"summary" text,"created_at" timestamptz,"updated_at" timestamptz,PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "idx_erasure_requests_status" ON "erasure_requests" ("status");
+CREATE INDEX IF NOT EXISTS "idx_erasure_requests_patient_id" ON "erasure_requests" ("patient_id");
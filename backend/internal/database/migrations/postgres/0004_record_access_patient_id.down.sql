@@ -0,0 +1,9 @@
+-- 只恢复表结构，为老账号补建的档案和挂号关联保留
+
+DROP INDEX IF EXISTS "idx_bookings_patient_id";
+DROP INDEX IF EXISTS "idx_record_access_logs_patient_id";
+DROP INDEX IF EXISTS "idx_break_glass_grants_patient_id";
+DROP INDEX IF EXISTS "idx_record_consents_patient_id";
+ALTER TABLE "record_access_logs" DROP COLUMN "patient_id";
+ALTER TABLE "break_glass_grants" DROP COLUMN "patient_id";
+ALTER TABLE "record_consents" DROP COLUMN "patient_id";
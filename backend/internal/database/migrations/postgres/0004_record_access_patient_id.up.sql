@@ -0,0 +1,31 @@
+-- 病历授权、紧急访问和访问日志改为按患者档案 ID 关联 (姓名会重名)，patient_name 只保留作展示
+-- 已有数据：先给没有档案的老账号补建档案；授权按授权人账号关联的档案补齐；紧急访问和访问日志按账号用户名，或全库唯一的档案姓名补齐，补不上的为 0
+
+ALTER TABLE "record_consents" ADD COLUMN "patient_id" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "break_glass_grants" ADD COLUMN "patient_id" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "record_access_logs" ADD COLUMN "patient_id" bigint NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS "idx_record_consents_patient_id" ON "record_consents" ("patient_id");
+CREATE INDEX IF NOT EXISTS "idx_break_glass_grants_patient_id" ON "break_glass_grants" ("patient_id");
+CREATE INDEX IF NOT EXISTS "idx_record_access_logs_patient_id" ON "record_access_logs" ("patient_id");
+CREATE INDEX IF NOT EXISTS "idx_bookings_patient_id" ON "bookings" ("patient_id");
+
+-- 早期注册的患者账号没有档案，病历按 "患者姓名 = 用户名" 归属：为其补建档案 (姓名即用户名) 并关联账号和挂号
+-- phone_hash 临时写入账号标记，用于找回新建的档案，关联完成后清空
+INSERT INTO "patients" ("name", "phone_hash", "created_at")
+  SELECT "username", 'legacy-account:' || "id", "created_at" FROM "users"
+  WHERE "role" = 'general_user' AND "patient_id" IS NULL AND "deleted_at" IS NULL;
+UPDATE "users" SET "patient_id" = (SELECT "id" FROM "patients" WHERE "patients"."phone_hash" = 'legacy-account:' || "users"."id")
+  WHERE "role" = 'general_user' AND "patient_id" IS NULL AND "deleted_at" IS NULL;
+UPDATE "patients" SET "phone_hash" = NULL WHERE "phone_hash" LIKE 'legacy-account:%';
+UPDATE "bookings" SET "patient_id" = (SELECT "patient_id" FROM "users" WHERE "users"."username" = "bookings"."patient_name" AND "users"."role" = 'general_user')
+  WHERE "patient_id" IS NULL AND EXISTS (SELECT 1 FROM "users" WHERE "users"."username" = "bookings"."patient_name" AND "users"."role" = 'general_user' AND "users"."patient_id" IS NOT NULL);
+
+UPDATE "record_consents" SET "patient_id" = COALESCE((SELECT "patient_id" FROM "users" WHERE "users"."id" = "record_consents"."granted_by"), 0);
+UPDATE "break_glass_grants" SET "patient_id" = COALESCE(
+  (SELECT "patient_id" FROM "users" WHERE "users"."username" = "break_glass_grants"."patient_name"),
+  (SELECT CASE WHEN COUNT(*) = 1 THEN MIN("id") END FROM "patients" WHERE "patients"."name" = "break_glass_grants"."patient_name"),
+  0);
+UPDATE "record_access_logs" SET "patient_id" = COALESCE(
+  (SELECT "patient_id" FROM "users" WHERE "users"."username" = "record_access_logs"."patient_name"),
+  (SELECT CASE WHEN COUNT(*) = 1 THEN MIN("id") END FROM "patients" WHERE "patients"."name" = "record_access_logs"."patient_name"),
+  0);
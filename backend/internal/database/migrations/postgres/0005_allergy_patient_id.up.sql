@@ -0,0 +1,10 @@
+-- 过敏史改为按患者档案 ID 关联 (姓名会重名)，patient_name 只保留作展示
+-- 已有数据按账号用户名，或全库唯一的档案姓名补齐；补不上的为 0，需要人工核对后重新登记
+
+ALTER TABLE "patient_allergies" ADD COLUMN "patient_id" bigint NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS "idx_patient_allergies_patient_id" ON "patient_allergies" ("patient_id");
+
+UPDATE "patient_allergies" SET "patient_id" = COALESCE(
+  (SELECT "patient_id" FROM "users" WHERE "users"."username" = "patient_allergies"."patient_name" AND "users"."role" = 'general_user'),
+  (SELECT CASE WHEN COUNT(*) = 1 THEN MIN("id") END FROM "patients" WHERE "patients"."name" = "patient_allergies"."patient_name"),
+  0);
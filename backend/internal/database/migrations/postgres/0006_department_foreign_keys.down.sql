@@ -0,0 +1,4 @@
+ALTER TABLE "bookings" DROP CONSTRAINT IF EXISTS "fk_bookings_department_ref";
+ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "fk_users_department_ref";
+DROP INDEX IF EXISTS "idx_record_consents_department_id";
+ALTER TABLE "record_consents" DROP COLUMN "department_id";
@@ -0,0 +1,12 @@
+-- 科室授权按科室 ID 生效：科室改名、合并时按 ID 同步，不会串到其他机构的同名科室
+-- 已有授权只在全库只有一个同名科室时补齐；有歧义的补不上 (为空) 即不再生效，需要患者重新授权
+ALTER TABLE "record_consents" ADD COLUMN "department_id" bigint;
+CREATE INDEX IF NOT EXISTS "idx_record_consents_department_id" ON "record_consents" ("department_id");
+UPDATE "record_consents" SET "department_id" = (SELECT MIN("id") FROM "departments" WHERE "departments"."name" = "record_consents"."department")
+WHERE (SELECT COUNT(*) FROM "departments" WHERE "departments"."name" = "record_consents"."department") = 1;
+
+-- 账号、挂号记录的 department_id 加外键约束，先清掉指向不存在的科室的值
+UPDATE "users" SET "department_id" = NULL WHERE "department_id" IS NOT NULL AND "department_id" NOT IN (SELECT "id" FROM "departments");
+UPDATE "bookings" SET "department_id" = NULL WHERE "department_id" IS NOT NULL AND "department_id" NOT IN (SELECT "id" FROM "departments");
+ALTER TABLE "users" ADD CONSTRAINT "fk_users_department_ref" FOREIGN KEY ("department_id") REFERENCES "departments"("id");
+ALTER TABLE "bookings" ADD CONSTRAINT "fk_bookings_department_ref" FOREIGN KEY ("department_id") REFERENCES "departments"("id");
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "idx_media_files_org_id";
+ALTER TABLE "media_files" DROP COLUMN "org_id";
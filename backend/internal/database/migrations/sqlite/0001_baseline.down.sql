@@ -0,0 +1,25 @@
+-- 回滚基线即删除全部业务表 (数据会全部丢失)
+
+DROP TABLE IF EXISTS `audit_logs`;
+DROP TABLE IF EXISTS `record_access_logs`;
+DROP TABLE IF EXISTS `break_glass_grants`;
+DROP TABLE IF EXISTS `dependents`;
+DROP TABLE IF EXISTS `record_consents`;
+DROP TABLE IF EXISTS `prescription_overrides`;
+DROP TABLE IF EXISTS `drug_interaction_rules`;
+DROP TABLE IF EXISTS `patient_allergies`;
+DROP TABLE IF EXISTS `orders`;
+DROP TABLE IF EXISTS `lab_results`;
+DROP TABLE IF EXISTS `medical_records`;
+DROP TABLE IF EXISTS `bookings`;
+DROP TABLE IF EXISTS `phone_verifications`;
+DROP TABLE IF EXISTS `patients`;
+DROP TABLE IF EXISTS `inventory_items`;
+DROP TABLE IF EXISTS `recovery_codes`;
+DROP TABLE IF EXISTS `password_reset_tokens`;
+DROP TABLE IF EXISTS `password_histories`;
+DROP TABLE IF EXISTS `record_attachments`;
+DROP TABLE IF EXISTS `media_files`;
+DROP TABLE IF EXISTS `doctor_profiles`;
+DROP TABLE IF EXISTS `departments`;
+DROP TABLE IF EXISTS `users`;
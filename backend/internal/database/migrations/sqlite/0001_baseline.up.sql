@@ -0,0 +1,111 @@
+-- 基线：与引入版本化迁移之前 AutoMigrate 建出的表结构一致
+
+-- users
+CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`username` text NOT NULL,`password` text NOT NULL,`role` text NOT NULL,`org_id` integer,`department` text,`department_id` integer,`auth_source` text NOT NULL DEFAULT "local",`external_subject` text,`patient_id` integer,`enabled` numeric NOT NULL DEFAULT true,`failed_attempts` integer,`locked_until` datetime,`must_change_password` numeric,`password_changed_at` datetime,`token_version` integer NOT NULL DEFAULT 0,`totp_secret` text,`totp_enabled` numeric,`totp_last_step` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,CONSTRAINT `uni_users_username` UNIQUE (`username`));
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+CREATE UNIQUE INDEX `idx_users_patient_id` ON `users`(`patient_id`);
+CREATE UNIQUE INDEX `idx_users_external_subject` ON `users`(`external_subject`);
+CREATE INDEX `idx_users_department_id` ON `users`(`department_id`);
+
+-- departments
+CREATE TABLE `departments` (`id` integer PRIMARY KEY AUTOINCREMENT,`org_id` integer NOT NULL,`code` text NOT NULL,`name` text NOT NULL,`parent_id` integer,`head_id` integer,`active` numeric NOT NULL DEFAULT true,`created_at` datetime,`updated_at` datetime);
+CREATE INDEX `idx_departments_parent_id` ON `departments`(`parent_id`);
+CREATE INDEX `idx_departments_name` ON `departments`(`name`);
+CREATE UNIQUE INDEX `idx_department_org_code` ON `departments`(`org_id`,`code`);
+
+-- doctor_profiles
+CREATE TABLE `doctor_profiles` (`user_id` integer,`name` text NOT NULL,`title` text,`specialties` text,`bio` text,`photo_url` text,`consultation_fee` real,`available_days` text,`updated_at` datetime,PRIMARY KEY (`user_id`));
+
+-- media_files
+CREATE TABLE `media_files` (`id` integer PRIMARY KEY AUTOINCREMENT,`category` text NOT NULL,`key` text NOT NULL,`thumb_key` text,`content_type` text,`size` integer,`width` integer,`height` integer,`sha256` text,`title` text,`original_name` text,`owner_id` integer,`sort_order` integer,`uploaded_by` integer,`created_at` datetime);
+CREATE INDEX `idx_media_files_owner_id` ON `media_files`(`owner_id`);
+CREATE INDEX `idx_media_files_thumb_key` ON `media_files`(`thumb_key`);
+CREATE UNIQUE INDEX `idx_media_files_key` ON `media_files`(`key`);
+CREATE INDEX `idx_media_files_category` ON `media_files`(`category`);
+
+-- record_attachments
+CREATE TABLE `record_attachments` (`id` integer PRIMARY KEY AUTOINCREMENT,`record_id` integer NOT NULL,`media_id` integer NOT NULL,`kind` text,`note` text,`uploaded_by` integer,`created_at` datetime);
+CREATE INDEX `idx_record_attachments_record_id` ON `record_attachments`(`record_id`);
+
+-- password_histories
+CREATE TABLE `password_histories` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`password_hash` text NOT NULL,`created_at` datetime);
+CREATE INDEX `idx_password_histories_user_id` ON `password_histories`(`user_id`);
+
+-- password_reset_tokens
+CREATE TABLE `password_reset_tokens` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`token_hash` text NOT NULL,`created_by` integer,`expires_at` datetime,`used_at` datetime,`created_at` datetime);
+CREATE UNIQUE INDEX `idx_password_reset_tokens_token_hash` ON `password_reset_tokens`(`token_hash`);
+CREATE INDEX `idx_password_reset_tokens_user_id` ON `password_reset_tokens`(`user_id`);
+
+-- recovery_codes
+CREATE TABLE `recovery_codes` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`code_hash` text NOT NULL,`used_at` datetime,`created_at` datetime);
+CREATE INDEX `idx_recovery_codes_user_id` ON `recovery_codes`(`user_id`);
+
+-- inventory_items
+CREATE TABLE `inventory_items` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text NOT NULL,`category` text,`price` real,`stock` integer,`description` text,`org_id` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime);
+CREATE INDEX `idx_inventory_items_deleted_at` ON `inventory_items`(`deleted_at`);
+
+-- patients
+CREATE TABLE `patients` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text,`phone` text,`id_card` text,`gender` text,`birth_date` datetime,`created_at` datetime);
+CREATE INDEX `idx_patients_id_card` ON `patients`(`id_card`);
+
+-- phone_verifications
+CREATE TABLE `phone_verifications` (`id` integer PRIMARY KEY AUTOINCREMENT,`phone` text NOT NULL,`purpose` text NOT NULL,`code_hash` text NOT NULL,`attempts` integer,`expires_at` datetime,`used_at` datetime,`created_at` datetime);
+CREATE INDEX `idx_phone_verifications_phone` ON `phone_verifications`(`phone`);
+
+-- bookings
+CREATE TABLE `bookings` (`id` integer PRIMARY KEY AUTOINCREMENT,`patient_name` text,`patient_id` integer,`age` integer,`gender` text,`department` text,`department_id` integer,`doctor_id` integer,`status` text,`created_at` datetime);
+CREATE INDEX `idx_bookings_department_id` ON `bookings`(`department_id`);
+
+-- medical_records
+CREATE TABLE `medical_records` (`id` integer PRIMARY KEY AUTOINCREMENT,`booking_id` integer,`diagnosis` text,`prescription` text,`created_at` datetime);
+
+-- lab_results
+CREATE TABLE `lab_results` (`id` integer PRIMARY KEY AUTOINCREMENT,`booking_id` integer,`item_name` text NOT NULL,`result` text,`unit` text,`reference_range` text,`abnormal` numeric,`doctor_id` integer,`created_at` datetime);
+CREATE INDEX `idx_lab_results_booking_id` ON `lab_results`(`booking_id`);
+
+-- orders
+CREATE TABLE `orders` (`id` integer PRIMARY KEY AUTOINCREMENT,`booking_id` integer,`total_amount` real,`status` text,`medicine_id` integer,`quantity` integer,`created_at` datetime,`updated_at` datetime);
+
+-- patient_allergies
+CREATE TABLE `patient_allergies` (`id` integer PRIMARY KEY AUTOINCREMENT,`patient_name` text NOT NULL,`allergen` text NOT NULL,`severity` text,`reaction` text,`recorded_by` integer,`created_at` datetime);
+CREATE INDEX `idx_patient_allergies_patient_name` ON `patient_allergies`(`patient_name`);
+
+-- drug_interaction_rules
+CREATE TABLE `drug_interaction_rules` (`id` integer PRIMARY KEY AUTOINCREMENT,`item_a` text NOT NULL,`item_b` text NOT NULL,`level` text NOT NULL,`description` text,`created_at` datetime);
+CREATE INDEX `idx_drug_interaction_rules_item_b` ON `drug_interaction_rules`(`item_b`);
+CREATE INDEX `idx_drug_interaction_rules_item_a` ON `drug_interaction_rules`(`item_a`);
+
+-- prescription_overrides
+CREATE TABLE `prescription_overrides` (`id` integer PRIMARY KEY AUTOINCREMENT,`medical_record_id` integer,`booking_id` integer,`doctor_id` integer,`medicine_id` integer,`warnings` text,`reason` text NOT NULL,`created_at` datetime);
+CREATE INDEX `idx_prescription_overrides_medical_record_id` ON `prescription_overrides`(`medical_record_id`);
+
+-- record_consents
+CREATE TABLE `record_consents` (`id` integer PRIMARY KEY AUTOINCREMENT,`patient_name` text NOT NULL,`department` text NOT NULL,`granted_by` integer,`expires_at` datetime,`revoked_at` datetime,`created_at` datetime);
+CREATE INDEX `idx_record_consents_patient_name` ON `record_consents`(`patient_name`);
+
+-- dependents
+CREATE TABLE `dependents` (`id` integer PRIMARY KEY AUTOINCREMENT,`guardian_id` integer NOT NULL,`patient_id` integer NOT NULL,`patient_name` text NOT NULL,`relationship` text NOT NULL,`consent_method` text NOT NULL,`expires_at` datetime,`revoked_at` datetime,`created_at` datetime);
+CREATE INDEX `idx_dependents_patient_name` ON `dependents`(`patient_name`);
+CREATE INDEX `idx_dependents_patient_id` ON `dependents`(`patient_id`);
+CREATE INDEX `idx_dependents_guardian_id` ON `dependents`(`guardian_id`);
+
+-- break_glass_grants
+CREATE TABLE `break_glass_grants` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer NOT NULL,`patient_name` text NOT NULL,`reason` text NOT NULL,`expires_at` datetime,`created_at` datetime);
+CREATE INDEX `idx_break_glass_grants_patient_name` ON `break_glass_grants`(`patient_name`);
+CREATE INDEX `idx_break_glass_grants_user_id` ON `break_glass_grants`(`user_id`);
+
+-- record_access_logs
+CREATE TABLE `record_access_logs` (`id` integer PRIMARY KEY AUTOINCREMENT,`user_id` integer,`role` text,`patient_name` text,`record_id` integer,`action` text,`basis` text,`reason` text,`ip` text,`created_at` datetime);
+CREATE INDEX `idx_record_access_logs_created_at` ON `record_access_logs`(`created_at`);
+CREATE INDEX `idx_record_access_logs_patient_name` ON `record_access_logs`(`patient_name`);
+CREATE INDEX `idx_record_access_logs_user_id` ON `record_access_logs`(`user_id`);
+
+-- audit_logs
+CREATE TABLE `audit_logs` (`id` integer PRIMARY KEY AUTOINCREMENT,`actor_id` integer,`actor_role` text,`org_id` integer,`ip` text,`action` text,`operation` text,`entity_type` text,`entity_id` text,`before` text,`after` text,`prev_hash` text,`hash` text,`created_at` datetime);
+CREATE INDEX `idx_audit_logs_created_at` ON `audit_logs`(`created_at`);
+CREATE UNIQUE INDEX `idx_audit_logs_hash` ON `audit_logs`(`hash`);
+CREATE INDEX `idx_audit_logs_entity_id` ON `audit_logs`(`entity_id`);
+CREATE INDEX `idx_audit_logs_entity_type` ON `audit_logs`(`entity_type`);
+CREATE INDEX `idx_audit_logs_operation` ON `audit_logs`(`operation`);
+CREATE INDEX `idx_audit_logs_org_id` ON `audit_logs`(`org_id`);
+CREATE INDEX `idx_audit_logs_actor_id` ON `audit_logs`(`actor_id`);
@@ -0,0 +1,5 @@
+-- 已匿名化的数据无法恢复，这里只恢复表结构
+
+DROP TABLE IF EXISTS `erasure_requests`;
+ALTER TABLE `bookings` DROP COLUMN `anonymized_at`;
+ALTER TABLE `patients` DROP COLUMN `anonymized_at`;
@@ -0,0 +1,8 @@
+-- 数据保留与患者数据删除：匿名化标记和删除申请表 (见 internal/privacy)
+
+ALTER TABLE `patients` ADD COLUMN `anonymized_at` datetime;
+ALTER TABLE `bookings` ADD COLUMN `anonymized_at` datetime;
+
+CREATE TABLE `erasure_requests` (`id` integer PRIMARY KEY AUTOINCREMENT,`patient_id` integer NOT NULL,`requested_by` integer NOT NULL,`reason` text,`status` text NOT NULL,`reviewed_by` integer,`review_note` text,`reviewed_at` datetime,`summary` text,`created_at` datetime,`updated_at` datetime);
+CREATE INDEX `idx_erasure_requests_status` ON `erasure_requests`(`status`);
+CREATE INDEX `idx_erasure_requests_patient_id` ON `erasure_requests`(`patient_id`);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS `idx_patient_allergies_patient_id`;
+ALTER TABLE `patient_allergies` DROP COLUMN `patient_id`;
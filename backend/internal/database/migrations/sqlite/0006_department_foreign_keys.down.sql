@@ -0,0 +1,21 @@
+-- 重建表去掉外键约束
+CREATE TABLE `users_new` (`id` integer PRIMARY KEY AUTOINCREMENT,`username` text NOT NULL,`password` text NOT NULL,`role` text NOT NULL,`org_id` integer,`department` text,`department_id` integer,`auth_source` text NOT NULL DEFAULT "local",`external_subject` text,`patient_id` integer,`enabled` numeric NOT NULL DEFAULT true,`failed_attempts` integer,`locked_until` datetime,`must_change_password` numeric,`password_changed_at` datetime,`token_version` integer NOT NULL DEFAULT 0,`totp_secret` text,`totp_enabled` numeric,`totp_last_step` integer,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,CONSTRAINT `uni_users_username` UNIQUE (`username`));
+INSERT INTO `users_new` (`id`,`username`,`password`,`role`,`org_id`,`department`,`department_id`,`auth_source`,`external_subject`,`patient_id`,`enabled`,`failed_attempts`,`locked_until`,`must_change_password`,`password_changed_at`,`token_version`,`totp_secret`,`totp_enabled`,`totp_last_step`,`created_at`,`updated_at`,`deleted_at`) SELECT `id`,`username`,`password`,`role`,`org_id`,`department`,`department_id`,`auth_source`,`external_subject`,`patient_id`,`enabled`,`failed_attempts`,`locked_until`,`must_change_password`,`password_changed_at`,`token_version`,`totp_secret`,`totp_enabled`,`totp_last_step`,`created_at`,`updated_at`,`deleted_at` FROM `users`;
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'users') WHERE `name` = 'users_new';
+DROP TABLE `users`;
+ALTER TABLE `users_new` RENAME TO `users`;
+CREATE INDEX `idx_users_deleted_at` ON `users`(`deleted_at`);
+CREATE UNIQUE INDEX `idx_users_patient_id` ON `users`(`patient_id`);
+CREATE UNIQUE INDEX `idx_users_external_subject` ON `users`(`external_subject`);
+CREATE INDEX `idx_users_department_id` ON `users`(`department_id`);
+
+CREATE TABLE `bookings_new` (`id` integer PRIMARY KEY AUTOINCREMENT,`patient_name` text,`patient_id` integer,`age` integer,`gender` text,`department` text,`department_id` integer,`doctor_id` integer,`status` text,`created_at` datetime,`anonymized_at` datetime);
+INSERT INTO `bookings_new` (`id`,`patient_name`,`patient_id`,`age`,`gender`,`department`,`department_id`,`doctor_id`,`status`,`created_at`,`anonymized_at`) SELECT `id`,`patient_name`,`patient_id`,`age`,`gender`,`department`,`department_id`,`doctor_id`,`status`,`created_at`,`anonymized_at` FROM `bookings`;
+UPDATE `sqlite_sequence` SET `seq` = (SELECT `seq` FROM `sqlite_sequence` WHERE `name` = 'bookings') WHERE `name` = 'bookings_new';
+DROP TABLE `bookings`;
+ALTER TABLE `bookings_new` RENAME TO `bookings`;
+CREATE INDEX `idx_bookings_department_id` ON `bookings`(`department_id`);
+CREATE INDEX `idx_bookings_patient_id` ON `bookings`(`patient_id`);
+
+DROP INDEX IF EXISTS `idx_record_consents_department_id`;
+ALTER TABLE `record_consents` DROP COLUMN `department_id`;
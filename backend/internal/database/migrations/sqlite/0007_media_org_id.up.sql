@@ -0,0 +1,9 @@
+-- 上传文件归属机构，机构管理员只能查看和管理本机构的文件
+-- 医生照片归医生所在机构，其余归上传者所在机构 (没有机构的归默认机构 1)
+ALTER TABLE `media_files` ADD COLUMN `org_id` integer NOT NULL DEFAULT 0;
+CREATE INDEX `idx_media_files_org_id` ON `media_files`(`org_id`);
+
+UPDATE `media_files` SET `org_id` = COALESCE(
+  (SELECT NULLIF(`org_id`, 0) FROM `users` WHERE `users`.`id` = `media_files`.`owner_id`),
+  (SELECT NULLIF(`org_id`, 0) FROM `users` WHERE `users`.`id` = `media_files`.`uploaded_by`),
+  1);
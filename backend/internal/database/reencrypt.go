@@ -0,0 +1,149 @@
+package database
+
+import (
+	"fmt"
+	"hospital-system/internal/fieldcrypt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// --- 敏感字段重新加密 ---
+// 找出明文 (启用加密之前写入的) 或不是当前密钥版本加密的值，解密后用当前密钥重新加密，并重算盲索引
+// 按主键分批处理，直接按表名更新，不经过模型钩子和审计 (字段内容没有变化)
+
+// encryptedTable 一张表中加密存储的列 (与模型中 serializer:encrypted 的字段一致)
+type encryptedTable struct {
+	table   string
+	columns []string
+	hashes  map[string]string // 列 -> 盲索引列
+}
+
+var encryptedTables = []encryptedTable{
+	{table: "patients", columns: []string{"phone", "id_card"}, hashes: map[string]string{"phone": "phone_hash", "id_card": "id_card_hash"}},
+	{table: "medical_records", columns: []string{"diagnosis"}},
+}
+
+// 每批处理的行数
+const reencryptBatch = 500
+
+// staleCondition 需要处理的行：all 为 false 时只找明文，为 true 时还包括旧版本密钥加密的值
+func staleCondition(t encryptedTable, all bool) (string, []interface{}) {
+	pattern := fieldcrypt.Prefix(0) + "%"
+	if all {
+		pattern = fieldcrypt.Prefix(fieldcrypt.Active()) + "%"
+	}
+	var conds []string
+	var args []interface{}
+	for _, col := range t.columns {
+		conds = append(conds, fmt.Sprintf("(%s <> '' AND %s NOT LIKE ?)", col, col))
+		args = append(args, pattern)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+// PendingReencrypt 需要重新加密的行数，all 的含义同 Reencrypt
+func PendingReencrypt(db *gorm.DB, all bool) (map[string]int64, error) {
+	counts := make(map[string]int64, len(encryptedTables))
+	for _, t := range encryptedTables {
+		cond, args := staleCondition(t, all)
+		var n int64
+		if err := db.Table(t.table).Where(cond, args...).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts[t.table] = n
+	}
+	return counts, nil
+}
+
+// Reencrypt 把需要处理的值用当前密钥重新加密，返回更新的行数
+// all 为 false 时只加密明文 (启动时自动执行)；为 true 时旧版本密钥加密的值也换成当前版本 (轮换密钥后执行)
+func Reencrypt(db *gorm.DB, all bool) (int, error) {
+	if fieldcrypt.Active() == 0 {
+		return 0, fieldcrypt.ErrNotLoaded
+	}
+	total := 0
+	for _, t := range encryptedTables {
+		n, err := reencryptTable(db, t, all)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", t.table, err)
+		}
+	}
+	return total, nil
+}
+
+func reencryptTable(db *gorm.DB, t encryptedTable, all bool) (int, error) {
+	cond, args := staleCondition(t, all)
+	selectCols := append([]string{"id"}, t.columns...)
+	updated := 0
+	var lastID uint64
+	for {
+		// 1. 取一批 (按主键向后翻，解密失败的行不会被反复读到)
+		var rows []map[string]interface{}
+		err := db.Table(t.table).Select(selectCols).
+			Where("id > ?", lastID).Where(cond, args...).
+			Order("id").Limit(reencryptBatch).Find(&rows).Error
+		if err != nil {
+			return updated, err
+		}
+		if len(rows) == 0 {
+			return updated, nil
+		}
+
+		// 2. 逐行解密、重新加密，一批一个事务
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				id, err := toUint(row["id"])
+				if err != nil {
+					return err
+				}
+				lastID = id
+				values := map[string]interface{}{}
+				for _, col := range t.columns {
+					stored := toString(row[col])
+					plain, err := fieldcrypt.Decrypt(stored, col)
+					if err != nil {
+						return fmt.Errorf("第 %d 行 %s: %w", id, col, err)
+					}
+					if values[col], err = fieldcrypt.Encrypt(plain, col); err != nil {
+						return err
+					}
+					if hash, ok := t.hashes[col]; ok {
+						values[hash] = fieldcrypt.BlindIndex(plain)
+					}
+				}
+				if err := tx.Table(t.table).Where("id = ?", id).Updates(values).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return updated, err
+		}
+		updated += len(rows)
+	}
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
+
+func toUint(v interface{}) (uint64, error) {
+	switch n := v.(type) {
+	case int64:
+		return uint64(n), nil
+	case int32:
+		return uint64(n), nil
+	case uint64:
+		return n, nil
+	}
+	return 0, fmt.Errorf("无法识别的主键类型 %T", v)
+}
@@ -0,0 +1,91 @@
+package database_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hospital-system/internal/database"
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// loadFieldKeys 重新加载密钥目录并设为全局密钥
+func loadFieldKeys(t *testing.T, dir string) {
+	t.Helper()
+	k, err := fieldcrypt.Load(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldcrypt.Use(k)
+}
+
+// 明文补加密，以及轮换密钥后把旧版本密文换成新版本
+func TestReencrypt(t *testing.T) {
+	t.Cleanup(func() { fieldcrypt.Use(nil) })
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		dir := t.TempDir()
+		if _, err := fieldcrypt.Generate(dir); err != nil {
+			t.Fatal(err)
+		}
+		loadFieldKeys(t, dir)
+		encrypted := model.Patient{Name: "张三", Phone: "13800138000", IDCard: "110101199003071234"}
+		if err := db.Create(&encrypted).Error; err != nil {
+			t.Fatal(err)
+		}
+		// 启用加密之前写入的明文 (没有盲索引)
+		if err := db.Exec("INSERT INTO patients (name, phone, id_card, phone_hash, id_card_hash, created_at) VALUES ('李四', '13900139000', '', '', '', CURRENT_TIMESTAMP)").Error; err != nil {
+			t.Fatal(err)
+		}
+		raw := func(name string) (phone, phoneHash string) {
+			t.Helper()
+			row := db.Table("patients").Select("phone, phone_hash").Where("name = ?", name).Row()
+			if err := row.Scan(&phone, &phoneHash); err != nil {
+				t.Fatal(err)
+			}
+			return phone, phoneHash
+		}
+
+		// 1. 只补加密明文
+		if n, err := database.Reencrypt(db, false); err != nil || n != 1 {
+			t.Fatalf("Reencrypt(false) = %d, %v，应处理 1 行", n, err)
+		}
+		if phone, hash := raw("李四"); !strings.HasPrefix(phone, fieldcrypt.Prefix(1)) || hash != fieldcrypt.BlindIndex("13900139000") {
+			t.Errorf("明文应已加密并补上盲索引: %s", phone)
+		}
+
+		// 2. 轮换到 v2，两行都是旧版本密文
+		if _, err := fieldcrypt.Generate(dir); err != nil {
+			t.Fatal(err)
+		}
+		loadFieldKeys(t, dir)
+		if counts, err := database.PendingReencrypt(db, true); err != nil || counts["patients"] != 2 {
+			t.Fatalf("PendingReencrypt = %v, %v", counts, err)
+		}
+		if n, err := database.Reencrypt(db, true); err != nil || n != 2 {
+			t.Fatalf("Reencrypt(true) = %d, %v，应处理 2 行", n, err)
+		}
+		if counts, _ := database.PendingReencrypt(db, true); counts["patients"] != 0 {
+			t.Errorf("重新加密后仍有 %d 行待处理", counts["patients"])
+		}
+		for _, name := range []string{"张三", "李四"} {
+			if phone, _ := raw(name); !strings.HasPrefix(phone, fieldcrypt.Prefix(2)) {
+				t.Errorf("%s 的手机号应使用 v2 加密: %s", name, phone)
+			}
+		}
+
+		// 3. 删除旧密钥后仍能读出
+		if err := os.Remove(filepath.Join(dir, "v1.key")); err != nil {
+			t.Fatal(err)
+		}
+		loadFieldKeys(t, dir)
+		var got model.Patient
+		if err := db.First(&got, encrypted.ID).Error; err != nil || got.IDCard != "110101199003071234" {
+			t.Errorf("删除旧密钥后读取: %q, %v", got.IDCard, err)
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package fieldcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// --- 敏感字段加密 ---
+// 身份证号、手机号、诊断等字段在写入数据库前用 AES-256-GCM 加密，存成 "enc:v<版本>:<base64(nonce+密文)>"
+// 密钥目录下 v<版本>.key 各是一把数据密钥 (32 字节，base64)，新数据用 active 版本加密，旧版本只用于解密；
+// 轮换: ./server encryption generate-key -> 重启 -> ./server encryption reencrypt 把旧数据重新加密 -> 删除旧密钥文件
+// 加密后不能再按原值查询，需要精确查找的字段另存一份盲索引 (HMAC-SHA256，密钥 blind-index.key，生成后不能更换)
+// 没有 enc: 前缀的值视为加密之前写入的明文，照常读出，由 reencrypt 补加密
+
+const (
+	prefix       = "enc:v"
+	keySize      = 32
+	blindKeyFile = "blind-index.key"
+)
+
+var (
+	ErrNoKeys     = errors.New("字段加密密钥目录中没有任何密钥")
+	ErrNotLoaded  = errors.New("字段加密密钥未加载")
+	ErrUnknownKey = errors.New("找不到加密该字段所用版本的密钥")
+)
+
+// Keyring 全部数据密钥和盲索引密钥
+type Keyring struct {
+	keys   map[int]cipher.AEAD
+	active int
+	blind  []byte
+}
+
+var current atomic.Pointer[Keyring]
+
+// Use 设置全局使用的密钥 (启动时调用一次)
+func Use(k *Keyring) {
+	current.Store(k)
+}
+
+// Active 当前用于加密的密钥版本，未加载时为 0
+func Active() int {
+	if k := current.Load(); k != nil {
+		return k.active
+	}
+	return 0
+}
+
+// Versions 已加载的密钥版本 (升序)
+func (k *Keyring) Versions() []int {
+	list := make([]int, 0, len(k.keys))
+	for v := range k.keys {
+		list = append(list, v)
+	}
+	sort.Ints(list)
+	return list
+}
+
+// Active 用于加密新数据的密钥版本
+func (k *Keyring) Active() int {
+	return k.active
+}
+
+// Load 读取密钥目录，activeVersion 为 0 时使用最大的版本
+func Load(dir string, activeVersion int) (*Keyring, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrNoKeys
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Keyring{keys: map[int]cipher.AEAD{}}
+	for _, e := range entries {
+		version, ok := parseKeyName(e.Name())
+		if e.IsDir() || !ok {
+			continue
+		}
+		raw, err := readKeyFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %s: %w", e.Name(), err)
+		}
+		block, _ := aes.NewCipher(raw)
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[version] = gcm
+		if activeVersion == 0 && version > k.active {
+			k.active = version
+		}
+	}
+	if len(k.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	if activeVersion != 0 {
+		if _, ok := k.keys[activeVersion]; !ok {
+			return nil, fmt.Errorf("active_version %d 的密钥不存在", activeVersion)
+		}
+		k.active = activeVersion
+	}
+
+	k.blind, err = readKeyFile(filepath.Join(dir, blindKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("盲索引密钥 %s: %w", blindKeyFile, err)
+	}
+	return k, nil
+}
+
+// parseKeyName 解析 v3.key
+func parseKeyName(name string) (int, bool) {
+	num, ok := strings.CutPrefix(name, "v")
+	if !ok {
+		return 0, false
+	}
+	num, ok = strings.CutSuffix(num, ".key")
+	if !ok {
+		return 0, false
+	}
+	version, err := strconv.Atoi(num)
+	return version, err == nil && version > 0
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(raw) != keySize {
+		return nil, fmt.Errorf("密钥必须是 %d 字节的 base64", keySize)
+	}
+	return raw, nil
+}
+
+func writeKeyFile(path string) error {
+	raw := make([]byte, keySize)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	// O_EXCL: 不覆盖已有密钥
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(base64.StdEncoding.EncodeToString(raw) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Generate 生成下一个版本的数据密钥 (盲索引密钥不存在时一并生成)，返回新版本号
+// 默认配置下新生成的密钥重启后自动用于加密
+func Generate(dir string) (int, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return 0, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	next := 1
+	for _, e := range entries {
+		if v, ok := parseKeyName(e.Name()); ok && v >= next {
+			next = v + 1
+		}
+	}
+
+	blindPath := filepath.Join(dir, blindKeyFile)
+	if _, err := os.Stat(blindPath); os.IsNotExist(err) {
+		if err := writeKeyFile(blindPath); err != nil {
+			return 0, err
+		}
+	}
+	if err := writeKeyFile(filepath.Join(dir, fmt.Sprintf("v%d.key", next))); err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
+// Encrypt 用当前版本的密钥加密，空字符串不加密；aad 为列名，防止密文被挪到其他字段
+func Encrypt(plain, aad string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	k := current.Load()
+	if k == nil {
+		return "", ErrNotLoaded
+	}
+	gcm := k.keys[k.active]
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), []byte(aad))
+	return prefix + strconv.Itoa(k.active) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密；不是密文 (加密之前写入的明文) 时原样返回
+func Decrypt(stored, aad string) (string, error) {
+	version, body, ok := parse(stored)
+	if !ok {
+		return stored, nil
+	}
+	k := current.Load()
+	if k == nil {
+		return "", ErrNotLoaded
+	}
+	gcm, found := k.keys[version]
+	if !found {
+		return "", fmt.Errorf("%w (v%d)", ErrUnknownKey, version)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(body)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errors.New("密文格式错误")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(aad))
+	if err != nil {
+		return "", errors.New("解密失败，密钥不匹配或数据被篡改")
+	}
+	return string(plain), nil
+}
+
+// Prefix 某个密钥版本的密文前缀，用于在 SQL 中找出需要重新加密的行；version 为 0 时是所有密文共同的前缀
+func Prefix(version int) string {
+	if version == 0 {
+		return prefix
+	}
+	return prefix + strconv.Itoa(version) + ":"
+}
+
+func parse(stored string) (version int, body string, ok bool) {
+	rest, found := strings.CutPrefix(stored, prefix)
+	if !found {
+		return 0, "", false
+	}
+	num, body, found := strings.Cut(rest, ":")
+	if !found {
+		return 0, "", false
+	}
+	version, err := strconv.Atoi(num)
+	if err != nil {
+		return 0, "", false
+	}
+	return version, body, true
+}
+
+// BlindIndex 盲索引：去掉首尾空格、转大写后计算 HMAC-SHA256，空字符串返回空
+// 未加载密钥时返回空字符串 (调用方按 "查不到" 处理)
+func BlindIndex(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	k := current.Load()
+	if value == "" || k == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.blind)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,123 @@
+package fieldcrypt
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useKeys 在临时目录生成一把密钥并设为全局密钥，测试结束后恢复为未加载
+func useKeys(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := Generate(dir); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, dir, 0)
+	t.Cleanup(func() { current.Store(nil) })
+	return dir
+}
+
+func reload(t *testing.T, dir string, active int) *Keyring {
+	t.Helper()
+	k, err := Load(dir, active)
+	if err != nil {
+		t.Fatalf("加载密钥失败: %v", err)
+	}
+	Use(k)
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	useKeys(t)
+
+	stored, err := Encrypt("110101199003071234", "id_card")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, Prefix(1)) || strings.Contains(stored, "110101199003071234") {
+		t.Fatalf("密文格式不对: %s", stored)
+	}
+	if again, _ := Encrypt("110101199003071234", "id_card"); again == stored {
+		t.Error("相同明文两次加密的结果应不同 (随机 nonce)")
+	}
+	if plain, err := Decrypt(stored, "id_card"); err != nil || plain != "110101199003071234" {
+		t.Errorf("Decrypt = %q, %v", plain, err)
+	}
+
+	// 密文挪到其他列 (aad 不同) 时解密失败
+	if _, err := Decrypt(stored, "phone"); err == nil {
+		t.Error("用其他列名解密应失败")
+	}
+	// 篡改密文
+	tampered := []byte(stored)
+	tampered[len(tampered)-3] ^= 1 // 改动密文中的一个字符
+	if _, err := Decrypt(string(tampered), "id_card"); err == nil {
+		t.Error("篡改后的密文解密应失败")
+	}
+	// 空字符串不加密，加密之前写入的明文原样读出
+	if s, _ := Encrypt("", "phone"); s != "" {
+		t.Errorf("空字符串加密后 = %q", s)
+	}
+	if s, err := Decrypt("13800138000", "phone"); err != nil || s != "13800138000" {
+		t.Errorf("明文 Decrypt = %q, %v", s, err)
+	}
+}
+
+func TestNotLoaded(t *testing.T) {
+	current.Store(nil)
+	if _, err := Encrypt("x", "phone"); !errors.Is(err, ErrNotLoaded) {
+		t.Errorf("未加载密钥时 Encrypt 错误 = %v", err)
+	}
+	if BlindIndex("x") != "" {
+		t.Error("未加载密钥时盲索引应为空")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := useKeys(t)
+	old, _ := Encrypt("13800138000", "phone")
+	oldIndex := BlindIndex("13800138000")
+
+	// 生成 v2 并重新加载：新数据用 v2，旧数据仍能用 v1 解密
+	if v, err := Generate(dir); err != nil || v != 2 {
+		t.Fatalf("Generate = %d, %v", v, err)
+	}
+	k := reload(t, dir, 0)
+	if k.Active() != 2 || Active() != 2 || len(k.Versions()) != 2 {
+		t.Fatalf("active = %d，版本 %v", k.Active(), k.Versions())
+	}
+	if s, _ := Encrypt("13800138000", "phone"); !strings.HasPrefix(s, Prefix(2)) {
+		t.Errorf("新数据应使用 v2 加密: %s", s)
+	}
+	if plain, err := Decrypt(old, "phone"); err != nil || plain != "13800138000" {
+		t.Errorf("v1 密文 Decrypt = %q, %v", plain, err)
+	}
+	// 盲索引密钥不随轮换变化
+	if BlindIndex("13800138000") != oldIndex {
+		t.Error("轮换后盲索引应保持不变")
+	}
+	// 盲索引忽略首尾空格和大小写 (身份证号末位 x)
+	if BlindIndex(" 11010119900307123x ") != BlindIndex("11010119900307123X") {
+		t.Error("盲索引应忽略首尾空格和大小写")
+	}
+
+	// 指定 active_version
+	if k := reload(t, dir, 1); k.Active() != 1 {
+		t.Errorf("active = %d，应为 1", k.Active())
+	}
+	if _, err := Load(dir, 3); err == nil {
+		t.Error("不存在的 active_version 应加载失败")
+	}
+
+	// 删除旧密钥后，还没重新加密的旧数据无法解密
+	if err := os.Remove(filepath.Join(dir, "v1.key")); err != nil {
+		t.Fatal(err)
+	}
+	reload(t, dir, 0)
+	if _, err := Decrypt(old, "phone"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("err = %v，应为 ErrUnknownKey", err)
+	}
+}
@@ -0,0 +1,27 @@
+package fieldcrypt
+
+import "strings"
+
+// --- 脱敏显示 ---
+// 不需要完整信息的角色只看到首尾几位，例如 110***********1234、138****5678
+
+// MaskIDCard 身份证号保留前 3 位和后 4 位
+func MaskIDCard(s string) string {
+	return mask(s, 3, 4)
+}
+
+// MaskPhone 手机号保留前 3 位和后 4 位
+func MaskPhone(s string) string {
+	return mask(s, 3, 4)
+}
+
+func mask(s string, head, tail int) string {
+	r := []rune(s)
+	if len(r) == 0 {
+		return s
+	}
+	if len(r) <= head+tail {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:head]) + strings.Repeat("*", len(r)-head-tail) + string(r[len(r)-tail:])
+}
@@ -0,0 +1,48 @@
+package fieldcrypt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// GORM 序列化器：字段加上 `gorm:"serializer:encrypted"` 后读写时自动解密/加密
+// 只支持 string 字段。注意 Where("col = ?", 明文) 不会经过序列化器，精确查找要用盲索引列
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+}
+
+// Serializer 加密字段的序列化器
+type Serializer struct{}
+
+// Scan 从数据库读出时解密
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("加密字段 %s 的类型不支持: %T", field.DBName, dbValue)
+	}
+
+	plain, err := Decrypt(stored, field.DBName)
+	if err != nil {
+		return fmt.Errorf("字段 %s: %w", field.DBName, err)
+	}
+	return field.Set(ctx, dst, plain)
+}
+
+// Value 写入数据库前加密
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plain, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("加密字段 %s 必须是 string", field.DBName)
+	}
+	return Encrypt(plain, field.DBName)
+}
@@ -0,0 +1,67 @@
+package idcard
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// --- 居民身份证号码校验 (GB 11643-1999) ---
+// 18 位：6 位地址码 + 8 位出生日期 + 3 位顺序码 (奇数男、偶数女) + 1 位校验码
+
+// Info 从身份证号中解析出的信息
+type Info struct {
+	Number    string    // 规范化后的号码 (末位 X 大写)
+	Region    string    // 地址码
+	BirthDate time.Time // 出生日期
+	Gender    string    // 男 / 女
+}
+
+var (
+	ErrLength   = errors.New("身份证号码应为 18 位")
+	ErrFormat   = errors.New("身份证号码格式错误")
+	ErrBirth    = errors.New("身份证号码中的出生日期无效")
+	ErrChecksum = errors.New("身份证号码校验位错误")
+)
+
+// 前 17 位的加权因子
+var weights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+// 加权和模 11 后对应的校验码
+const checkCodes = "10X98765432"
+
+// Parse 校验身份证号并解析出生日期和性别
+func Parse(number string) (Info, error) {
+	number = strings.ToUpper(strings.TrimSpace(number))
+	if len(number) != 18 {
+		return Info{}, ErrLength
+	}
+
+	sum := 0
+	for i := 0; i < 17; i++ {
+		ch := number[i]
+		if ch < '0' || ch > '9' {
+			return Info{}, ErrFormat
+		}
+		sum += int(ch-'0') * weights[i]
+	}
+	last := number[17]
+	if (last < '0' || last > '9') && last != 'X' {
+		return Info{}, ErrFormat
+	}
+
+	birth, err := time.ParseInLocation("20060102", number[6:14], time.Local)
+	if err != nil || birth.After(time.Now()) || birth.Year() < 1900 {
+		return Info{}, ErrBirth
+	}
+
+	if checkCodes[sum%11] != last {
+		return Info{}, ErrChecksum
+	}
+
+	gender := "女"
+	if (number[16]-'0')%2 == 1 {
+		gender = "男"
+	}
+	return Info{Number: number, Region: number[:6], BirthDate: birth, Gender: gender}, nil
+}
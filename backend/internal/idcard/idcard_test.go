@@ -0,0 +1,55 @@
+package idcard
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		number string
+		birth  string
+		gender string
+	}{
+		{"11010519491231002X", "11010519491231002X", "1949-12-31", "女"},
+		{" 11010519491231002x ", "11010519491231002X", "1949-12-31", "女"}, // 末位小写、首尾空格
+		{"440304199001010011", "440304199001010011", "1990-01-01", "男"},
+		{"320106200002290035", "320106200002290035", "2000-02-29", "男"}, // 闰年 2 月 29 日
+	}
+	for _, tt := range tests {
+		info, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if info.Number != tt.number || info.Region != tt.number[:6] ||
+			info.BirthDate.Format(time.DateOnly) != tt.birth || info.Gender != tt.gender {
+			t.Errorf("Parse(%q) = %+v", tt.input, info)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"", ErrLength},
+		{"11010519491231002", ErrLength},    // 17 位
+		{"110105491231002", ErrLength},      // 旧的 15 位号码
+		{"1101051949123A002X", ErrFormat},   // 前 17 位有字母
+		{"11010519491231002Y", ErrFormat},   // 末位只能是数字或 X
+		{"320106200102290035", ErrBirth},    // 2001 年没有 2 月 29 日
+		{"110105194913310020", ErrBirth},    // 13 月
+		{"310115209912310010", ErrBirth},    // 未来的日期
+		{"110105189912310020", ErrBirth},    // 1900 年以前
+		{"110101199003071234", ErrChecksum}, // 校验位应为 3
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.input); !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q) 错误 = %v，应为 %v", tt.input, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// --- 日志级别 ---
+// 由 config.yaml 的 log.level 控制，热加载后立即生效：
+//   debug  全部输出，另外打印每条 SQL
+//   info   默认：普通日志、请求日志、警告和错误
+//   warn   只输出警告和错误 (以及慢 SQL)
+//   error  只输出错误
+// 普通日志仍然用标准库 log.Printf (按 info 级别)，失败和需要注意的情况用 Warnf / Errorf
+
+// 级别名称
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levels = map[string]slog.Level{
+	LevelDebug: slog.LevelDebug,
+	LevelInfo:  slog.LevelInfo,
+	LevelWarn:  slog.LevelWarn,
+	LevelError: slog.LevelError,
+}
+
+// current 当前级别，默认 info
+var current atomic.Int64
+
+// out 警告、错误和调试日志直接写到标准错误，不经过 info 级别的过滤
+var out = log.New(os.Stderr, "", log.LstdFlags)
+
+// Valid 是否为支持的级别名称
+func Valid(name string) bool {
+	_, ok := levels[strings.ToLower(name)]
+	return ok
+}
+
+// Init 按 info 级别过滤标准库 log 的输出，并设置初始级别 (启动时调用一次)
+func Init(name string) error {
+	log.SetOutput(infoWriter{w: os.Stderr})
+	return SetLevel(name)
+}
+
+// SetLevel 修改当前级别 (热加载时调用)
+func SetLevel(name string) error {
+	l, ok := levels[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("不支持的日志级别: %q", name)
+	}
+	current.Store(int64(l))
+	return nil
+}
+
+// Enabled 某个级别的日志当前是否输出
+func Enabled(l slog.Level) bool {
+	return l >= slog.Level(current.Load())
+}
+
+// Debugf 调试日志
+func Debugf(format string, args ...any) {
+	if Enabled(slog.LevelDebug) {
+		out.Output(2, "[DEBUG] "+fmt.Sprintf(format, args...))
+	}
+}
+
+// Warnf 出了问题但不影响主要流程 (例如删除旧文件失败)
+func Warnf(format string, args ...any) {
+	if Enabled(slog.LevelWarn) {
+		out.Output(2, "[WARN] "+fmt.Sprintf(format, args...))
+	}
+}
+
+// Errorf 操作失败，需要人工处理 (例如备份失败)
+func Errorf(format string, args ...any) {
+	if Enabled(slog.LevelError) {
+		out.Output(2, "[ERROR] "+fmt.Sprintf(format, args...))
+	}
+}
+
+// infoWriter 标准库 log 的输出按 info 级别过滤
+type infoWriter struct{ w io.Writer }
+
+func (iw infoWriter) Write(p []byte) (int, error) {
+	if !Enabled(slog.LevelInfo) {
+		return len(p), nil
+	}
+	return iw.w.Write(p)
+}
+
+// --- SQL 日志 ---
+
+// 慢 SQL 的阈值 (与 GORM 默认值相同)
+const slowSQL = 200 * time.Millisecond
+
+var (
+	sqlDebug = newSQLLogger(logger.Info)  // 每条 SQL
+	sqlWarn  = newSQLLogger(logger.Warn)  // 慢 SQL 和错误
+	sqlError = newSQLLogger(logger.Error) // 只有错误
+)
+
+func newSQLLogger(level logger.LogLevel) logger.Interface {
+	return logger.New(out, logger.Config{SlowThreshold: slowSQL, LogLevel: level, Colorful: false})
+}
+
+// SQL GORM 使用的日志，按当前级别决定输出哪些 SQL
+func SQL() logger.Interface {
+	return sqlLogger{}
+}
+
+type sqlLogger struct{}
+
+func (sqlLogger) pick() logger.Interface {
+	switch {
+	case Enabled(slog.LevelDebug):
+		return sqlDebug
+	case Enabled(slog.LevelWarn):
+		return sqlWarn
+	default:
+		return sqlError
+	}
+}
+
+// LogMode 级别只由 log.level 控制
+func (l sqlLogger) LogMode(logger.LogLevel) logger.Interface { return l }
+
+func (l sqlLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.pick().Info(ctx, msg, args...)
+}
+
+func (l sqlLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.pick().Warn(ctx, msg, args...)
+}
+
+func (l sqlLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.pick().Error(ctx, msg, args...)
+}
+
+func (l sqlLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.pick().Trace(ctx, begin, fc, err)
+}
@@ -0,0 +1,148 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// --- 上传文件识别与缩略图 ---
+// 文件类型只看内容 (http.DetectContentType)，不信任客户端传来的 Content-Type 和扩展名
+// 缩略图用标准库解码后按区域平均缩小，不依赖 cgo 或第三方图像库
+
+// 图片类型
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeGIF  = "image/gif"
+	TypePDF  = "application/pdf"
+)
+
+// 文件扩展名
+var extensions = map[string]string{
+	TypeJPEG: ".jpg",
+	TypePNG:  ".png",
+	TypeGIF:  ".gif",
+	TypePDF:  ".pdf",
+}
+
+// 单边像素上限和总像素上限 (防止解压炸弹：几 KB 的文件声明几万像素的尺寸)
+const (
+	maxSide   = 10000
+	maxPixels = 40_000_000
+)
+
+var (
+	ErrUnsupported = errors.New("不支持的文件类型")
+	ErrTooLarge    = errors.New("图片尺寸过大")
+	ErrCorrupt     = errors.New("图片已损坏或无法解析")
+)
+
+// Sniff 根据文件头判断类型
+func Sniff(data []byte) string {
+	ct := http.DetectContentType(data)
+	if i := bytes.IndexByte([]byte(ct), ';'); i >= 0 {
+		ct = ct[:i]
+	}
+	return ct
+}
+
+// Extension 类型对应的扩展名，不支持的类型返回空字符串
+func Extension(contentType string) string {
+	return extensions[contentType]
+}
+
+// IsImage 是否为支持的图片类型
+func IsImage(contentType string) bool {
+	return contentType == TypeJPEG || contentType == TypePNG || contentType == TypeGIF
+}
+
+// Inspect 读取图片尺寸 (只解析文件头)，顺便检查尺寸上限
+func Inspect(data []byte) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, ErrCorrupt
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return 0, 0, ErrCorrupt
+	}
+	if cfg.Width > maxSide || cfg.Height > maxSide || cfg.Width*cfg.Height > maxPixels {
+		return 0, 0, ErrTooLarge
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Thumbnail 生成长边不超过 maxDim 的缩略图 (本来就小的图片原样重新编码)
+// 返回编码后的内容和类型：PNG / GIF 输出 PNG 以保留透明度，其余输出 JPEG
+func Thumbnail(data []byte, maxDim int) ([]byte, string, error) {
+	if _, _, err := Inspect(data); err != nil {
+		return nil, "", err
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrCorrupt
+	}
+
+	dst := scaleDown(src, maxDim)
+
+	var buf bytes.Buffer
+	if format == "png" || format == "gif" {
+		err = png.Encode(&buf, dst)
+		return buf.Bytes(), TypePNG, err
+	}
+	err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 82})
+	return buf.Bytes(), TypeJPEG, err
+}
+
+// scaleDown 区域平均缩小：每个目标像素取对应源区域内所有像素的平均值
+func scaleDown(src image.Image, maxDim int) *image.RGBA {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// 先统一转成 RGBA，标准库对 YCbCr、Paletted 等常见类型有快速路径
+	rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if w >= h && w > maxDim {
+		dw, dh = maxDim, max(1, h*maxDim/w)
+	} else if h > w && h > maxDim {
+		dw, dh = max(1, w*maxDim/h), maxDim
+	}
+	if dw == w && dh == h {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				off := sy*rgba.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					p := rgba.Pix[off : off+4 : off+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					bl += uint64(p[2])
+					a += uint64(p[3])
+					n++
+					off += 4
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(bl / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"hospital-system/internal/fieldcrypt"
+	"reflect"
 	"strings"
 	"time"
 
@@ -10,15 +12,98 @@ import (
 
 // User 用户表
 type User struct {
-	ID         uint           `gorm:"primaryKey" json:"id"`
-	Username   string         `gorm:"unique;not null" json:"username"`
-	Password   string         `gorm:"not null" json:"-"`    // 不参与 JSON 序列化
-	Role       string         `gorm:"not null" json:"role"` // global_admin, org_admin, finance, storekeeper, registration, general_user
-	OrgID      uint           `json:"org_id"`               // 所属机构ID
-	Department string         `json:"department"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	Username   string `gorm:"unique;not null" json:"username"`
+	Password   string `gorm:"not null" json:"-"`    // 不参与 JSON 序列化
+	Role       string `gorm:"not null" json:"role"` // global_admin, org_admin, finance, storekeeper, registration, general_user
+	OrgID      uint   `json:"org_id"`               // 所属机构ID
+	Department string `json:"department"`           // 科室名称 (与 DepartmentID 对应的科室保持一致)
+
+	DepartmentID  *uint       `gorm:"index" json:"department_id"`
+	DepartmentRef *Department `gorm:"foreignKey:DepartmentID" json:"-"` // 外键约束 (科室删除前须先转走账号)
+
+	// 账号来源: local 本地账号密码；oidc 统一身份认证 (密码与两步验证由身份提供方负责)
+	AuthSource      string  `gorm:"not null;default:local" json:"auth_source"`
+	ExternalSubject *string `gorm:"uniqueIndex" json:"-"` // 身份提供方中的唯一标识 (issuer#sub)
+
+	// 实名信息：患者账号关联的患者档案
+	PatientID *uint `gorm:"uniqueIndex" json:"patient_id"`
+
+	Enabled bool `gorm:"not null;default:true" json:"enabled"` // 停用后不能登录，已登录的 Token 立即失效
+
+	// 凭据安全
+	FailedAttempts     int        `json:"-"`                    // 连续登录失败次数
+	LockedUntil        *time.Time `json:"locked_until"`         // 锁定截止时间
+	MustChangePassword bool       `json:"must_change_password"` // 下次登录必须修改密码
+	PasswordChangedAt  *time.Time `json:"password_changed_at"`
+	TokenVersion       uint       `gorm:"not null;default:0" json:"-"` // 修改密码后递增，旧 Token 全部失效
+
+	// 两步验证 (TOTP)
+	TOTPSecret   string `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabled  bool   `gorm:"column:totp_enabled" json:"totp_enabled"`
+	TOTPLastStep int64  `gorm:"column:totp_last_step" json:"-"` // 最近一次使用的时间窗，防止验证码重放
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// 账号来源
+const (
+	AuthSourceLocal = "local"
+	AuthSourceOIDC  = "oidc"
+)
+
+// IsLocal 是否本地账号 (老数据该字段为空，同样视为本地账号)
+func (u *User) IsLocal() bool {
+	return u.AuthSource == "" || u.AuthSource == AuthSourceLocal
+}
+
+// Department 科室 (同一机构内编码唯一，可以有上级科室)
+type Department struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	OrgID     uint      `gorm:"not null;uniqueIndex:idx_department_org_code" json:"org_id"`
+	Code      string    `gorm:"not null;uniqueIndex:idx_department_org_code" json:"code"`
+	Name      string    `gorm:"not null;index" json:"name"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	HeadID    *uint     `json:"head_id"` // 科室主任 (医生账号)
+	Active    bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DoctorProfile 医生执业信息 (公开医生目录展示用，一个医生账号一条)
+type DoctorProfile struct {
+	UserID          uint      `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Name            string    `gorm:"not null" json:"name"`                  // 真实姓名
+	Title           string    `json:"title"`                                 // 职称: 主任医师、副主任医师...
+	Specialties     []string  `gorm:"serializer:json" json:"specialties"`    // 擅长领域
+	Bio             string    `json:"bio"`                                   // 简介
+	PhotoURL        string    `json:"photo_url"`                             // 照片地址
+	ConsultationFee float64   `json:"consultation_fee"`                      // 挂号费
+	AvailableDays   []int     `gorm:"serializer:json" json:"available_days"` // 出诊日: 0 周日 ... 6 周六
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// MediaFile 上传的文件 (医院图片、医生照片、病历附件)
+// 文件内容在存储后端 (本地目录或对象存储)，这里只记录元数据
+type MediaFile struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Category     string    `gorm:"not null;index" json:"category"` // hospital, doctor, record
+	Key          string    `gorm:"not null;uniqueIndex" json:"key"`
+	ThumbKey     string    `gorm:"index" json:"thumb_key"` // 缩略图，非图片为空
+	ContentType  string    `json:"content_type"`           // 按文件内容识别的类型
+	Size         int64     `json:"size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	SHA256       string    `gorm:"column:sha256" json:"sha256"`
+	Title        string    `json:"title"`
+	OriginalName string    `json:"original_name"`
+	OwnerID      *uint     `gorm:"index" json:"owner_id"`                  // 医生照片对应的医生账号
+	OrgID        uint      `gorm:"index;not null;default:0" json:"org_id"` // 所属机构：医生照片为医生所在机构，其余为上传者所在机构
+	SortOrder    int       `json:"sort_order"`
+	UploadedBy   uint      `json:"uploaded_by"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 // InventoryItem 物资表
@@ -35,36 +120,85 @@ type InventoryItem struct {
 	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
 }
 
-// Patient 患者表
+// Patient 患者表 (前台建档或患者自助注册时创建)
+// 手机号、身份证号加密存储，按原值查找时用对应的盲索引列 (fieldcrypt.BlindIndex)
 type Patient struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `json:"name"`
-	Phone     string    `json:"phone"`
-	IDCard    string    `json:"id_card"`
-	CreatedAt time.Time `json:"created_at"`
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	Name       string     `json:"name"`
+	Phone      string     `gorm:"serializer:encrypted" json:"phone"`
+	PhoneHash  string     `gorm:"index" json:"-"`
+	IDCard     string     `gorm:"serializer:encrypted" json:"id_card"`
+	IDCardHash string     `gorm:"index" json:"-"`
+	Gender     string     `json:"gender"`
+	BirthDate  *time.Time `json:"birth_date"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	AnonymizedAt *time.Time `json:"anonymized_at"` // 超过保留期限或患者申请删除后匿名化的时间
+}
+
+// PhoneVerification 手机验证码 (只保存哈希)
+type PhoneVerification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Phone     string     `gorm:"index;not null" json:"phone"`
+	Purpose   string     `gorm:"not null" json:"purpose"` // register ...
+	CodeHash  string     `gorm:"not null" json:"-"`
+	Attempts  int        `json:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 // Booking 挂号记录
 type Booking struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	PatientName string    `json:"patient_name"` // 新增：直接存名字
-	Age         int       `json:"age"`          // 新增：年龄
-	Gender      string    `json:"gender"`       // 新增：性别
-	Department  string    `json:"department"`   // 新增：科室
-	DoctorID    uint      `json:"doctor_id"`    // 关联医生
-	Status      string    `json:"status"`       // Pending, Completed
-	CreatedAt   time.Time `json:"created_at"`
+	ID            uint        `gorm:"primaryKey" json:"id"`
+	PatientName   string      `json:"patient_name"`            // 新增：直接存名字
+	PatientID     *uint       `gorm:"index" json:"patient_id"` // 患者档案 (前台未建档的急诊等情况为空)
+	Age           int         `json:"age"`                     // 新增：年龄
+	Gender        string      `json:"gender"`                  // 新增：性别
+	Department    string      `json:"department"`              // 新增：科室
+	DepartmentID  *uint       `gorm:"index" json:"department_id"`
+	DepartmentRef *Department `gorm:"foreignKey:DepartmentID" json:"-"` // 外键约束
+	DoctorID      uint        `json:"doctor_id"`                        // 关联医生
+	Status        string      `json:"status"`                           // Pending, Completed
+	CreatedAt     time.Time   `json:"created_at"`
+
+	AnonymizedAt *time.Time `json:"anonymized_at"` // 匿名化后患者姓名、病历文本已清除，科室、医生、日期保留用于统计
 }
 
 // MedicalRecord 电子病历
 type MedicalRecord struct {
 	ID           uint      `gorm:"primaryKey" json:"id"`
 	BookingID    uint      `json:"booking_id"`
-	Diagnosis    string    `json:"diagnosis"`    // 诊断结果
-	Prescription string    `json:"prescription"` // 处方内容 (简化为字符串)
+	Diagnosis    string    `gorm:"serializer:encrypted" json:"diagnosis"` // 诊断结果 (加密存储)
+	Prescription string    `json:"prescription"`                          // 处方内容 (简化为字符串)
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// RecordAttachment 病历附件 (外院报告扫描件、影像图片、签字的知情同意书等)
+// 文件本身是一条 category = record 的 MediaFile，访问权限与所属病历相同
+type RecordAttachment struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	RecordID   uint      `gorm:"not null;index" json:"record_id"`
+	MediaID    uint      `gorm:"not null" json:"media_id"`
+	Kind       string    `json:"kind"` // report, image, consent, other
+	Note       string    `json:"note"`
+	UploadedBy uint      `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// LabResult 检验结果
+type LabResult struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	BookingID      uint      `gorm:"index" json:"booking_id"`
+	ItemName       string    `gorm:"not null" json:"item_name"` // 检验项目，例如 "血常规-白细胞"
+	Result         string    `json:"result"`                    // 检验结果数值或描述
+	Unit           string    `json:"unit"`
+	ReferenceRange string    `json:"reference_range"` // 参考范围
+	Abnormal       bool      `json:"abnormal"`        // 是否异常
+	DoctorID       uint      `json:"doctor_id"`       // 录入医生
+	CreatedAt      time.Time `json:"created_at"`
+}
+
 // Order 缴费订单
 type Order struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
@@ -77,21 +211,254 @@ type Order struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
-// GeneratePassword 给密码加密
-func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
-	// 增加一层保护：如果密码看起来已经是 bcrypt 哈希（以 $2a$ 开头），则跳过
-	if strings.HasPrefix(u.Password, "$2a$") {
+// PasswordHistory 历史密码 (防止重复使用最近用过的密码)
+type PasswordHistory struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"index;not null" json:"user_id"`
+	PasswordHash string    `gorm:"not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// PasswordResetToken 管理员发起的一次性重置密码凭证 (只保存哈希)
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	TokenHash string     `gorm:"uniqueIndex;not null" json:"-"`
+	CreatedBy uint       `json:"created_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RecoveryCode 两步验证恢复码 (手机丢失时使用，每个只能用一次)
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index;not null" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PatientAllergy 患者过敏史
+type PatientAllergy struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	PatientID   uint      `gorm:"index;not null;default:0" json:"patient_id"` // 患者档案
+	PatientName string    `gorm:"index;not null" json:"patient_name"`         // 登记时的患者姓名 (仅用于展示)
+	Allergen    string    `gorm:"not null" json:"allergen"`                   // 过敏原：药品名或药品分类，例如 "青霉素"、"头孢类"
+	Severity    string    `json:"severity"`                                   // mild, moderate, severe (severe 直接禁止开药)
+	Reaction    string    `json:"reaction"`                                   // 过敏反应描述
+	RecordedBy  uint      `json:"recorded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DrugInteractionRule 药物相互作用/配伍禁忌规则
+type DrugInteractionRule struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	ItemA       string    `gorm:"index;not null" json:"item_a"` // 药品名或药品分类
+	ItemB       string    `gorm:"index;not null" json:"item_b"`
+	Level       string    `gorm:"not null" json:"level"` // block (禁止), warn (警告，可填写理由后继续)
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PrescriptionOverride 医生忽略警告开药的记录
+type PrescriptionOverride struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	MedicalRecordID uint      `gorm:"index" json:"medical_record_id"`
+	BookingID       uint      `json:"booking_id"`
+	DoctorID        uint      `json:"doctor_id"`
+	MedicineID      uint      `json:"medicine_id"`
+	Warnings        string    `json:"warnings"` // 被忽略的警告内容
+	Reason          string    `gorm:"not null" json:"reason"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// RecordConsent 患者授权某科室的医生查看自己的病历
+type RecordConsent struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	PatientID    uint       `gorm:"index;not null;default:0" json:"patient_id"` // 授权的患者档案
+	PatientName  string     `gorm:"index;not null" json:"patient_name"`         // 授权时的患者姓名 (仅用于展示)
+	Department   string     `gorm:"not null" json:"department"`                 // 被授权的科室名称 (随科室改名同步，仅用于展示)
+	DepartmentID *uint      `gorm:"index" json:"department_id"`                 // 被授权的科室 (为空的是无法确定科室的旧授权，不生效)
+	GrantedBy    uint       `json:"granted_by"`                                 // 授权人 (患者本人的用户ID)
+	ExpiresAt    *time.Time `json:"expires_at"`                                 // 为空表示长期有效
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Dependent 家属 (监护人代为挂号、查看就诊记录的患者)
+type Dependent struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	GuardianID    uint       `gorm:"index;not null" json:"guardian_id"` // 监护人账号
+	PatientID     uint       `gorm:"index;not null" json:"patient_id"`  // 家属的患者档案
+	PatientName   string     `gorm:"index;not null" json:"patient_name"`
+	Relationship  string     `gorm:"not null" json:"relationship"`   // child, parent, spouse, other
+	ConsentMethod string     `gorm:"not null" json:"consent_method"` // guardian: 监护人声明 (未成年人)；sms: 家属本人或档案登记的手机验证
+	ExpiresAt     *time.Time `json:"expires_at"`                     // 未成年人满 18 周岁自动失效
+	RevokedAt     *time.Time `json:"revoked_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// BreakGlassGrant 紧急情况下医生临时获取的病历访问权限
+type BreakGlassGrant struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"index;not null" json:"user_id"`
+	PatientID   uint      `gorm:"index;not null;default:0" json:"patient_id"`
+	PatientName string    `gorm:"index;not null" json:"patient_name"` // 申请时的患者姓名 (仅用于展示)
+	Reason      string    `gorm:"not null" json:"reason"`             // 必填：紧急访问理由
+	ExpiresAt   time.Time `json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RecordAccessLog 病历访问日志 (供管理员审查)
+type RecordAccessLog struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"index" json:"user_id"`
+	Role        string    `json:"role"`
+	PatientID   uint      `gorm:"index;not null;default:0" json:"patient_id"` // 0 表示前台未建档的患者
+	PatientName string    `gorm:"index" json:"patient_name"`                  // 访问时的患者姓名
+	RecordID    uint      `json:"record_id"`                                  // 0 表示访问的是时间线等汇总数据
+	Action      string    `json:"action"`                                     // view_record, view_timeline, break_glass, view_attachments, download_attachment 等
+	Basis       string    `json:"basis"`                                      // patient, treating_doctor, department_consent, break_glass
+	Reason      string    `json:"reason"`
+	IP          string    `json:"ip"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
+
+// ErasureRequest 患者数据删除申请 (患者本人或前台代为提交，全局管理员审批后匿名化该患者的全部数据)
+type ErasureRequest struct {
+	ID          uint             `gorm:"primaryKey" json:"id"`
+	PatientID   uint             `gorm:"index;not null" json:"patient_id"`
+	RequestedBy uint             `gorm:"not null" json:"requested_by"`
+	Reason      string           `json:"reason"`
+	Status      string           `gorm:"index;not null" json:"status"` // pending, rejected, completed
+	ReviewedBy  *uint            `json:"reviewed_by"`
+	ReviewNote  string           `json:"review_note"`
+	ReviewedAt  *time.Time       `json:"reviewed_at"`
+	Summary     map[string]int64 `gorm:"serializer:json" json:"summary"` // 执行结果：各表处理的行数
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// 删除申请状态
+const (
+	ErasurePending   = "pending"
+	ErasureRejected  = "rejected"
+	ErasureCompleted = "completed"
+)
+
+// AuditLog 审计日志 (哈希链：每条记录的 Hash 包含上一条的 Hash，任何篡改都会导致校验失败)
+type AuditLog struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActorID    uint      `gorm:"index" json:"actor_id"` // 0 表示系统操作或未登录用户
+	ActorRole  string    `json:"actor_role"`
+	OrgID      uint      `gorm:"index" json:"org_id"`
+	IP         string    `json:"ip"`
+	Action     string    `json:"action"`                   // 触发操作的接口，例如 "PUT /api/v1/dashboard/storehouse/:id"
+	Operation  string    `gorm:"index" json:"operation"`   // create, update, delete
+	EntityType string    `gorm:"index" json:"entity_type"` // 表名
+	EntityID   string    `gorm:"index" json:"entity_id"`   // 主键
+	Before     string    `gorm:"type:text" json:"before"`  // 修改前 (JSON)
+	After      string    `gorm:"type:text" json:"after"`   // 修改后 (JSON)
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `gorm:"uniqueIndex" json:"hash"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// BeforeSave 给密码加密 (Create、Save、Update 都会经过这里)
+func (u *User) BeforeSave(tx *gorm.DB) (err error) {
+	// Update("password", ...) / Updates(map) 传入的新密码在 Dest 里
+	if dest, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		if plain, ok := dest["password"].(string); ok && !isPasswordHash(plain) {
+			hashed, err := hashPassword(plain)
+			if err != nil {
+				return err
+			}
+			dest["password"] = hashed
+		}
 		return nil
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	// Create / Save / Updates(结构体)：直接改结构体字段
+	// 增加一层保护：如果密码看起来已经是 bcrypt 哈希，则跳过
+	if u.Password == "" || isPasswordHash(u.Password) {
+		return nil
+	}
+	hashed, err := hashPassword(u.Password)
 	if err != nil {
 		return err
 	}
-	u.Password = string(hashedPassword)
+	tx.Statement.SetColumn("Password", hashed)
+	u.Password = hashed
 	return nil
 }
 
+// BeforeSave 更新盲索引 (Create、Save、Update 都会经过这里)
+// Create / Save 写入整行，按当前值计算；Update / Updates 只在改了身份证号、手机号时按新值计算，
+// 否则不动盲索引 (Model 可能只是带 ID 的空结构体，按它计算会把盲索引清空)
+func (p *Patient) BeforeSave(tx *gorm.DB) error {
+	stmt := tx.Statement
+	if savesWholeRow(stmt, p) {
+		p.IDCardHash = fieldcrypt.BlindIndex(p.IDCard)
+		p.PhoneHash = fieldcrypt.BlindIndex(p.Phone)
+		stmt.SetColumn("IDCardHash", p.IDCardHash)
+		stmt.SetColumn("PhoneHash", p.PhoneHash)
+		return nil
+	}
+	if idCard, ok := updatedString(stmt, "IDCard"); ok {
+		stmt.SetColumn("IDCardHash", fieldcrypt.BlindIndex(idCard))
+	}
+	if phone, ok := updatedString(stmt, "Phone"); ok {
+		stmt.SetColumn("PhoneHash", fieldcrypt.BlindIndex(phone))
+	}
+	return nil
+}
+
+// savesWholeRow Create / Save：Dest 就是钩子所在的记录 (批量创建时是包含它的切片)
+func savesWholeRow(stmt *gorm.Statement, record interface{}) bool {
+	switch rv := reflect.Indirect(reflect.ValueOf(stmt.Dest)); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		return true
+	case reflect.Struct:
+		return rv.CanAddr() && rv.Addr().Interface() == record
+	}
+	return false
+}
+
+// updatedString Update / Updates 是否修改了字符串字段 field，以及修改后的值
+func updatedString(stmt *gorm.Statement, field string) (string, bool) {
+	// Update(列, 值) / Updates(map)：出现即算修改 (包括改成空字符串，Changed 在 Model 未加载时看不出来)
+	if dest, ok := stmt.Dest.(map[string]interface{}); ok {
+		for _, key := range []string{field, stmt.Schema.LookUpField(field).DBName} {
+			if v, ok := dest[key]; ok {
+				s, _ := v.(string)
+				return s, true
+			}
+		}
+		return "", false
+	}
+	// Updates(结构体)：由 Changed 判断 (零值字段不会更新，除非 Select 了该字段)
+	if !stmt.Changed(field) {
+		return "", false
+	}
+	return reflect.Indirect(reflect.ValueOf(stmt.Dest)).FieldByName(field).String(), true
+}
+
+func hashPassword(plain string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	return string(hashed), err
+}
+
+// isPasswordHash 判断是否已经是 bcrypt 哈希 ($2a$/$2b$/$2y$ 开头，固定 60 位)
+func isPasswordHash(s string) bool {
+	return len(s) == 60 && (strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$"))
+}
+
+// AfterCreate 把初始密码记入历史
+func (u *User) AfterCreate(tx *gorm.DB) error {
+	return tx.Create(&PasswordHistory{UserID: u.ID, PasswordHash: u.Password}).Error
+}
+
 // CheckPassword 验证密码
 func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
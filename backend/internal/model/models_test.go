@@ -0,0 +1,70 @@
+package model_test
+
+import (
+	"testing"
+
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func useFieldKeys(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := fieldcrypt.Generate(dir); err != nil {
+		t.Fatal(err)
+	}
+	k, err := fieldcrypt.Load(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldcrypt.Use(k)
+	t.Cleanup(func() { fieldcrypt.Use(nil) })
+}
+
+// 只改部分字段时，没改的身份证号、手机号的盲索引保持不变
+func TestPatientBlindIndex(t *testing.T) {
+	useFieldKeys(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		p := model.Patient{Name: "张三", Phone: "13800138000", IDCard: "110101199003071234"}
+		if err := db.Create(&p).Error; err != nil {
+			t.Fatal(err)
+		}
+		check := func(step, phone, idCard string) {
+			t.Helper()
+			var got model.Patient
+			db.First(&got, p.ID)
+			if got.PhoneHash != fieldcrypt.BlindIndex(phone) || got.IDCardHash != fieldcrypt.BlindIndex(idCard) {
+				t.Errorf("%s: 盲索引与手机号 %q、身份证号 %q 不一致", step, phone, idCard)
+			}
+		}
+		check("创建", "13800138000", "110101199003071234")
+
+		// Model 只带 ID，未改的字段在结构体里是空字符串
+		db.Model(&model.Patient{ID: p.ID}).Update("name", "张三丰")
+		check("Update 其他列", "13800138000", "110101199003071234")
+
+		db.Model(&model.Patient{ID: p.ID}).Updates(map[string]interface{}{"phone": "13900139000"})
+		check("Updates(map) 改手机号", "13900139000", "110101199003071234")
+
+		db.Model(&model.Patient{ID: p.ID}).Updates(model.Patient{IDCard: "11010119900307123X"})
+		check("Updates(结构体) 改身份证号", "13900139000", "11010119900307123X")
+
+		db.Model(&model.Patient{ID: p.ID}).Update("phone", "")
+		check("清空手机号", "", "11010119900307123X")
+
+		// Save 写入整行
+		db.First(&p, p.ID)
+		p.Phone = "13700137000"
+		db.Save(&p)
+		check("Save", "13700137000", "11010119900307123X")
+
+		var n int64
+		db.Model(&model.Patient{}).Where("id_card_hash = ?", fieldcrypt.BlindIndex("11010119900307123x")).Count(&n)
+		if n != 1 {
+			t.Errorf("按身份证号盲索引查到 %d 个患者，应为 1", n)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// --- 患者申请删除本人数据 ---
+// 患者本人或前台代为提交申请 -> 全局管理员审批 (不能审批自己提交的) -> 通过后立即匿名化该患者的全部数据并注销账号
+// 申请记录经过审计回调，审计日志中能查到提交人、审批人和各表处理的行数
+// 病历有法定保存期限，审批前请确认删除不违反保存要求
+
+var ErrNotPending = errors.New("该申请已处理")
+
+// Approve 审批通过：在同一个事务中匿名化患者数据并把申请标记为已完成
+// db 需要带上操作人的 context (DB.WithContext)，申请状态的修改才能记到审批人名下
+func Approve(ctx context.Context, db *gorm.DB, req *model.ErasureRequest, reviewerID uint, note string) error {
+	var files []model.MediaFile
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 1. 事务内加锁重新读取，防止两个管理员同时审批 (PostgreSQL 行锁；SQLite 写事务本身互斥)
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(req, req.ID).Error; err != nil {
+			return err
+		}
+		if req.Status != model.ErasurePending {
+			return ErrNotPending
+		}
+
+		// 2. 匿名化
+		s, err := loadSubject(tx, req.PatientID)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		counts := Counts{}
+		if files, err = anonymizeSubject(tx, s, true, now, counts); err != nil {
+			return err
+		}
+
+		// 3. 记录审批结果
+		req.Status = model.ErasureCompleted
+		req.ReviewedBy = &reviewerID
+		req.ReviewNote = note
+		req.ReviewedAt = &now
+		req.Summary = counts
+		return tx.Save(req).Error
+	})
+	if err != nil {
+		return err
+	}
+	removeFiles(ctx, files)
+	return nil
+}
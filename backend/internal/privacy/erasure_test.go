@@ -0,0 +1,252 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hospital-system/internal/audit"
+	"hospital-system/internal/database/dbtest"
+	"hospital-system/internal/fieldcrypt"
+	"hospital-system/internal/model"
+	"hospital-system/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// setup 加载字段加密密钥，附件存到临时目录
+func setup(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	if _, err := fieldcrypt.Generate(dir); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := fieldcrypt.Load(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldcrypt.Use(keys)
+	storage.Default = &storage.LocalStore{Dir: t.TempDir()}
+	t.Cleanup(func() {
+		fieldcrypt.Use(nil)
+		storage.Default = nil
+	})
+}
+
+// seedPatient 一位患者：档案、账号、一次挂号 (含病历和附件)、过敏史、访问日志、恢复码和短信验证码
+func seedPatient(t *testing.T, db *gorm.DB, name, phone string) (model.Patient, model.User, model.MediaFile) {
+	t.Helper()
+	ctx := context.Background()
+	birth := time.Date(1988, 5, 1, 0, 0, 0, 0, time.Local)
+	p := model.Patient{Name: name, Phone: phone, IDCard: "11010519491231002X", Gender: "女", BirthDate: &birth}
+	must(t, db.Create(&p).Error)
+	user := model.User{Username: "u" + phone, Password: "Passw0rd!", Role: "general_user", PatientID: &p.ID, Enabled: true}
+	must(t, db.Create(&user).Error)
+
+	b := model.Booking{PatientName: name, PatientID: &p.ID, Age: 37, Gender: "女", Department: "内科", DoctorID: 100, Status: "Completed"}
+	must(t, db.Create(&b).Error)
+	rec := model.MedicalRecord{BookingID: b.ID, Diagnosis: name + " 上呼吸道感染", Prescription: "布洛芬"}
+	must(t, db.Create(&rec).Error)
+
+	key := "records/" + phone + ".pdf"
+	must(t, storage.Default.Put(ctx, key, strings.NewReader("report"), 6, "application/pdf"))
+	file := model.MediaFile{Category: "record", Key: key, ContentType: "application/pdf", Size: 6, OriginalName: name + "-报告.pdf"}
+	must(t, db.Create(&file).Error)
+	must(t, db.Create(&model.RecordAttachment{RecordID: rec.ID, MediaID: file.ID, Kind: "report"}).Error)
+
+	must(t, db.Create(&model.PatientAllergy{PatientID: p.ID, PatientName: name, Allergen: "青霉素", Severity: "severe"}).Error)
+	must(t, db.Create(&model.RecordAccessLog{UserID: 100, Role: "doctor", PatientID: p.ID, PatientName: name, RecordID: rec.ID, Action: "view_record"}).Error)
+	must(t, db.Create(&model.RecoveryCode{UserID: user.ID, CodeHash: "hash-" + phone}).Error)
+	must(t, db.Create(&model.PhoneVerification{Phone: phone, Purpose: "register", CodeHash: "x", ExpiresAt: time.Now()}).Error)
+	return p, user, file
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(db *gorm.DB, table, where string, args ...interface{}) int64 {
+	var n int64
+	db.Table(table).Where(where, args...).Count(&n)
+	return n
+}
+
+func TestApproveErasure(t *testing.T) {
+	setup(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		ctx := context.Background()
+		p, user, file := seedPatient(t, db, "张三", "13800138000")
+		other, otherUser, otherFile := seedPatient(t, db, "李四", "13900139000")
+
+		req := model.ErasureRequest{PatientID: p.ID, RequestedBy: user.ID, Reason: "不再就诊", Status: model.ErasurePending}
+		must(t, db.Create(&req).Error)
+		adminCtx := audit.WithActor(ctx, &audit.Actor{UserID: 1, Role: "global_admin"})
+		if err := Approve(adminCtx, db, &req, 1, "已核实"); err != nil {
+			t.Fatalf("Approve: %v", err)
+		}
+
+		// 1. 申请：已完成，记录审批人和各表处理的行数
+		var saved model.ErasureRequest
+		must(t, db.First(&saved, req.ID).Error)
+		if saved.Status != model.ErasureCompleted || saved.ReviewedBy == nil || *saved.ReviewedBy != 1 || saved.ReviewedAt == nil {
+			t.Errorf("申请状态 = %+v", saved)
+		}
+		for _, table := range []string{"patients", "bookings", "medical_records", "record_attachments", "patient_allergies", "record_access_logs", "users", "recovery_codes", "phone_verifications"} {
+			if saved.Summary[table] != 1 {
+				t.Errorf("Summary[%s] = %d，应为 1 (%v)", table, saved.Summary[table], saved.Summary)
+			}
+		}
+		if n := count(db, "audit_logs", "entity_type = 'erasure_requests' AND operation = 'update' AND actor_id = 1"); n != 1 {
+			t.Errorf("审批应记入审计日志 (审批人 1)，实际 %d 条", n)
+		}
+		// 匿名化不经过审计回调，审计日志里不应出现匿名化后的档案
+		if n := count(db, "audit_logs", "entity_type = 'patients' AND operation = 'update'"); n != 0 {
+			t.Errorf("匿名化不应写审计日志，实际 %d 条", n)
+		}
+
+		// 2. 档案：身份信息清除，性别保留
+		var gotP model.Patient
+		must(t, db.First(&gotP, p.ID).Error)
+		if gotP.Name != "" || gotP.Phone != "" || gotP.IDCard != "" || gotP.PhoneHash != "" || gotP.IDCardHash != "" ||
+			gotP.BirthDate != nil || gotP.AnonymizedAt == nil || gotP.Gender != "女" {
+			t.Errorf("档案未匿名化: %+v", gotP)
+		}
+
+		// 3. 挂号保留科室、医生，年龄只保留年龄段；病历文本清空；附件记录和文件删除
+		var b model.Booking
+		must(t, db.Where("doctor_id = 100 AND anonymized_at IS NOT NULL").First(&b).Error)
+		if b.PatientName != "" || b.PatientID != nil || b.Age != 30 || b.Department != "内科" {
+			t.Errorf("挂号 = %+v", b)
+		}
+		if n := count(db, "medical_records", "booking_id = ? AND (diagnosis <> '' OR prescription <> '')", b.ID); n != 0 {
+			t.Error("病历诊断和处方应已清空")
+		}
+		if n := count(db, "media_files", "id = ?", file.ID); n != 0 {
+			t.Error("附件记录应已删除")
+		}
+		if _, err := storage.Default.Open(ctx, file.Key); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("附件文件应已删除: %v", err)
+		}
+
+		// 4. 按档案关联：过敏史删除，访问日志保留但去掉姓名
+		if n := count(db, "patient_allergies", "patient_id = ?", p.ID); n != 0 {
+			t.Error("过敏史应已删除")
+		}
+		if n := count(db, "record_access_logs", "patient_name = '' AND action = 'view_record'"); n != 1 {
+			t.Errorf("访问日志应保留 1 条并去掉姓名，实际 %d", n)
+		}
+
+		// 5. 账号注销：改名、停用、软删除，已登录的 Token 失效，恢复码清除
+		var gotU model.User
+		must(t, db.Unscoped().First(&gotU, user.ID).Error)
+		if !strings.HasPrefix(gotU.Username, "erased-") || gotU.Enabled || gotU.PatientID != nil ||
+			!gotU.DeletedAt.Valid || gotU.TokenVersion != user.TokenVersion+1 {
+			t.Errorf("账号未注销: %+v", gotU)
+		}
+		if n := count(db, "recovery_codes", "user_id = ?", user.ID); n != 0 {
+			t.Error("恢复码应已删除")
+		}
+		if n := count(db, "phone_verifications", "phone = ?", "13800138000"); n != 0 {
+			t.Error("短信验证码记录应已删除")
+		}
+
+		// 6. 其他患者不受影响
+		var gotOther model.Patient
+		must(t, db.First(&gotOther, other.ID).Error)
+		if gotOther.Name != "李四" || gotOther.Phone != "13900139000" || gotOther.AnonymizedAt != nil {
+			t.Errorf("其他患者被修改: %+v", gotOther)
+		}
+		if n := count(db, "users", "id = ? AND enabled = ? AND deleted_at IS NULL", otherUser.ID, true); n != 1 {
+			t.Error("其他患者的账号被修改")
+		}
+		if n := count(db, "patient_allergies", "patient_name = ?", "李四"); n != 1 {
+			t.Error("其他患者的过敏史被删除")
+		}
+		if _, err := storage.Default.Open(ctx, otherFile.Key); err != nil {
+			t.Errorf("其他患者的附件被删除: %v", err)
+		}
+
+		// 7. 已处理的申请不能再次审批
+		if err := Approve(adminCtx, db, &req, 1, ""); !errors.Is(err, ErrNotPending) {
+			t.Errorf("再次审批: err = %v，应为 ErrNotPending", err)
+		}
+	})
+}
+
+// 同名的另一位患者：删除和导出都只按档案，不会波及对方的过敏史、授权和访问日志
+func TestErasureSparesNamesake(t *testing.T) {
+	setup(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		ctx := context.Background()
+		p, user, _ := seedPatient(t, db, "张三", "13800138000")
+		twin, twinUser, _ := seedPatient(t, db, "张三", "13900139000")
+		must(t, db.Create(&model.RecordConsent{PatientID: twin.ID, PatientName: "张三", Department: "内科", GrantedBy: twinUser.ID}).Error)
+		must(t, db.Create(&model.BreakGlassGrant{UserID: 100, PatientID: twin.ID, PatientName: "张三", Reason: "急诊抢救", ExpiresAt: time.Now()}).Error)
+
+		// 导出只含本人的数据
+		bundle, err := Export(db, p.ID)
+		must(t, err)
+		if len(bundle.Bookings) != 1 || len(bundle.Allergies) != 1 || len(bundle.AccessLogs) != 1 || len(bundle.Consents) != 0 {
+			t.Errorf("导出混入了同名患者的数据: 挂号 %d, 过敏史 %d, 访问日志 %d, 授权 %d",
+				len(bundle.Bookings), len(bundle.Allergies), len(bundle.AccessLogs), len(bundle.Consents))
+		}
+
+		req := model.ErasureRequest{PatientID: p.ID, RequestedBy: user.ID, Status: model.ErasurePending}
+		must(t, db.Create(&req).Error)
+		if err := Approve(ctx, db, &req, 1, ""); err != nil {
+			t.Fatalf("Approve: %v", err)
+		}
+
+		for table, where := range map[string]string{
+			"patients":           "id = ? AND name = '张三'",
+			"bookings":           "patient_id = ? AND patient_name = '张三'",
+			"patient_allergies":  "patient_id = ? AND patient_name = '张三'",
+			"record_consents":    "patient_id = ? AND patient_name = '张三'",
+			"break_glass_grants": "patient_id = ? AND patient_name = '张三'",
+			"record_access_logs": "patient_id = ? AND patient_name = '张三'",
+		} {
+			if n := count(db, table, where, twin.ID); n != 1 {
+				t.Errorf("同名患者的 %s 被修改，剩余 %d 条", table, n)
+			}
+		}
+	})
+}
+
+// 两个管理员同时审批同一个申请：只有一个成功
+func TestApproveErasureConcurrent(t *testing.T) {
+	setup(t)
+	dbtest.Each(t, func(t *testing.T, db *gorm.DB) {
+		p, user, _ := seedPatient(t, db, "张三", "13800138000")
+		req := model.ErasureRequest{PatientID: p.ID, RequestedBy: user.ID, Status: model.ErasurePending}
+		must(t, db.Create(&req).Error)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		for i := range errs {
+			wg.Go(func() {
+				r := model.ErasureRequest{ID: req.ID}
+				errs[i] = Approve(context.Background(), db, &r, uint(i+1), "")
+			})
+		}
+		wg.Wait()
+
+		ok := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				ok++
+			case !errors.Is(err, ErrNotPending) && !strings.Contains(err.Error(), "locked"):
+				t.Errorf("审批失败: %v", err)
+			}
+		}
+		if ok != 1 {
+			t.Errorf("成功审批 %d 次，应为 1 (%v)", ok, errs)
+		}
+	})
+}
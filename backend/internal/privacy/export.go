@@ -0,0 +1,91 @@
+package privacy
+
+import (
+	"time"
+
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// --- 患者数据导出 ---
+// 患者查阅、复制本人数据的权利：把一位患者在系统中的全部数据打包成一个 JSON 文件
+// 范围与删除相同 (见 subject)；身份证号、手机号、诊断是解密后的完整内容，附件只列出文件信息
+
+// Bundle 导出的数据
+type Bundle struct {
+	ExportedAt      time.Time               `json:"exported_at"`
+	Patient         model.Patient           `json:"patient"`
+	Account         *model.User             `json:"account"`
+	Bookings        []model.Booking         `json:"bookings"`
+	MedicalRecords  []model.MedicalRecord   `json:"medical_records"`
+	LabResults      []model.LabResult       `json:"lab_results"`
+	Orders          []model.Order           `json:"orders"`
+	Attachments     []Attachment            `json:"attachments"`
+	Allergies       []model.PatientAllergy  `json:"allergies"`
+	Consents        []model.RecordConsent   `json:"consents"`
+	Dependents      []model.Dependent       `json:"dependents"`
+	AccessLogs      []model.RecordAccessLog `json:"access_logs"` // 谁在什么时候以什么依据查看过病历
+	ErasureRequests []model.ErasureRequest  `json:"erasure_requests"`
+}
+
+// Attachment 病历附件及其文件信息 (文件内容通过病历附件接口下载)
+type Attachment struct {
+	model.RecordAttachment
+	OriginalName string `json:"original_name"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	SHA256       string `gorm:"column:sha256" json:"sha256"`
+}
+
+// Export 汇总一位患者的全部数据，档案不存在时返回 gorm.ErrRecordNotFound
+func Export(db *gorm.DB, patientID uint) (*Bundle, error) {
+	s, err := loadSubject(db, patientID)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{ExportedAt: time.Now(), Patient: s.patient, Account: s.user, Attachments: []Attachment{}}
+
+	// find 依次查询，遇到第一个错误后跳过剩下的
+	find := func(dest interface{}, q *gorm.DB) {
+		if err == nil {
+			err = q.Order("id").Find(dest).Error
+		}
+	}
+
+	// 1. 就诊：挂号 -> 病历、检验、订单 -> 附件
+	find(&b.Bookings, db.Where("id IN ?", s.bookingIDs))
+	find(&b.MedicalRecords, db.Where("booking_id IN ?", s.bookingIDs))
+	find(&b.LabResults, db.Where("booking_id IN ?", s.bookingIDs))
+	find(&b.Orders, db.Where("booking_id IN ?", s.bookingIDs))
+	if err != nil {
+		return nil, err
+	}
+	recordIDs := make([]uint, 0, len(b.MedicalRecords))
+	for _, r := range b.MedicalRecords {
+		recordIDs = append(recordIDs, r.ID)
+	}
+	err = db.Table("record_attachments").
+		Select("record_attachments.*, media_files.original_name, media_files.content_type, media_files.size, media_files.sha256").
+		Joins("LEFT JOIN media_files ON media_files.id = record_attachments.media_id").
+		Where("record_attachments.record_id IN ?", recordIDs).
+		Order("record_attachments.id").
+		Scan(&b.Attachments).Error
+
+	// 2. 按档案关联的数据
+	find(&b.Allergies, db.Where("patient_id = ?", patientID))
+	find(&b.Consents, db.Where("patient_id = ?", patientID))
+	find(&b.AccessLogs, db.Where("patient_id = ?", patientID))
+
+	// 3. 家属关系 (作为家属被登记的，以及作为监护人登记的) 和删除申请
+	deps := db.Where("patient_id = ?", patientID)
+	if s.user != nil {
+		deps = deps.Or("guardian_id = ?", s.user.ID)
+	}
+	find(&b.Dependents, deps)
+	find(&b.ErasureRequests, db.Where("patient_id = ?", patientID))
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
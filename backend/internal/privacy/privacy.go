@@ -0,0 +1,248 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+	"hospital-system/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// --- 数据保留与患者数据删除 ---
+// 1. 保留期限 (config.yaml 的 retention)：定时任务把到期的就诊记录和长期未就诊的患者档案匿名化，
+//    到期的病历访问日志、短信验证码记录直接删除 (retention.go)
+// 2. 患者申请删除本人数据：全局管理员审批后立即匿名化该患者的全部数据 (erasure.go)
+// 3. 患者数据导出：一位患者的全部数据打包成 JSON (export.go)
+//
+// 匿名化清除能识别患者的信息 (姓名、证件号、手机号、出生日期) 和病历中的自由文本，删除病历附件；
+// 挂号的科室、医生、日期、性别、年龄段和订单金额保留，财务与科室统计不受影响
+// 匿名化直接按表名更新，不经过模型钩子和审计回调，避免把要清除的内容再复制一份到审计日志；
+// 删除申请本身 (谁提交、谁审批、处理了多少行) 经过审计。审计日志是哈希链不能修改，其中的历史记录随审计日志保留
+
+// 匿名化后患者账号的用户名
+const erasedUsername = "erased-%d"
+
+// Counts 各表处理的行数
+type Counts map[string]int64
+
+func (c Counts) add(table string, n int64) {
+	if n > 0 {
+		c[table] += n
+	}
+}
+
+// subject 一位患者 (数据主体) 在各表中的数据范围
+// 只认档案 ID 和绑定账号：姓名会重名，前台手填姓名、没有关联档案的挂号无法与同名的其他患者区分，不在范围内
+type subject struct {
+	patient    model.Patient
+	user       *model.User // 绑定的患者账号 (含已删除的)
+	bookingIDs []uint
+}
+
+// loadSubject 查出一位患者的档案、账号和挂号
+func loadSubject(db *gorm.DB, patientID uint) (*subject, error) {
+	s := &subject{}
+	if err := db.First(&s.patient, patientID).Error; err != nil {
+		return nil, err
+	}
+
+	var user model.User
+	err := db.Unscoped().Where("patient_id = ?", patientID).First(&user).Error
+	switch {
+	case err == nil:
+		s.user = &user
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	err = db.Model(&model.Booking{}).Where("patient_id = ?", patientID).Order("id").Pluck("id", &s.bookingIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// anonymizeBookings 匿名化一批挂号及其病历、紧急开药记录和附件
+// 返回已删除的附件文件，需要在事务提交后调用 removeFiles 删除存储中的内容
+func anonymizeBookings(tx *gorm.DB, bookingIDs []uint, now time.Time, counts Counts) ([]model.MediaFile, error) {
+	if len(bookingIDs) == 0 {
+		return nil, nil
+	}
+
+	// 1. 挂号：去掉患者姓名和档案关联，年龄只保留年龄段 (37 -> 30)
+	res := tx.Table("bookings").Where("id IN ?", bookingIDs).Updates(map[string]interface{}{
+		"patient_name":  "",
+		"patient_id":    nil,
+		"age":           gorm.Expr("age - age % 10"),
+		"anonymized_at": now,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	counts.add("bookings", res.RowsAffected)
+
+	// 2. 病历：诊断和处方是自由文本，可能含有能识别患者的内容，直接清空
+	var recordIDs []uint
+	if err := tx.Table("medical_records").Where("booking_id IN ?", bookingIDs).Pluck("id", &recordIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(recordIDs) == 0 {
+		return nil, nil
+	}
+	res = tx.Table("medical_records").Where("id IN ?", recordIDs).
+		Updates(map[string]interface{}{"diagnosis": "", "prescription": ""})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	counts.add("medical_records", res.RowsAffected)
+
+	// 3. 忽略警告开药的记录：警告内容和理由同样是自由文本 (医生、药品保留)
+	res = tx.Table("prescription_overrides").Where("medical_record_id IN ?", recordIDs).
+		Updates(map[string]interface{}{"warnings": "", "reason": ""})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	counts.add("prescription_overrides", res.RowsAffected)
+
+	// 4. 附件 (外院报告、知情同意书上都有患者信息)：删除记录和文件
+	var atts []model.RecordAttachment
+	if err := tx.Where("record_id IN ?", recordIDs).Find(&atts).Error; err != nil {
+		return nil, err
+	}
+	if len(atts) == 0 {
+		return nil, nil
+	}
+	mediaIDs := make([]uint, 0, len(atts))
+	for _, a := range atts {
+		mediaIDs = append(mediaIDs, a.MediaID)
+	}
+	var files []model.MediaFile
+	if err := tx.Where("id IN ?", mediaIDs).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	res = tx.Table("record_attachments").Where("record_id IN ?", recordIDs).Delete(nil)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	counts.add("record_attachments", res.RowsAffected)
+	if err := tx.Table("media_files").Where("id IN ?", mediaIDs).Delete(nil).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// anonymizeSubject 匿名化一位患者：档案、全部挂号，以及按档案关联的过敏史、授权、家属关系和访问日志
+// withAccount 为 true 时一并注销绑定的账号 (患者申请删除)；定时任务只处理没有可用账号的档案
+func anonymizeSubject(tx *gorm.DB, s *subject, withAccount bool, now time.Time, counts Counts) ([]model.MediaFile, error) {
+	files, err := anonymizeBookings(tx, s.bookingIDs, now, counts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 档案：清除身份信息，性别保留
+	res := tx.Table("patients").Where("id = ?", s.patient.ID).Updates(map[string]interface{}{
+		"name":          "",
+		"phone":         "",
+		"phone_hash":    "",
+		"id_card":       "",
+		"id_card_hash":  "",
+		"birth_date":    nil,
+		"anonymized_at": now,
+	})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	counts.add("patients", res.RowsAffected)
+
+	// 2. 按档案关联的数据：过敏史、授权直接删除；紧急访问和访问日志要留作问责，只去掉患者姓名
+	for _, table := range []string{"patient_allergies", "record_consents"} {
+		res := tx.Table(table).Where("patient_id = ?", s.patient.ID).Delete(nil)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		counts.add(table, res.RowsAffected)
+	}
+	for _, table := range []string{"break_glass_grants", "record_access_logs"} {
+		res := tx.Table(table).Where("patient_id = ?", s.patient.ID).Update("patient_name", "")
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		counts.add(table, res.RowsAffected)
+	}
+
+	// 3. 家属关系 (作为家属被登记的，以及作为监护人登记的)
+	deps := tx.Table("dependents").Where("patient_id = ?", s.patient.ID)
+	if s.user != nil {
+		deps = deps.Or("guardian_id = ?", s.user.ID)
+	}
+	res = deps.Delete(nil)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	counts.add("dependents", res.RowsAffected)
+
+	// 4. 短信验证码记录里有明文手机号
+	if s.patient.Phone != "" {
+		res := tx.Table("phone_verifications").Where("phone = ?", s.patient.Phone).Delete(nil)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		counts.add("phone_verifications", res.RowsAffected)
+	}
+
+	if withAccount && s.user != nil {
+		if err := eraseAccount(tx, s.user, now, counts); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// eraseAccount 注销患者账号：用户名换成 erased-<ID>，解除档案绑定，停用并删除，清除密码历史和两步验证
+func eraseAccount(tx *gorm.DB, user *model.User, now time.Time, counts Counts) error {
+	updates := map[string]interface{}{
+		"username":         fmt.Sprintf(erasedUsername, user.ID),
+		"patient_id":       nil,
+		"external_subject": nil,
+		"enabled":          false,
+		"totp_secret":      "",
+		"totp_enabled":     false,
+		"token_version":    gorm.Expr("token_version + 1"), // 已登录的 Token 立即失效
+	}
+	if !user.DeletedAt.Valid {
+		updates["deleted_at"] = now
+	}
+	res := tx.Table("users").Where("id = ?", user.ID).Updates(updates)
+	if res.Error != nil {
+		return res.Error
+	}
+	counts.add("users", res.RowsAffected)
+
+	for _, table := range []string{"password_histories", "password_reset_tokens", "recovery_codes"} {
+		res := tx.Table(table).Where("user_id = ?", user.ID).Delete(nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		counts.add(table, res.RowsAffected)
+	}
+	return nil
+}
+
+// removeFiles 删除存储中的附件文件 (数据库记录已在事务中删除，这里失败只记日志)
+func removeFiles(ctx context.Context, files []model.MediaFile) {
+	for _, m := range files {
+		for _, key := range []string{m.Key, m.ThumbKey} {
+			if key == "" {
+				continue
+			}
+			if err := storage.Default.Delete(ctx, key); err != nil {
+				logging.Warnf("删除文件 %s 失败: %v", key, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"hospital-system/config"
+	"hospital-system/internal/logging"
+	"hospital-system/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// --- 保留期限 ---
+// 每个策略按天计算截止时间，0 表示永久保留：
+//   visit_days             挂号早于截止时间的，匿名化挂号及其病历、附件
+//   inactive_patient_days  建档早于截止时间、之后没有再就诊、也没有可用账号的患者档案，匿名化档案及其全部挂号
+//   access_log_days        删除更早的病历访问日志
+//   phone_verification_days 删除更早的短信验证码记录
+// 按主键分批处理，每批一个事务，中途失败下次接着处理
+
+// 执行来源
+const (
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+	TriggerCommand  = "command"
+)
+
+const (
+	retentionBatch = 500
+
+	// 定时任务检查间隔；启动后第一次检查时即执行一次
+	scheduleCheck = time.Minute
+)
+
+var ErrRunning = errors.New("已有数据清理任务正在进行")
+
+// Result 一次执行的结果
+type Result struct {
+	Time       time.Time `json:"time"`
+	Trigger    string    `json:"trigger"`
+	Success    bool      `json:"success"`
+	Counts     Counts    `json:"counts"` // 各表处理的行数
+	DurationMS int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var (
+	runMu sync.Mutex
+
+	statusMu   sync.Mutex
+	lastResult *Result
+)
+
+// Status 最近一次执行的结果，本次启动后还没有执行过时为 nil
+func Status() *Result {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return lastResult
+}
+
+// cutoff 保留 days 天的截止时间，days 为 0 时返回零值 (永久保留)
+func cutoff(now time.Time, days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+	return now.AddDate(0, 0, -days)
+}
+
+// Preview 按当前配置统计到期的数据 (不做任何修改)
+func Preview(db *gorm.DB) (Counts, error) {
+	cfg := config.Get().Retention
+	now := time.Now()
+	counts := Counts{}
+
+	if t := cutoff(now, cfg.VisitDays); !t.IsZero() {
+		var n int64
+		if err := expiredBookings(db, t).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts.add("bookings", n)
+	}
+	if t := cutoff(now, cfg.InactivePatientDays); !t.IsZero() {
+		var n int64
+		if err := inactivePatients(db, t).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		counts.add("patients", n)
+	}
+	for table, days := range map[string]int{
+		"record_access_logs":  cfg.AccessLogDays,
+		"phone_verifications": cfg.PhoneVerificationDays,
+	} {
+		if t := cutoff(now, days); !t.IsZero() {
+			var n int64
+			if err := db.Table(table).Where("created_at < ?", t).Count(&n).Error; err != nil {
+				return nil, err
+			}
+			counts.add(table, n)
+		}
+	}
+	return counts, nil
+}
+
+// expiredBookings 就诊时间早于截止时间、还没有匿名化的挂号
+func expiredBookings(db *gorm.DB, before time.Time) *gorm.DB {
+	return db.Model(&model.Booking{}).Where("created_at < ? AND anonymized_at IS NULL", before)
+}
+
+// inactivePatients 建档和最后一次就诊都早于截止时间、没有可用账号、还没有匿名化的档案
+func inactivePatients(db *gorm.DB, before time.Time) *gorm.DB {
+	return db.Model(&model.Patient{}).
+		Where("created_at < ? AND anonymized_at IS NULL", before).
+		Where("NOT EXISTS (SELECT 1 FROM bookings WHERE bookings.patient_id = patients.id AND bookings.created_at >= ?)", before).
+		Where("NOT EXISTS (SELECT 1 FROM users WHERE users.patient_id = patients.id AND users.deleted_at IS NULL)")
+}
+
+// Run 按当前配置处理一遍到期的数据；已有任务在执行时返回 ErrRunning
+func Run(ctx context.Context, db *gorm.DB, trigger string) (Result, error) {
+	if !runMu.TryLock() {
+		return Result{}, ErrRunning
+	}
+	defer runMu.Unlock()
+
+	start := time.Now()
+	result := Result{Time: start, Trigger: trigger, Counts: Counts{}}
+	err := run(ctx, db, start, result.Counts)
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+		logging.Errorf("数据清理失败 (%s): %v", trigger, err)
+	} else if len(result.Counts) > 0 {
+		log.Printf("数据清理完成 (%s): %v", trigger, result.Counts)
+	}
+
+	statusMu.Lock()
+	lastResult = &result
+	statusMu.Unlock()
+	return result, err
+}
+
+func run(ctx context.Context, db *gorm.DB, now time.Time, counts Counts) error {
+	cfg := config.Get().Retention
+	db = db.WithContext(ctx)
+
+	// 1. 长期未就诊的患者档案 (连同其全部挂号)
+	if t := cutoff(now, cfg.InactivePatientDays); !t.IsZero() {
+		if err := anonymizeInactivePatients(ctx, db, t, now, counts); err != nil {
+			return err
+		}
+	}
+
+	// 2. 到期的挂号、病历
+	if t := cutoff(now, cfg.VisitDays); !t.IsZero() {
+		for {
+			var ids []uint
+			if err := expiredBookings(db, t).Order("id").Limit(retentionBatch).Pluck("id", &ids).Error; err != nil {
+				return err
+			}
+			if len(ids) == 0 {
+				break
+			}
+			var files []model.MediaFile
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				files, err = anonymizeBookings(tx, ids, now, counts)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			removeFiles(ctx, files)
+		}
+	}
+
+	// 3. 到期的日志直接删除
+	for table, days := range map[string]int{
+		"record_access_logs":  cfg.AccessLogDays,
+		"phone_verifications": cfg.PhoneVerificationDays,
+	} {
+		if t := cutoff(now, days); !t.IsZero() {
+			res := db.Table(table).Where("created_at < ?", t).Delete(nil)
+			if res.Error != nil {
+				return res.Error
+			}
+			counts.add(table, res.RowsAffected)
+		}
+	}
+	return ctx.Err()
+}
+
+func anonymizeInactivePatients(ctx context.Context, db *gorm.DB, before, now time.Time, counts Counts) error {
+	var lastID uint
+	for {
+		var ids []uint
+		err := inactivePatients(db, before).Where("id > ?", lastID).
+			Order("id").Limit(retentionBatch).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		lastID = ids[len(ids)-1]
+
+		for _, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var files []model.MediaFile
+			err := db.Transaction(func(tx *gorm.DB) error {
+				s, err := loadSubject(tx, id)
+				if err != nil {
+					return err
+				}
+				files, err = anonymizeSubject(tx, s, false, now, counts)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			removeFiles(ctx, files)
+		}
+	}
+}
+
+// Schedule 按 retention.interval_hours 定时执行，直到 ctx 结束 (在 goroutine 中运行)
+// 每次检查都读取当前配置，热加载修改间隔和期限后无需重启
+func Schedule(ctx context.Context, db *gorm.DB) {
+	ticker := time.NewTicker(scheduleCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		hours := config.Get().Retention.IntervalHours
+		if hours <= 0 {
+			continue
+		}
+		if last := Status(); last != nil && time.Since(last.Time) < time.Duration(hours)*time.Hour {
+			continue
+		}
+		Run(ctx, db, TriggerSchedule)
+	}
+}
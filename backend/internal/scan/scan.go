@@ -0,0 +1,43 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// --- 上传文件安全扫描 ---
+// 文件写入存储、对其他人可见之前先经过扫描
+// 业务代码只依赖 Scanner 接口，接入杀毒引擎 (例如 ClamAV) 时新增一个实现并在 Init 中注册即可
+
+// Result 扫描结果
+type Result struct {
+	Infected bool
+	Threat   string // 发现的威胁名称
+}
+
+// Scanner 文件扫描器
+type Scanner interface {
+	Scan(ctx context.Context, name string, r io.Reader) (Result, error)
+}
+
+// Default 全局使用的扫描器，由 Init 根据配置初始化
+var Default Scanner = NoopScanner{}
+
+// Init 按配置选择扫描器
+func Init(provider string) error {
+	switch provider {
+	case "", "none":
+		Default = NoopScanner{}
+	default:
+		return fmt.Errorf("不支持的文件扫描器: %s", provider)
+	}
+	return nil
+}
+
+// NoopScanner 不做任何检查，所有文件都视为安全 (未接入杀毒引擎时使用)
+type NoopScanner struct{}
+
+func (NoopScanner) Scan(ctx context.Context, name string, r io.Reader) (Result, error) {
+	return Result{}, nil
+}
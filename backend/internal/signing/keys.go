@@ -0,0 +1,268 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// --- JWT 签名密钥 ---
+// 密钥目录下每个 PEM 文件是一把密钥，文件名 (去掉 .pem) 就是 kid
+//   - 私钥 (PKCS#8)：可以签发也可以校验
+//   - 公钥 (PKIX)：只用于校验，轮换后的旧密钥可以只保留公钥，等旧 Token 全部过期后再删除
+// 签发时使用 active_kid 指定的私钥；未指定时使用 kid 最大 (即最新生成) 的私钥
+
+// 支持的算法
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// 生成 RSA 密钥的位数
+const rsaBits = 3072
+
+// Key 一把签名/校验密钥
+type Key struct {
+	KID        string
+	Alg        string
+	PublicKey  crypto.PublicKey
+	PrivateKey crypto.Signer // 只有公钥时为 nil
+}
+
+// Method 对应的 JWT 签名方法
+func (k *Key) Method() jwt.SigningMethod {
+	if k.Alg == AlgEdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// KeySet 当前加载的全部密钥
+type KeySet struct {
+	keys   map[string]*Key
+	active *Key
+}
+
+// ErrNoKeys 密钥目录不存在或没有任何密钥
+var ErrNoKeys = errors.New("密钥目录中没有任何密钥")
+
+// Load 读取密钥目录，activeKID 为空时自动选择最新的私钥
+func Load(dir, activeKID string) (*KeySet, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, ErrNoKeys
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := &KeySet{keys: map[string]*Key{}}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".pem" {
+			continue
+		}
+		kid := strings.TrimSuffix(e.Name(), ".pem")
+		key, err := readKey(filepath.Join(dir, e.Name()), kid)
+		if err != nil {
+			return nil, fmt.Errorf("密钥 %s: %w", e.Name(), err)
+		}
+		set.keys[kid] = key
+	}
+
+	if len(set.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	if activeKID == "" {
+		for _, kid := range set.KIDs() {
+			if set.keys[kid].PrivateKey != nil {
+				activeKID = kid
+			}
+		}
+	}
+	if activeKID == "" {
+		return nil, errors.New("密钥目录中没有可用于签发的私钥")
+	}
+
+	active, ok := set.keys[activeKID]
+	if !ok || active.PrivateKey == nil {
+		return nil, fmt.Errorf("active_kid %s 不存在或没有私钥", activeKID)
+	}
+	set.active = active
+	return set, nil
+}
+
+// Active 当前用于签发的密钥
+func (s *KeySet) Active() *Key {
+	return s.active
+}
+
+// Get 按 kid 查找校验密钥
+func (s *KeySet) Get(kid string) (*Key, bool) {
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// KIDs 全部 kid (升序)
+func (s *KeySet) KIDs() []string {
+	kids := make([]string, 0, len(s.keys))
+	for kid := range s.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
+
+func readKey(path, kid string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("不是有效的 PEM 文件")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := priv.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("不支持的私钥类型")
+		}
+		return newKey(kid, signer.Public(), signer)
+
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(kid, pub, nil)
+	}
+	return nil, fmt.Errorf("不支持的 PEM 类型 %s", block.Type)
+}
+
+func newKey(kid string, pub crypto.PublicKey, priv crypto.Signer) (*Key, error) {
+	switch p := pub.(type) {
+	case *rsa.PublicKey:
+		if p.N.BitLen() < 2048 {
+			return nil, errors.New("RSA 密钥长度不能少于 2048 位")
+		}
+		return &Key{KID: kid, Alg: AlgRS256, PublicKey: pub, PrivateKey: priv}, nil
+	case ed25519.PublicKey:
+		return &Key{KID: kid, Alg: AlgEdDSA, PublicKey: pub, PrivateKey: priv}, nil
+	}
+	return nil, errors.New("只支持 RSA 和 Ed25519 密钥")
+}
+
+// Generate 在密钥目录中生成一把新私钥，返回 kid
+// kid 以日期开头，默认配置下新生成的密钥会自动成为签发密钥
+func Generate(dir, alg string) (string, error) {
+	var priv crypto.Signer
+	var err error
+	switch alg {
+	case AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	case AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return "", fmt.Errorf("不支持的算法 %s (可选 %s / %s)", alg, AlgRS256, AlgEdDSA)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	kid := time.Now().Format("20060102-150405") + "-" + fmt.Sprintf("%x", suffix)
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	// 私钥文件只允许当前用户读取
+	f, err := os.OpenFile(filepath.Join(dir, kid+".pem"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		return "", err
+	}
+	return kid, nil
+}
+
+// Retire 把私钥替换为公钥，之后只能校验旧 Token、不能再签发
+func Retire(dir, kid string) error {
+	path := filepath.Join(dir, kid+".pem")
+	key, err := readKey(path, kid)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return os.WriteFile(path, data, 0o644)
+}
+
+// --- JWKS (RFC 7517) ---
+
+// JWK 单个公钥
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS 公开的公钥集合，供其他服务校验本系统签发的 Token
+func (s *KeySet) JWKS() map[string][]JWK {
+	keys := make([]JWK, 0, len(s.keys))
+	for _, kid := range s.KIDs() {
+		k := s.keys[kid]
+		jwk := JWK{Use: "sig", Alg: k.Alg, Kid: k.KID}
+		switch p := k.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(p.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(p)
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string][]JWK{"keys": keys}
+}
@@ -0,0 +1,37 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// --- 短信发送 ---
+// 业务代码只依赖 Sender 接口，接入真实短信服务商时新增一个实现并在 Init 中注册即可
+
+// Sender 短信发送器
+type Sender interface {
+	Send(ctx context.Context, phone, message string) error
+}
+
+// Default 全局使用的发送器，由 Init 根据配置初始化
+var Default Sender = LogSender{}
+
+// Init 按配置选择短信发送器
+func Init(provider string) error {
+	switch provider {
+	case "", "log":
+		Default = LogSender{}
+	default:
+		return fmt.Errorf("不支持的短信服务商: %s", provider)
+	}
+	return nil
+}
+
+// LogSender 只把短信内容打印到日志 (本地开发用)
+type LogSender struct{}
+
+func (LogSender) Send(ctx context.Context, phone, message string) error {
+	log.Printf("【短信】发送到 %s: %s", phone, message)
+	return nil
+}
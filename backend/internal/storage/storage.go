@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// --- 文件存储 ---
+// 业务代码只依赖 Store 接口，按配置选择本地目录或 S3 兼容的对象存储 (MinIO、OSS、COS 等)
+// key 是形如 "hospital/2026/10/xxxx.jpg" 的相对路径，由调用方生成
+
+// Store 文件存储
+type Store interface {
+	// Put 写入文件，size 为内容长度
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open 读取文件，不存在时返回 ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete 删除文件，不存在时不报错
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	ErrNotFound   = errors.New("文件不存在")
+	ErrInvalidKey = errors.New("文件路径无效")
+)
+
+// Default 全局使用的存储，由 Init 根据配置初始化
+var Default Store
+
+// Config 存储配置
+type Config struct {
+	Driver   string // local (默认) / s3
+	LocalDir string
+	S3       S3Config
+}
+
+// Init 按配置选择存储
+func Init(cfg Config) error {
+	switch cfg.Driver {
+	case "", "local":
+		dir := cfg.LocalDir
+		if dir == "" {
+			dir = "./storage/uploads"
+		}
+		Default = &LocalStore{Dir: dir}
+	case "s3":
+		s, err := NewS3Store(cfg.S3)
+		if err != nil {
+			return err
+		}
+		Default = s
+	default:
+		return fmt.Errorf("不支持的存储类型: %s", cfg.Driver)
+	}
+	return nil
+}
+
+// CleanKey 校验 key：只能是相对路径，不能包含 .. 或以 / 开头
+func CleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", ErrInvalidKey
+	}
+	cleaned := path.Clean(key)
+	if cleaned != key || cleaned == "." || strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return "", ErrInvalidKey
+	}
+	return cleaned, nil
+}
@@ -1,29 +1,54 @@
-import React, { useState } from 'react';
-import { Form, Input, Button, Card, Typography, message, Select } from 'antd';
-import { UserOutlined, LockOutlined, MailOutlined, ArrowLeftOutlined } from '@ant-design/icons';
+import React, { useEffect, useState } from 'react';
+import { Form, Input, Button, Card, Typography, message, Space } from 'antd';
+import { UserOutlined, LockOutlined, MailOutlined, ArrowLeftOutlined, IdcardOutlined, MobileOutlined } from '@ant-design/icons';
 import { useNavigate } from 'react-router-dom';
 import request from '../utils/request';
 
 const { Title, Text } = Typography;
-const { Option } = Select;
 
 const Register = () => {
     const [loading, setLoading] = useState(false);
+    const [sending, setSending] = useState(false);
+    const [countdown, setCountdown] = useState(0); // 重新发送验证码的倒计时 (秒)
+    const [form] = Form.useForm();
     const navigate = useNavigate();
 
+    useEffect(() => {
+        if (countdown <= 0) return;
+        const timer = setTimeout(() => setCountdown(countdown - 1), 1000);
+        return () => clearTimeout(timer);
+    }, [countdown]);
+
+    // 发送手机验证码
+    const sendCode = async () => {
+        try {
+            await form.validateFields(['phone']);
+        } catch {
+            return;
+        }
+        setSending(true);
+        try {
+            await request.post('/register/sms_code', { phone: form.getFieldValue('phone') });
+            message.success('验证码已发送');
+            setCountdown(60);
+        } catch (error) {
+            message.error(error.response?.data?.error || '验证码发送失败');
+        } finally {
+            setSending(false);
+        }
+    };
+
     const onFinish = async (values) => {
         setLoading(true);
         try {
-            const payload = {
-                ...values,
-                role: 'general_user',
-                org_id: 1
-            };
+            // 角色由后端固定为患者，确认密码只在前端校验
+            const payload = { ...values };
+            delete payload.confirm;
 
             // 使用 request 实例，会自动指向 /api/v1/register
-            await request.post('/register', payload);
+            const res = await request.post('/register', payload);
 
-            message.success('注册成功！');
+            message.success(res.linked_existing_record ? '注册成功，已关联您在医院的就诊档案' : '注册成功！');
             navigate('/login');
         } catch (error) {
             const errorMsg = error.response?.data?.error || '注册失败';
@@ -41,7 +66,7 @@ const Register = () => {
                     <Text type="secondary">创建您的健康档案，开启便捷就医</Text>
                 </div>
 
-                <Form name="register_form" onFinish={onFinish} size="large" layout="vertical">
+                <Form form={form} name="register_form" onFinish={onFinish} size="large" layout="vertical">
                     <Form.Item
                         name="username"
                         label="用户名"
@@ -77,6 +102,51 @@ const Register = () => {
                         <Input.Password prefix={<LockOutlined />} placeholder="请再次输入密码" />
                     </Form.Item>
 
+                    <Form.Item
+                        name="real_name"
+                        label="真实姓名"
+                        rules={[{ required: true, message: '请输入与身份证一致的姓名' }]}
+                    >
+                        <Input prefix={<UserOutlined />} placeholder="与身份证一致" />
+                    </Form.Item>
+
+                    <Form.Item
+                        name="id_card"
+                        label="身份证号"
+                        rules={[
+                            { required: true, message: '请输入身份证号' },
+                            { pattern: /^\d{17}[\dXx]$/, message: '请输入 18 位身份证号' },
+                        ]}
+                    >
+                        <Input prefix={<IdcardOutlined />} placeholder="已在医院就诊过的将自动关联档案" />
+                    </Form.Item>
+
+                    <Form.Item
+                        name="phone"
+                        label="手机号"
+                        rules={[
+                            { required: true, message: '请输入手机号' },
+                            { pattern: /^1[3-9]\d{9}$/, message: '手机号格式错误' },
+                        ]}
+                    >
+                        <Input prefix={<MobileOutlined />} placeholder="用于接收验证码" />
+                    </Form.Item>
+
+                    <Form.Item label="验证码" required>
+                        <Space.Compact style={{ width: '100%' }}>
+                            <Form.Item
+                                name="sms_code"
+                                noStyle
+                                rules={[{ required: true, message: '请输入验证码' }]}
+                            >
+                                <Input prefix={<MailOutlined />} placeholder="6 位验证码" />
+                            </Form.Item>
+                            <Button onClick={sendCode} loading={sending} disabled={countdown > 0}>
+                                {countdown > 0 ? `${countdown} 秒后重发` : '获取验证码'}
+                            </Button>
+                        </Space.Compact>
+                    </Form.Item>
+
                     <Form.Item>
                         <Button type="primary" htmlType="submit" block loading={loading}>
                             立即注册
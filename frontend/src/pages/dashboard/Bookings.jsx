@@ -192,6 +192,17 @@ const Bookings = () => {
             />
           </Form.Item>
 
+          {/* 前台挂号：填写身份证号时自动关联 (或新建) 患者档案，急诊来不及核实可留空 */}
+          {userRole !== "general_user" && (
+            <Form.Item
+              name="id_card"
+              label="身份证号"
+              rules={[{ pattern: /^\d{17}[\dXx]$/, message: "请输入 18 位身份证号" }]}
+            >
+              <Input placeholder="选填，用于关联患者档案" />
+            </Form.Item>
+          )}
+
           <Form.Item name="gender" label="性别" rules={[{ required: true }]}>
             <Select
               options={[
@@ -86,7 +86,8 @@ const Users = () => {
         // === 编辑模式 (PUT) ===
         await request.put(`/dashboard/users/${editingUser.id}`, {
           role: values.role,
-          department: values.department,
+          // 清空科室时传空字符串 (不传表示不修改)
+          department: values.department ?? "",
           // 如果不想在编辑时强制改密码，后端应处理 password 为空的情况
           password: values.password,
         });